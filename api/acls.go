@@ -0,0 +1,204 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type grantRequest struct {
+	// Path is a file name, or a folder prefix ending with "/"
+	Path string `json:"path"`
+	// GranteeType is user (default) or group
+	GranteeType string `json:"granteeType"`
+	Grantee     string `json:"grantee"`
+	// Permission is read (default) or read-write
+	Permission string `json:"permission"`
+}
+
+func (h *Handler) registerACLRoutes(e *echo.Group) {
+	e.POST("/acls/:username", h.grantAccess)
+	e.GET("/acls/:username", h.listGrants)
+	e.DELETE("/acls/:username/:aclid", h.revokeAccess)
+}
+
+func (h *Handler) registerSharedRoutes(e *echo.Group) {
+	e.GET("/shared-with-me", h.sharedWithMe)
+}
+
+func aclResponse(acl models.ACL) map[string]any {
+	return map[string]any{
+		"aclId":       acl.AclId,
+		"owner":       acl.Owner,
+		"path":        acl.Path,
+		"granteeType": acl.GranteeType,
+		"grantee":     acl.Grantee,
+		"permission":  acl.Permission,
+		"createdAt":   acl.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// grantAccess shares a file or folder with another user or a group
+func (h *Handler) grantAccess(c echo.Context) error {
+	owner := c.Param("username")
+	var req grantRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+	if req.GranteeType == "" {
+		req.GranteeType = models.GRANTEE_USER
+	}
+	if req.Permission == "" {
+		req.Permission = models.PERMISSION_READ
+	}
+
+	if req.Path == "" || strings.HasPrefix(req.Path, "/") {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "path must be a file name or a folder ending with /",
+		})
+	}
+	for _, segment := range strings.Split(strings.TrimSuffix(req.Path, "/"), "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid path",
+			})
+		}
+	}
+	if req.GranteeType != models.GRANTEE_USER && req.GranteeType != models.GRANTEE_GROUP {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "granteeType must be user or group",
+		})
+	}
+	if req.Grantee == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "grantee is required",
+		})
+	}
+	if req.GranteeType == models.GRANTEE_USER && req.Grantee == owner {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "files cannot be shared with their owner",
+		})
+	}
+	if req.Permission != models.PERMISSION_READ && req.Permission != models.PERMISSION_READ_WRITE {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "permission must be read or read-write",
+		})
+	}
+
+	acl, err := h.acls.Grant(c.Request().Context(), models.ACL{
+		Owner:       owner,
+		Path:        req.Path,
+		GranteeType: req.GranteeType,
+		Grantee:     req.Grantee,
+		Permission:  req.Permission,
+	})
+	if err != nil {
+		log.Printf("failed to grant access: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to grant access",
+		})
+	}
+	return c.JSON(http.StatusCreated, aclResponse(acl))
+}
+
+func (h *Handler) listGrants(c echo.Context) error {
+	acls, err := h.acls.List(c.Request().Context(), c.Param("username"))
+	if err != nil {
+		log.Printf("failed to list grants: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to list grants",
+		})
+	}
+
+	response := make([]map[string]any, 0, len(acls))
+	for _, acl := range acls {
+		response = append(response, aclResponse(acl))
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"grants": response,
+	})
+}
+
+func (h *Handler) revokeAccess(c echo.Context) error {
+	err := h.acls.Revoke(c.Request().Context(), c.Param("username"), c.Param("aclid"))
+	if errors.Is(err, services.ErrACLNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "grant not found",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to revoke access: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to revoke access",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// sharedWithMe lists the grants other users made to the caller or its groups,
+// each with the files it currently covers. Folders list at most
+// MAX_LIST_LIMIT files.
+func (h *Handler) sharedWithMe(c echo.Context) error {
+	ctx := c.Request().Context()
+	identity, ok := identityFrom(c)
+	if !ok {
+		return c.JSON(http.StatusOK, map[string]any{
+			"shared": []map[string]any{},
+		})
+	}
+
+	acls, err := h.acls.SharedWith(ctx, identity.Subject, identity.Groups)
+	if err != nil {
+		log.Printf("failed to list shared files: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to list shared files",
+		})
+	}
+
+	response := make([]map[string]any, 0, len(acls))
+	for _, acl := range acls {
+		var files []models.FileMetadata
+		if acl.IsFolder() {
+			files, _, err = h.meta.ListMetadata(ctx, repositories.ListOptions{
+				Owner:  acl.Owner,
+				Prefix: acl.Path,
+				Limit:  services.MAX_LIST_LIMIT,
+			})
+		} else {
+			var file models.FileMetadata
+			file, err = h.meta.GetMetadataByName(ctx, acl.Owner, acl.Path)
+			if err == nil {
+				files = append(files, file)
+			} else if err == sql.ErrNoRows {
+				err = nil
+			}
+		}
+		if err != nil {
+			log.Printf("failed to list shared files: %v", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to list shared files",
+			})
+		}
+
+		entry := aclResponse(acl)
+		described := make([]map[string]any, 0, len(files))
+		for _, file := range files {
+			described = append(described, h.fileResponse(file))
+		}
+		entry["files"] = described
+		response = append(response, entry)
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"shared": response,
+	})
+}
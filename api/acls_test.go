@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+// authorizeGroups signs an access token for subject as a member of groups
+func authorizeGroups(req *http.Request, subject string, groups ...string) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":    subject,
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"groups": groups,
+	}).SignedString([]byte(TEST_JWT_SECRET))
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set(ACCESS_TOKEN_HEADER, token)
+}
+
+// grant shares owner's path and returns the id of the grant
+func grant(t *testing.T, e *echo.Echo, owner string, body string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/acls/"+owner, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	authorize(req, owner)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	return result["aclId"].(string)
+}
+
+func TestSharing(t *testing.T) {
+	e, _ := newTestServer(t)
+	uploadContent(t, e, "alice", "report.pdf", "report")
+	uploadContent(t, e, "alice", "notes.txt", "notes")
+	uploadContent(t, e, "alice", "photos-1.png", "photo")
+
+	readId := grant(t, e, "alice", `{"path": "report.pdf", "grantee": "bob"}`)
+	grant(t, e, "alice", `{"path": "notes.txt", "grantee": "bob", "permission": "read-write"}`)
+	grant(t, e, "alice", `{"path": "photos-1.png", "grantee": "family", "granteeType": "group"}`)
+	grant(t, e, "alice", `{"path": "photos/", "grantee": "family", "granteeType": "group"}`)
+
+	request := func(method string, target string, prepare func(req *http.Request)) int {
+		req := httptest.NewRequest(method, target, strings.NewReader("changed"))
+		prepare(req)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	asBob := func(req *http.Request) { authorize(req, "bob") }
+	asCarol := func(req *http.Request) { authorize(req, "carol") }
+	asFamily := func(req *http.Request) { authorizeGroups(req, "dave", "family") }
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		prepare func(req *http.Request)
+		want    int
+	}{
+		{"read grant downloads", http.MethodGet, "/api/download/alice/report.pdf", asBob, http.StatusOK},
+		{"read grant cannot upload", http.MethodPost, "/api/upload/alice/report.pdf", asBob, http.StatusForbidden},
+		{"read grant cannot delete", http.MethodDelete, "/api/delete/alice/report.pdf", asBob, http.StatusForbidden},
+		{"read-write grant uploads", http.MethodPost, "/api/upload/alice/notes.txt", asBob, http.StatusOK},
+		{"grant covers only its file", http.MethodGet, "/api/download/alice/photos-1.png", asBob, http.StatusForbidden},
+		{"others have no access", http.MethodGet, "/api/download/alice/report.pdf", asCarol, http.StatusForbidden},
+		{"group grant downloads", http.MethodGet, "/api/download/alice/photos-1.png", asFamily, http.StatusOK},
+		{"grants do not cover listings", http.MethodGet, "/api/files/alice", asBob, http.StatusForbidden},
+		{"read-write grant deletes", http.MethodDelete, "/api/delete/alice/notes.txt", asBob, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := request(tt.method, tt.target, tt.prepare); code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, code)
+			}
+		})
+	}
+
+	t.Run("shared with me", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/shared-with-me", nil)
+		authorizeGroups(req, "dave", "family")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		var result struct {
+			Shared []struct {
+				Owner string           `json:"owner"`
+				Path  string           `json:"path"`
+				Files []map[string]any `json:"files"`
+			} `json:"shared"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		if len(result.Shared) != 2 {
+			t.Fatalf("expected 2 grants, got %+v", result.Shared)
+		}
+		for _, shared := range result.Shared {
+			if shared.Owner != "alice" {
+				t.Fatalf("unexpected grant %+v", shared)
+			}
+			if shared.Path == "photos-1.png" && (len(shared.Files) != 1 || shared.Files[0]["fileName"] != "photos-1.png") {
+				t.Fatalf("expected the shared file to be listed, got %+v", shared)
+			}
+			if shared.Path == "photos/" && len(shared.Files) != 0 {
+				t.Fatalf("expected an empty folder, got %+v", shared)
+			}
+		}
+	})
+
+	t.Run("revoked grant is refused", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/api/acls/alice/"+readId, nil)
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", rec.Code)
+		}
+		if code := request(http.MethodGet, "/api/download/alice/report.pdf", asBob); code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", code)
+		}
+	})
+
+	t.Run("invalid grants are rejected", func(t *testing.T) {
+		for _, body := range []string{
+			`{"path": "../etc", "grantee": "bob"}`,
+			`{"path": "a.txt", "grantee": "alice"}`,
+			`{"path": "a.txt", "grantee": "bob", "permission": "owner"}`,
+		} {
+			req := httptest.NewRequest(http.MethodPost, "/api/acls/alice", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			authorize(req, "alice")
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400 for %s, got %d", body, rec.Code)
+			}
+		}
+	})
+}
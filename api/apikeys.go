@@ -0,0 +1,134 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/auth"
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type createAPIKeyRequest struct {
+	Name string `json:"name"`
+	// Scopes are any of read, write, delete and admin, limited to the scopes
+	// the caller holds; only admins may create admin keys
+	Scopes []string `json:"scopes"`
+}
+
+func (h *Handler) registerAPIKeyRoutes(e *echo.Group) {
+	e.POST("/api-keys/:username", h.createAPIKey)
+	e.GET("/api-keys/:username", h.listAPIKeys)
+	e.DELETE("/api-keys/:username/:keyid", h.revokeAPIKey)
+}
+
+// apiKeyResponse describes a key without the key itself, which is only
+// returned once on creation
+func apiKeyResponse(key models.APIKey) map[string]any {
+	var lastUsedAt, revokedAt any
+	if !key.LastUsedAt.IsZero() {
+		lastUsedAt = key.LastUsedAt.UTC().Format(time.RFC3339)
+	}
+	if key.Revoked() {
+		revokedAt = key.RevokedAt.UTC().Format(time.RFC3339)
+	}
+	return map[string]any{
+		"keyId":      key.KeyId,
+		"name":       key.Name,
+		"scopes":     key.Scopes,
+		"createdAt":  key.CreatedAt.UTC().Format(time.RFC3339),
+		"lastUsedAt": lastUsedAt,
+		"revokedAt":  revokedAt,
+	}
+}
+
+func (h *Handler) createAPIKey(c echo.Context) error {
+	var req createAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+	if req.Name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "name is required",
+		})
+	}
+	if len(req.Scopes) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "at least one scope is required",
+		})
+	}
+	owner := c.Param("username")
+	identity, authenticated := identityFrom(c)
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "unknown scope " + scope + ", expected read, write, delete or admin",
+			})
+		}
+		// a key must not do more than its owner, so admin keys are only
+		// created by admins for themselves
+		if authenticated && (!identity.Grants(scope) || scope == auth.SCOPE_ADMIN && identity.Subject != owner) {
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": "not allowed to grant scope " + scope,
+			})
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	key, apiKey, err := h.apiKeys.Create(c.Request().Context(), owner, req.Name, scopes)
+	if err != nil {
+		log.Printf("failed to create API key: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to create API key",
+		})
+	}
+
+	response := apiKeyResponse(apiKey)
+	response["key"] = key
+	return c.JSON(http.StatusCreated, response)
+}
+
+func (h *Handler) listAPIKeys(c echo.Context) error {
+	keys, err := h.apiKeys.List(c.Request().Context(), c.Param("username"))
+	if err != nil {
+		log.Printf("failed to list API keys: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to list API keys",
+		})
+	}
+
+	response := make([]map[string]any, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, apiKeyResponse(key))
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"keys": response,
+	})
+}
+
+// revokeAPIKey disables a key immediately; it stays listed as revoked
+func (h *Handler) revokeAPIKey(c echo.Context) error {
+	err := h.apiKeys.Revoke(c.Request().Context(), c.Param("username"), c.Param("keyid"))
+	if errors.Is(err, services.ErrAPIKeyNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "API key not found",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to revoke API key: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to revoke API key",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// createAPIKey creates a key for user and returns the key and its id
+func createAPIKey(t *testing.T, e *echo.Echo, user string, scopes ...string) (string, string) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"name": "test key", "scopes": scopes})
+	req := httptest.NewRequest(http.MethodPost, "/api/api-keys/"+user, strings.NewReader(string(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	// the token holds the scopes it grants, so that admins can create admin keys
+	authorize(req, user, scopes...)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	return result["key"].(string), result["keyId"].(string)
+}
+
+func TestAPIKeys(t *testing.T) {
+	e, _ := newTestServer(t)
+	uploadContent(t, e, "alice", "a.txt", "hello")
+
+	request := func(method string, target string, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader("content"))
+		req.Header.Set(ACCESS_TOKEN_HEADER, key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	readOnly, readOnlyId := createAPIKey(t, e, "alice", "read")
+	writer, _ := createAPIKey(t, e, "alice", "read", "write")
+	deleter, _ := createAPIKey(t, e, "alice", "delete")
+	admin, _ := createAPIKey(t, e, "root", "admin")
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		key    string
+		want   int
+	}{
+		{"read key downloads", http.MethodGet, "/api/download/alice/a.txt", readOnly, http.StatusOK},
+		{"read key lists", http.MethodGet, "/api/files/alice", readOnly, http.StatusOK},
+		{"read key cannot upload", http.MethodPost, "/api/upload/alice/b.txt", readOnly, http.StatusForbidden},
+		{"read key cannot delete", http.MethodDelete, "/api/delete/alice/a.txt", readOnly, http.StatusForbidden},
+		{"read key cannot manage keys", http.MethodGet, "/api/api-keys/alice", readOnly, http.StatusForbidden},
+		{"write key uploads", http.MethodPost, "/api/upload/alice/b.txt", writer, http.StatusOK},
+		{"key is bound to its owner", http.MethodGet, "/api/download/bob/a.txt", writer, http.StatusForbidden},
+		{"user key cannot act on other users", http.MethodGet, "/api/files/bob", writer, http.StatusForbidden},
+		{"user key cannot change quotas", http.MethodPut, "/api/quotas/alice", writer, http.StatusForbidden},
+		{"delete key deletes", http.MethodDelete, "/api/delete/alice/b.txt", deleter, http.StatusOK},
+		{"admin key acts on other users", http.MethodGet, "/api/files/bob", admin, http.StatusOK},
+		{"unknown key", http.MethodGet, "/api/files/alice", "fsk_unknown", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := request(tt.method, tt.target, tt.key); rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("list shows usage without the key", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/api-keys/alice", nil)
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		if strings.Contains(rec.Body.String(), readOnly) {
+			t.Fatal("expected the key itself not to be listed")
+		}
+		var result struct {
+			Keys []map[string]any `json:"keys"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		if len(result.Keys) != 3 {
+			t.Fatalf("expected 3 keys, got %v", result.Keys)
+		}
+		for _, key := range result.Keys {
+			if key["keyId"] == readOnlyId && key["lastUsedAt"] == nil {
+				t.Fatalf("expected the last use to be recorded, got %v", key)
+			}
+		}
+	})
+
+	t.Run("revoked key is refused", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/api/api-keys/alice/"+readOnlyId, nil)
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", rec.Code)
+		}
+		if rec := request(http.MethodGet, "/api/files/alice", readOnly); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", rec.Code)
+		}
+	})
+
+	t.Run("other users cannot revoke", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/api/api-keys/alice/"+readOnlyId, nil)
+		authorize(req, "bob")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", rec.Code)
+		}
+	})
+
+	grant := func(owner string, scopes string, prepare func(req *http.Request)) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/api-keys/"+owner, strings.NewReader(`{"name":"x","scopes":`+scopes+`}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		prepare(req)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	t.Run("users cannot create admin keys", func(t *testing.T) {
+		code := grant("alice", `["admin"]`, func(req *http.Request) { authorize(req, "alice") })
+		if code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", code)
+		}
+	})
+
+	t.Run("admins cannot give other users admin keys", func(t *testing.T) {
+		code := grant("alice", `["admin"]`, func(req *http.Request) { authorize(req, "root", "admin") })
+		if code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", code)
+		}
+	})
+
+	t.Run("keys cannot widen their scopes", func(t *testing.T) {
+		key, _ := createAPIKey(t, e, "root", "admin")
+		if code := grant("root", `["read"]`, func(req *http.Request) { req.Header.Set(ACCESS_TOKEN_HEADER, key) }); code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d", code)
+		}
+		if code := grant("alice", `["read"]`, func(req *http.Request) { req.Header.Set(ACCESS_TOKEN_HEADER, writer) }); code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", code)
+		}
+	})
+
+	t.Run("unknown scope is rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/api-keys/alice", strings.NewReader(`{"name":"x","scopes":["root"]}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	ARCHIVE_FORMAT_ZIP   = "zip"
+	ARCHIVE_FORMAT_TAR   = "tar"
+	ARCHIVE_FORMAT_TARGZ = "tar.gz"
+)
+
+var errArchiveTooLarge = errors.New("archive too large")
+
+type archiveRequest struct {
+	// Files are the paths of the files to include
+	Files []string `json:"files" query:"file"`
+	// Folder includes every file below it
+	Folder string `json:"folder" query:"folder"`
+	// Format is ARCHIVE_FORMAT_ZIP, the default, or ARCHIVE_FORMAT_TARGZ
+	Format string `json:"format" query:"format"`
+}
+
+// registerArchiveRoutes serves several files as one archive. GET takes the
+// request as query parameters, for plain links, and POST as a JSON body, for
+// lists too long for a URL.
+func (h *Handler) registerArchiveRoutes(e *echo.Group) {
+	e.GET("/archive/:username", h.downloadArchive)
+	e.POST("/archive/:username", h.downloadArchive)
+}
+
+// downloadArchive streams the requested files as a ZIP or tar.gz archive
+// built on the fly. Files are read like downloadFile reads them, and each is
+// named by its path, relative to the parent of the folder when a folder was
+// requested.
+func (h *Handler) downloadArchive(c echo.Context) error {
+	ctx := c.Request().Context()
+	username := c.Param("username")
+
+	var req archiveRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request",
+		})
+	}
+	if req.Format == "" {
+		req.Format = ARCHIVE_FORMAT_ZIP
+	}
+	if req.Format != ARCHIVE_FORMAT_ZIP && req.Format != ARCHIVE_FORMAT_TARGZ {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "format must be zip or tar.gz",
+		})
+	}
+	if len(req.Files) == 0 && req.Folder == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "files or folder is required",
+		})
+	}
+
+	files, err := h.archiveFiles(ctx, username, req)
+	var notFound missingFileError
+	switch {
+	case errors.Is(err, ErrInvalidPath):
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid path",
+		})
+	case errors.As(err, &notFound):
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "file not found: " + string(notFound),
+		})
+	case errors.Is(err, errArchiveTooLarge):
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "archive would exceed " + strconv.FormatInt(h.cfg.ArchiveMaxBytes, 10) + " bytes",
+		})
+	case err != nil:
+		log.Printf("failed to collect files: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to create archive",
+		})
+	}
+
+	// entries are named relative to the folder's parent, so the archive
+	// unpacks into a directory named like the folder
+	base := ""
+	name := username
+	if req.Folder != "" {
+		name = req.Folder[strings.LastIndex(req.Folder, "/")+1:]
+		base = strings.TrimSuffix(req.Folder, name)
+	}
+
+	header := c.Response().Header()
+	if req.Format == ARCHIVE_FORMAT_ZIP {
+		header.Set(echo.HeaderContentType, "application/zip")
+	} else {
+		header.Set(echo.HeaderContentType, "application/gzip")
+	}
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{
+		"filename": name + "." + req.Format,
+	}))
+	c.Response().WriteHeader(http.StatusOK)
+
+	// once the archive started the status cannot change, so a failure only
+	// cuts it short, which leaves it unreadable rather than silently partial
+	if req.Format == ARCHIVE_FORMAT_ZIP {
+		err = h.writeZip(ctx, c.Response(), username, files, base)
+	} else {
+		err = h.writeTarGz(ctx, c.Response(), username, files, base)
+	}
+	if err != nil {
+		log.Printf("failed to write archive: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+	return nil
+}
+
+// missingFileError names a requested file that does not exist
+type missingFileError string
+
+func (e missingFileError) Error() string {
+	return "file not found: " + string(e)
+}
+
+// archiveFiles resolves the requested files to their metadata, failing
+// before anything is sent when one is missing or the archive would exceed
+// the configured size
+func (h *Handler) archiveFiles(ctx context.Context, owner string, req archiveRequest) ([]models.FileMetadata, error) {
+	var files []models.FileMetadata
+	seen := map[string]bool{}
+	for _, filename := range req.Files {
+		if _, err := cleanPath(filename); err != nil {
+			return nil, err
+		}
+		if seen[filename] {
+			continue
+		}
+		seen[filename] = true
+
+		metadata, err := h.meta.GetMetadataByName(ctx, owner, filename)
+		if err == sql.ErrNoRows {
+			return nil, missingFileError(filename)
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, metadata)
+	}
+
+	if req.Folder != "" {
+		if _, err := cleanPath(req.Folder); err != nil {
+			return nil, err
+		}
+		opts := repositories.ListOptions{Owner: owner, Prefix: req.Folder + "/", Limit: services.MAX_LIST_LIMIT}
+		for {
+			page, next, err := h.meta.ListMetadata(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			for _, metadata := range page {
+				if !seen[metadata.FileName] {
+					seen[metadata.FileName] = true
+					files = append(files, metadata)
+				}
+			}
+			if next == "" {
+				break
+			}
+			opts.Cursor = next
+		}
+	}
+
+	var total int64
+	for _, metadata := range files {
+		total += metadata.Size
+	}
+	if h.cfg.ArchiveMaxBytes > 0 && total > h.cfg.ArchiveMaxBytes {
+		return nil, errArchiveTooLarge
+	}
+	return files, nil
+}
+
+// writeZip writes files as a ZIP archive. archive/zip switches to ZIP64
+// records by itself once an entry or the archive outgrows the classic format.
+func (h *Handler) writeZip(ctx context.Context, w io.Writer, owner string, files []models.FileMetadata, base string) error {
+	archive := zip.NewWriter(w)
+	for _, metadata := range files {
+		entry, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     strings.TrimPrefix(metadata.FileName, base),
+			Method:   zip.Deflate,
+			Modified: metadata.UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if err := h.copyFile(ctx, entry, owner, metadata.FileName, -1); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// writeTarGz writes files as a gzip compressed tar archive
+func (h *Handler) writeTarGz(ctx context.Context, w io.Writer, owner string, files []models.FileMetadata, base string) error {
+	compressed := gzip.NewWriter(w)
+	archive := tar.NewWriter(compressed)
+	for _, metadata := range files {
+		err := archive.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     strings.TrimPrefix(metadata.FileName, base),
+			Size:     metadata.Size,
+			Mode:     0644,
+			ModTime:  metadata.UpdatedAt,
+			Format:   tar.FormatPAX,
+		})
+		if err != nil {
+			return err
+		}
+		// tar announces the size up front, so the content must match it
+		if err := h.copyFile(ctx, archive, owner, metadata.FileName, metadata.Size); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+// copyFile writes owner's file to w, failing unless it holds size bytes when
+// size is not -1
+func (h *Handler) copyFile(ctx context.Context, w io.Writer, owner string, filename string, size int64) error {
+	reader, metadata, err := h.openFile(ctx, owner, filename)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	n, err := io.Copy(w, reader)
+	if err != nil {
+		return err
+	}
+	if size != -1 && n != size {
+		return errors.New("size of " + filename + " changed while archiving")
+	}
+	if metadata.FileId != "" {
+		if err := h.meta.MarkAccessed(ctx, metadata.FileId); err != nil {
+			log.Printf("failed to record access to %v: %v", filename, err)
+		}
+	}
+	return nil
+}
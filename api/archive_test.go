@@ -0,0 +1,113 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestArchiveDownload(t *testing.T) {
+	e, cfg := newTestServer(t)
+	uploadContent(t, e, "alice", "docs/a.txt", "first")
+	uploadContent(t, e, "alice", "docs/2024/b.txt", "second")
+	uploadContent(t, e, "alice", "top.txt", "top")
+
+	request := func(method string, target string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		}
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("zip of a folder", func(t *testing.T) {
+		rec := request(http.MethodGet, "/api/archive/alice?folder=docs", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if disposition := rec.Header().Get(echo.HeaderContentDisposition); disposition != `attachment; filename=docs.zip` {
+			t.Fatalf("unexpected Content-Disposition %q", disposition)
+		}
+
+		archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+		if err != nil {
+			t.Fatalf("failed to read zip: %v", err)
+		}
+		contents := map[string]string{}
+		for _, file := range archive.File {
+			entry, err := file.Open()
+			if err != nil {
+				t.Fatalf("failed to open %v: %v", file.Name, err)
+			}
+			data, _ := io.ReadAll(entry)
+			entry.Close()
+			contents[file.Name] = string(data)
+		}
+		if len(contents) != 2 || contents["docs/a.txt"] != "first" || contents["docs/2024/b.txt"] != "second" {
+			t.Fatalf("unexpected entries %v", contents)
+		}
+	})
+
+	t.Run("tar.gz of files", func(t *testing.T) {
+		rec := request(http.MethodPost, "/api/archive/alice", `{"files": ["top.txt", "docs/a.txt"], "format": "tar.gz"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		compressed, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatalf("failed to read gzip: %v", err)
+		}
+		archive := tar.NewReader(compressed)
+		var names []string
+		for {
+			header, err := archive.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("failed to read tar: %v", err)
+			}
+			data, _ := io.ReadAll(archive)
+			names = append(names, header.Name+"="+string(data))
+		}
+		if strings.Join(names, ",") != "top.txt=top,docs/a.txt=first" {
+			t.Fatalf("unexpected entries %v", names)
+		}
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for target, want := range map[string]int{
+			"/api/archive/alice":                        http.StatusBadRequest,
+			"/api/archive/alice?folder=docs&format=rar": http.StatusBadRequest,
+			"/api/archive/alice?file=missing.txt":       http.StatusNotFound,
+			"/api/archive/alice?file=docs/../../bob/x":  http.StatusBadRequest,
+			"/api/archive/alice?file=top.txt&file=%2Fa": http.StatusBadRequest,
+		} {
+			if rec := request(http.MethodGet, target, ""); rec.Code != want {
+				t.Fatalf("expected %d for %s, got %d", want, target, rec.Code)
+			}
+		}
+	})
+
+	t.Run("size cap", func(t *testing.T) {
+		cfg.ArchiveMaxBytes = 10
+		defer func() { cfg.ArchiveMaxBytes = 0 }()
+		if rec := request(http.MethodGet, "/api/archive/alice?folder=docs", ""); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 over the cap, got %d", rec.Code)
+		}
+		if rec := request(http.MethodGet, "/api/archive/alice?file=top.txt", ""); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 within the cap, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/auth"
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+// ACCESS_TOKEN_HEADER carries the JWT or API key that authenticates a request
+const ACCESS_TOKEN_HEADER = "X-Access-Token"
+
+// IDENTITY_KEY is where authenticate stores the request's auth.Identity
+const IDENTITY_KEY = "identity"
+
+// authenticate requires a valid access token or API key allowing scope, and
+// only lets it act on the files of its subject, unless it carries the admin
+// scope
+func (h *Handler) authenticate(scope string) echo.MiddlewareFunc {
+	return h.authenticateWith(scope, false)
+}
+
+// authenticateShared is authenticate for routes acting on a single file,
+// which may also be accessed by the users and groups it was shared with
+func (h *Handler) authenticateShared(scope string) echo.MiddlewareFunc {
+	return h.authenticateWith(scope, true)
+}
+
+func (h *Handler) authenticateWith(scope string, shared bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if h.cfg.AuthDisabled {
+				return next(c)
+			}
+
+			token := c.Request().Header.Get(ACCESS_TOKEN_HEADER)
+			if token == "" {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "missing access token",
+				})
+			}
+			identity, err := h.identify(c, token)
+			if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, services.ErrInvalidAPIKey) {
+				log.Printf("rejected access token: %v", err)
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "invalid access token",
+				})
+			}
+			if err != nil {
+				log.Printf("failed to check access token: %v", err)
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error": "failed to check access token",
+				})
+			}
+
+			if !identity.Allows(scope) {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "missing scope " + scope,
+				})
+			}
+			if user := pathUser(c); user != "" && !identity.CanActAs(user) {
+				granted := false
+				if shared {
+					if granted, err = h.isShared(c, identity, user, c.Param("filename"), scope); err != nil {
+						log.Printf("failed to check grants: %v", err)
+						return c.JSON(http.StatusInternalServerError, map[string]string{
+							"error": "failed to check access",
+						})
+					}
+				}
+				if !granted {
+					return c.JSON(http.StatusForbidden, map[string]string{
+						"error": "access denied",
+					})
+				}
+			}
+
+			c.Set(IDENTITY_KEY, identity)
+			return next(c)
+		}
+	}
+}
+
+// identify turns an API key or a JWT into the identity it acts as
+func (h *Handler) identify(c echo.Context, token string) (auth.Identity, error) {
+	if !strings.HasPrefix(token, services.API_KEY_PREFIX) {
+		return h.verifier.Verify(token)
+	}
+	key, err := h.apiKeys.Authenticate(c.Request().Context(), token)
+	if err != nil {
+		return auth.Identity{}, err
+	}
+	return auth.Identity{
+		Subject:  key.Owner,
+		Scopes:   key.Scopes,
+		APIKeyId: key.KeyId,
+	}, nil
+}
+
+// isShared reports whether owner's file was shared with the identity; reading
+// needs a read grant, while writing and deleting need a read-write grant
+func (h *Handler) isShared(c echo.Context, identity auth.Identity, owner string, filename string, scope string) (bool, error) {
+	permission := models.PERMISSION_READ_WRITE
+	if scope == auth.SCOPE_READ {
+		permission = models.PERMISSION_READ
+	}
+	return h.acls.Allowed(c.Request().Context(), owner, filename, identity.Subject, identity.Groups, permission)
+}
+
+// mayAccess is the check authenticateShared makes, for a file other than the
+// one in the route
+func (h *Handler) mayAccess(c echo.Context, owner string, filename string, scope string) (bool, error) {
+	identity, ok := identityFrom(c)
+	if !ok {
+		return true, nil
+	}
+	if !identity.Allows(scope) {
+		return false, nil
+	}
+	if identity.CanActAs(owner) {
+		return true, nil
+	}
+	return h.isShared(c, identity, owner, filename, scope)
+}
+
+// pathUser is the user whose files the route acts on
+func pathUser(c echo.Context) string {
+	if user := c.Param("userid"); user != "" {
+		return user
+	}
+	return c.Param("username")
+}
+
+// identityFrom returns the identity authenticate bound to the request
+func identityFrom(c echo.Context) (auth.Identity, bool) {
+	identity, ok := c.Get(IDENTITY_KEY).(auth.Identity)
+	return identity, ok
+}
+
+// author is who writes a file of owner in this request: the authenticated
+// subject, or the owner for pre-signed URLs and without authentication
+func author(c echo.Context, owner string) string {
+	if identity, ok := identityFrom(c); ok && identity.Subject != "" {
+		return identity.Subject
+	}
+	return owner
+}
+
+// allows reports whether the request's identity allows scope, which is always
+// the case when authentication is disabled
+func allows(c echo.Context, scope string) bool {
+	identity, ok := identityFrom(c)
+	return !ok || identity.Allows(scope)
+}
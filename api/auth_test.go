@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const TEST_JWT_SECRET = "test-secret"
+
+// authorize signs an access token for subject with the test secret
+func authorize(req *http.Request, subject string, scopes ...string) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   subject,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": strings.Join(scopes, " "),
+	}).SignedString([]byte(TEST_JWT_SECRET))
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set(ACCESS_TOKEN_HEADER, token)
+}
+
+func TestAuthentication(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	request := func(method string, target string, prepare func(req *http.Request)) int {
+		req := httptest.NewRequest(method, target, strings.NewReader("content"))
+		prepare(req)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		prepare func(req *http.Request)
+		want    int
+	}{
+		{"ping is public", http.MethodGet, "/api/ping", func(req *http.Request) {}, http.StatusOK},
+		{"missing token", http.MethodPost, "/api/upload/alice/a.txt", func(req *http.Request) {}, http.StatusUnauthorized},
+		{"garbage token", http.MethodPost, "/api/upload/alice/a.txt", func(req *http.Request) {
+			req.Header.Set(ACCESS_TOKEN_HEADER, "not.a.token")
+		}, http.StatusUnauthorized},
+		{"wrong secret", http.MethodPost, "/api/upload/alice/a.txt", func(req *http.Request) {
+			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+				"sub": "alice",
+				"exp": time.Now().Add(time.Hour).Unix(),
+			}).SignedString([]byte("another secret"))
+			req.Header.Set(ACCESS_TOKEN_HEADER, token)
+		}, http.StatusUnauthorized},
+		{"own files", http.MethodPost, "/api/upload/alice/a.txt", func(req *http.Request) {
+			authorize(req, "alice")
+		}, http.StatusOK},
+		{"other user's upload", http.MethodPost, "/api/upload/alice/a.txt", func(req *http.Request) {
+			authorize(req, "bob")
+		}, http.StatusForbidden},
+		{"other user's download", http.MethodGet, "/api/download/alice/a.txt", func(req *http.Request) {
+			authorize(req, "bob")
+		}, http.StatusForbidden},
+		{"other user's listing", http.MethodGet, "/api/files/alice", func(req *http.Request) {
+			authorize(req, "bob", "read")
+		}, http.StatusForbidden},
+		{"admin", http.MethodGet, "/api/download/alice/a.txt", func(req *http.Request) {
+			authorize(req, "bob", "read", "admin")
+		}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := request(tt.method, tt.target, tt.prepare); code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,367 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+// EXTRACT_RATIO_GRACE is how much content an archive may expand to before its
+// compression ratio is checked, so that small, very compressible files pass
+const EXTRACT_RATIO_GRACE = 1 << 20
+
+const (
+	ENTRY_STORED   = "stored"
+	ENTRY_FOLDER   = "folder"
+	ENTRY_SKIPPED  = "skipped"
+	ENTRY_REJECTED = "rejected"
+	ENTRY_FAILED   = "failed"
+)
+
+var (
+	errExtractTooLarge   = errors.New("archive expands beyond the allowed size")
+	errExtractRatio      = errors.New("archive is compressed suspiciously well")
+	errExtractTooMany    = errors.New("archive has too many entries")
+	errUnknownArchiveFmt = errors.New("unknown archive format")
+)
+
+// archiveEntry is one member of an uploaded archive, whatever its format
+type archiveEntry struct {
+	name    string
+	dir     bool
+	regular bool
+	open    func() (io.ReadCloser, error)
+}
+
+// registerExtractRoutes serves uploads of an archive that is unpacked into
+// the user's files, at the top level or below a folder
+func (h *Handler) registerExtractRoutes(e *echo.Group, write echo.MiddlewareFunc) {
+	e.POST("/extract/:userid", h.extractArchive, write)
+	e.POST("/extract/:userid/*", h.extractArchive, withPath, write)
+}
+
+// extractArchive stores every file of a ZIP, tar or tar.gz body as a file of
+// its own and reports the outcome of each entry. Entries whose path would
+// leave the destination are rejected, and the upload stops once the archive
+// expands beyond the configured size, entry count or compression ratio;
+// files stored until then are kept.
+func (h *Handler) extractArchive(c echo.Context) error {
+	userid := c.Param("userid")
+	folder := c.Param("filename")
+
+	body := bufio.NewReader(c.Request().Body)
+	format := c.QueryParam("format")
+	if format == "" {
+		format = sniffArchive(body)
+	}
+
+	var results []map[string]any
+	var err error
+	switch format {
+	case ARCHIVE_FORMAT_ZIP:
+		results, err = h.extractZip(c, userid, folder, body)
+	case ARCHIVE_FORMAT_TAR, ARCHIVE_FORMAT_TARGZ:
+		results, err = h.extractTar(c, userid, folder, body, format == ARCHIVE_FORMAT_TARGZ)
+	default:
+		err = errUnknownArchiveFmt
+	}
+	if results == nil {
+		results = []map[string]any{}
+	}
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, errUnknownArchiveFmt):
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "body must be a zip, tar or tar.gz archive",
+		})
+	case errors.Is(err, zip.ErrFormat), errors.Is(err, tar.ErrHeader), errors.Is(err, gzip.ErrHeader), errors.Is(err, io.ErrUnexpectedEOF):
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error":   "invalid archive: " + err.Error(),
+			"entries": results,
+		})
+	case errors.Is(err, errExtractTooLarge), errors.Is(err, errExtractRatio), errors.Is(err, errExtractTooMany), errors.As(err, &tooLarge):
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]any{
+			"error":   err.Error(),
+			"entries": results,
+		})
+	case err != nil:
+		log.Printf("failed to extract archive: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error":   "failed to extract archive",
+			"entries": results,
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"entries": results,
+	})
+}
+
+// sniffArchive tells the format of an archive from its first bytes
+func sniffArchive(body *bufio.Reader) string {
+	head, _ := body.Peek(262)
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return ARCHIVE_FORMAT_ZIP
+	case bytes.HasPrefix(head, []byte("\x1f\x8b")):
+		return ARCHIVE_FORMAT_TARGZ
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return ARCHIVE_FORMAT_TAR
+	}
+	return ""
+}
+
+// extractZip spools the body to a temporary file first, as a ZIP lists its
+// entries at its end. Sizes declared by the archive are checked against the
+// limits before anything is stored; the content is still counted as it is
+// read, so an archive lying about them fails too.
+func (h *Handler) extractZip(c echo.Context, userid string, folder string, body io.Reader) ([]map[string]any, error) {
+	spoolDir := filepath.Join(h.cfg.BasePath, ".tmp")
+	if err := os.MkdirAll(spoolDir, 0755); err != nil {
+		return nil, err
+	}
+	spool, err := os.CreateTemp(spoolDir, "extract-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	src := body
+	if h.cfg.ExtractMaxBytes > 0 {
+		src = io.LimitReader(body, h.cfg.ExtractMaxBytes+1)
+	}
+	size, err := io.Copy(spool, src)
+	if err != nil {
+		return nil, err
+	}
+	if h.cfg.ExtractMaxBytes > 0 && size > h.cfg.ExtractMaxBytes {
+		return nil, errExtractTooLarge
+	}
+
+	archive, err := zip.NewReader(spool, size)
+	if err != nil {
+		return nil, err
+	}
+	if h.cfg.ExtractMaxEntries > 0 && len(archive.File) > h.cfg.ExtractMaxEntries {
+		return nil, errExtractTooMany
+	}
+	var declared uint64
+	for _, file := range archive.File {
+		declared += file.UncompressedSize64
+	}
+	if err := h.checkExpansion(int64(min(declared, 1<<62)), size); err != nil {
+		return nil, err
+	}
+
+	i := 0
+	return h.extractEntries(c, userid, folder, func() (archiveEntry, error) {
+		if i == len(archive.File) {
+			return archiveEntry{}, io.EOF
+		}
+		file := archive.File[i]
+		i++
+		mode := file.Mode()
+		return archiveEntry{
+			name:    file.Name,
+			dir:     mode.IsDir(),
+			regular: mode.IsRegular(),
+			open:    file.Open,
+		}, nil
+	}, func(expanded int64) error {
+		return h.checkExpansion(expanded, size)
+	})
+}
+
+// extractTar reads a tar archive, compressed with gzip or not, as it arrives
+func (h *Handler) extractTar(c echo.Context, userid string, folder string, body io.Reader, compressed bool) ([]map[string]any, error) {
+	counted := &countingReader{src: body}
+	var src io.Reader = counted
+	if compressed {
+		decompressed, err := gzip.NewReader(counted)
+		if err != nil {
+			return nil, err
+		}
+		defer decompressed.Close()
+		src = decompressed
+	}
+	archive := tar.NewReader(src)
+
+	entries := 0
+	return h.extractEntries(c, userid, folder, func() (archiveEntry, error) {
+		header, err := archive.Next()
+		if err != nil {
+			return archiveEntry{}, err
+		}
+		entries++
+		if h.cfg.ExtractMaxEntries > 0 && entries > h.cfg.ExtractMaxEntries {
+			return archiveEntry{}, errExtractTooMany
+		}
+		return archiveEntry{
+			name:    header.Name,
+			dir:     header.Typeflag == tar.TypeDir,
+			regular: header.Typeflag == tar.TypeReg,
+			open: func() (io.ReadCloser, error) {
+				return io.NopCloser(archive), nil
+			},
+		}, nil
+	}, func(expanded int64) error {
+		return h.checkExpansion(expanded, counted.read)
+	})
+}
+
+// checkExpansion fails when an archive of size bytes expanding to expanded
+// bytes exceeds the size or ratio limit
+func (h *Handler) checkExpansion(expanded int64, size int64) error {
+	if h.cfg.ExtractMaxBytes > 0 && expanded > h.cfg.ExtractMaxBytes {
+		return errExtractTooLarge
+	}
+	if h.cfg.ExtractMaxRatio > 0 && expanded > EXTRACT_RATIO_GRACE && expanded > h.cfg.ExtractMaxRatio*size {
+		return errExtractRatio
+	}
+	return nil
+}
+
+// extractEntries stores the entries next returns until io.EOF. check is
+// given the bytes of content read so far, as they are read.
+func (h *Handler) extractEntries(c echo.Context, userid string, folder string, next func() (archiveEntry, error), check func(expanded int64) error) ([]map[string]any, error) {
+	ctx := c.Request().Context()
+	var results []map[string]any
+	var expanded int64
+	for {
+		entry, err := next()
+		if err == io.EOF {
+			return results, nil
+		}
+		if err != nil {
+			return results, err
+		}
+
+		result := map[string]any{"name": entry.name}
+		results = append(results, result)
+		filename, err := entryPath(folder, entry.name)
+		if err != nil {
+			result["status"] = ENTRY_REJECTED
+			result["error"] = "invalid path"
+			continue
+		}
+		result["fileName"] = filename
+
+		if entry.dir {
+			err := h.checkParents(ctx, userid, filename)
+			if err == nil {
+				_, _, err = h.folders.Create(ctx, userid, filename)
+			}
+			if err != nil {
+				result["status"] = ENTRY_FAILED
+				result["error"] = entryError(err)
+				continue
+			}
+			result["status"] = ENTRY_FOLDER
+			continue
+		}
+		if !entry.regular {
+			result["status"] = ENTRY_SKIPPED
+			result["error"] = "not a regular file"
+			continue
+		}
+
+		content, err := entry.open()
+		if err != nil {
+			return results, err
+		}
+		guarded := &expansionReader{src: content, read: expanded, check: check}
+		metadata, exists, err := h.storeUpload(ctx, userid, author(c, userid), filename, nil, guarded)
+		content.Close()
+		expanded = guarded.read
+		// a limit ends the whole upload, other failures only their entry
+		if errors.Is(err, errExtractTooLarge) || errors.Is(err, errExtractRatio) || errors.Is(err, zip.ErrFormat) ||
+			errors.Is(err, zip.ErrChecksum) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, gzip.ErrChecksum) {
+			result["status"] = ENTRY_FAILED
+			result["error"] = err.Error()
+			return results, err
+		}
+		if err != nil {
+			result["status"] = ENTRY_FAILED
+			result["error"] = entryError(err)
+			continue
+		}
+
+		result["status"] = ENTRY_STORED
+		result["fileId"] = metadata.FileId
+		result["size"] = metadata.Size
+		result["md5Hash"] = metadata.MD5Hash
+		result["sha256Hash"] = metadata.SHA256Hash
+		result["exists"] = exists
+		result["url"] = h.fileURL(userid, filename)
+	}
+}
+
+// entryPath is where an archive entry is stored: its name below folder, when
+// that is a clean path. Names are not normalized beyond a leading "./" and
+// the trailing "/" of directories, so anything escaping the destination,
+// such as "../x", "/etc/x" or "a\\..\\x", is refused.
+func entryPath(folder string, name string) (string, error) {
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "./"), "/")
+	if _, err := cleanPath(name); err != nil {
+		return "", err
+	}
+	if folder != "" {
+		name = folder + "/" + name
+	}
+	return cleanPath(name)
+}
+
+// entryError describes why an entry could not be stored
+func entryError(err error) string {
+	switch {
+	case errors.Is(err, services.ErrQuotaExceeded):
+		return "quota exceeded"
+	case errors.Is(err, repositories.ErrPathTaken):
+		return "a file or folder already exists at this path"
+	}
+	log.Printf("failed to extract entry: %v", err)
+	return "failed to store file"
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	src  io.Reader
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+// expansionReader hands the running total of content read to check, and
+// fails with its error
+type expansionReader struct {
+	src   io.Reader
+	read  int64
+	check func(expanded int64) error
+}
+
+func (r *expansionReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	r.read += int64(n)
+	if checkErr := r.check(r.read); checkErr != nil {
+		return n, checkErr
+	}
+	return n, err
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type extractResponse struct {
+	Error   string `json:"error"`
+	Entries []struct {
+		Name     string `json:"name"`
+		FileName string `json:"fileName"`
+		Status   string `json:"status"`
+		Size     int64  `json:"size"`
+	} `json:"entries"`
+}
+
+// zipOf builds a ZIP archive of the given names and contents; names ending
+// in "/" are directories
+func zipOf(t *testing.T, entries ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := archive.Create(entry[0])
+		if err != nil {
+			t.Fatalf("failed to create entry: %v", err)
+		}
+		w.Write([]byte(entry[1]))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("failed to write zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractArchive(t *testing.T) {
+	e, cfg := newTestServer(t)
+
+	extract := func(target string, body []byte) (int, extractResponse) {
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var result extractResponse
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return rec.Code, result
+	}
+
+	t.Run("zip", func(t *testing.T) {
+		body := zipOf(t,
+			[2]string{"site/", ""},
+			[2]string{"site/index.html", "<html>"},
+			[2]string{"./site/css/main.css", "body {}"},
+			[2]string{"../escape.txt", "evil"},
+			[2]string{"/etc/passwd", "evil"},
+			[2]string{`site\..\..\win.txt`, "evil"},
+		)
+		code, result := extract("/api/extract/alice", body)
+		if code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %+v", code, result)
+		}
+		statuses := []string{}
+		for _, entry := range result.Entries {
+			statuses = append(statuses, entry.FileName+":"+entry.Status)
+		}
+		want := "site:folder,site/index.html:stored,site/css/main.css:stored,:rejected,:rejected,:rejected"
+		if strings.Join(statuses, ",") != want {
+			t.Fatalf("expected %v, got %v", want, statuses)
+		}
+		if code, body := downloadContent(e, "alice", "site/css/main.css"); code != http.StatusOK || body != "body {}" {
+			t.Fatalf("expected the extracted file, got %d %q", code, body)
+		}
+	})
+
+	t.Run("tar.gz into a folder", func(t *testing.T) {
+		var buf bytes.Buffer
+		compressed := gzip.NewWriter(&buf)
+		archive := tar.NewWriter(compressed)
+		archive.WriteHeader(&tar.Header{Name: "logo.svg", Typeflag: tar.TypeReg, Size: 5, Mode: 0644})
+		archive.Write([]byte("<svg>"))
+		archive.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+		archive.Close()
+		compressed.Close()
+
+		code, result := extract("/api/extract/alice/assets", buf.Bytes())
+		if code != http.StatusOK || len(result.Entries) != 2 {
+			t.Fatalf("expected 2 entries, got %d: %+v", code, result)
+		}
+		if result.Entries[0].FileName != "assets/logo.svg" || result.Entries[0].Status != ENTRY_STORED || result.Entries[0].Size != 5 {
+			t.Fatalf("unexpected entry %+v", result.Entries[0])
+		}
+		if result.Entries[1].Status != ENTRY_SKIPPED {
+			t.Fatalf("expected the symlink to be skipped, got %+v", result.Entries[1])
+		}
+		if code, _ := downloadContent(e, "alice", "assets/logo.svg"); code != http.StatusOK {
+			t.Fatalf("expected the extracted file, got %d", code)
+		}
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		defer func() { cfg.ExtractMaxBytes, cfg.ExtractMaxEntries, cfg.ExtractMaxRatio = 0, 0, 0 }()
+
+		// 4 MiB of zeros compresses to a few KiB
+		bomb := zipOf(t, [2]string{"zeros.bin", strings.Repeat("\x00", 4<<20)})
+		cfg.ExtractMaxRatio = 100
+		if code, result := extract("/api/extract/alice", bomb); code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected 413 for a zip bomb, got %d: %+v", code, result)
+		}
+
+		// a tar.gz is only checked as it expands
+		var buf bytes.Buffer
+		compressed := gzip.NewWriter(&buf)
+		archive := tar.NewWriter(compressed)
+		archive.WriteHeader(&tar.Header{Name: "zeros.bin", Typeflag: tar.TypeReg, Size: 4 << 20, Mode: 0644})
+		archive.Write(make([]byte, 4<<20))
+		archive.Close()
+		compressed.Close()
+		if code, result := extract("/api/extract/alice", buf.Bytes()); code != http.StatusRequestEntityTooLarge || result.Entries[0].Status != ENTRY_FAILED {
+			t.Fatalf("expected 413 for a tar.gz bomb, got %d: %+v", code, result)
+		}
+		cfg.ExtractMaxRatio = 0
+
+		cfg.ExtractMaxBytes = 1 << 20
+		if code, _ := extract("/api/extract/alice", bomb); code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected 413 over the size limit, got %d", code)
+		}
+		cfg.ExtractMaxBytes = 0
+
+		cfg.ExtractMaxEntries = 1
+		if code, _ := extract("/api/extract/alice", zipOf(t, [2]string{"a", "a"}, [2]string{"b", "b"})); code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected 413 over the entry limit, got %d", code)
+		}
+		if code, _ := downloadContent(e, "alice", "zeros.bin"); code != http.StatusNotFound {
+			t.Fatalf("expected nothing of refused archives to be stored, got %d", code)
+		}
+	})
+
+	t.Run("not an archive", func(t *testing.T) {
+		if code, _ := extract("/api/extract/alice", []byte("plain text")); code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", code)
+		}
+		if code, _ := extract("/api/extract/alice?format=tar.gz", []byte("plain text")); code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", code)
+		}
+	})
+}
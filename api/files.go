@@ -0,0 +1,203 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+func (h *Handler) registerFileRoutes(e *echo.Group) {
+	e.GET("/files/:username", h.listFiles)
+}
+
+// fileResponse is how a stored file is described to clients
+func (h *Handler) fileResponse(metadata models.FileMetadata) map[string]any {
+	var lastAccessedAt any
+	if !metadata.LastAccessedAt.IsZero() {
+		lastAccessedAt = metadata.LastAccessedAt.UTC().Format(time.RFC3339Nano)
+	}
+	properties := metadata.Properties
+	if properties == nil {
+		properties = map[string]string{}
+	}
+	return map[string]any{
+		"fileId":      metadata.FileId,
+		"fileName":    metadata.FileName,
+		"size":        metadata.Size,
+		"md5Hash":     metadata.MD5Hash,
+		"sha256Hash":  metadata.SHA256Hash,
+		"contentType": metadata.ContentType,
+		"versionId":   metadata.VersionId,
+		"author":      metadata.Author,
+		"properties":  properties,
+		"createdAt":   metadata.CreatedAt.UTC().Format(time.RFC3339Nano),
+		"updatedAt":   metadata.UpdatedAt.UTC().Format(time.RFC3339Nano),
+		// null until the file is first downloaded
+		"lastAccessedAt": lastAccessedAt,
+		"url":            h.fileURL(metadata.Owner, metadata.FileName),
+	}
+}
+
+// listFiles pages through a user's files. The query accepts sort (name, size
+// or date), order (asc or desc), prefix, glob, limit and the cursor returned
+// as nextCursor by the previous page.
+func (h *Handler) listFiles(c echo.Context) error {
+	opts := repositories.ListOptions{
+		Owner:  c.Param("username"),
+		Prefix: c.QueryParam("prefix"),
+		Glob:   c.QueryParam("glob"),
+		SortBy: c.QueryParam("sort"),
+		Cursor: c.QueryParam("cursor"),
+	}
+
+	switch opts.SortBy {
+	case "", repositories.SORT_BY_NAME, repositories.SORT_BY_SIZE, repositories.SORT_BY_DATE:
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "sort must be one of name, size or date",
+		})
+	}
+
+	switch c.QueryParam("order") {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "order must be asc or desc",
+		})
+	}
+
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid limit",
+			})
+		}
+		opts.Limit = n
+	}
+
+	files, next, err := h.meta.ListMetadata(c.Request().Context(), opts)
+	if errors.Is(err, repositories.ErrInvalidCursor) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid cursor",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to list files: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to list files",
+		})
+	}
+
+	response := make([]map[string]any, 0, len(files))
+	for _, file := range files {
+		response = append(response, h.fileResponse(file))
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"files":      response,
+		"nextCursor": next,
+	})
+}
+
+// updateFile replaces a file's content only if it is still the version the
+// client knows, given by If-Match with the ETag of a previous download, or
+// creates it only if it does not exist yet, given If-None-Match: *. Either
+// keeps concurrent writers from silently overwriting each other.
+func (h *Handler) updateFile(c echo.Context) error {
+	ctx := c.Request().Context()
+	username := c.Param("username")
+	filename := c.Param("filename")
+
+	ifMatch := c.Request().Header.Get("If-Match")
+	ifNoneMatch := c.Request().Header.Get("If-None-Match")
+	if ifNoneMatch != "" && ifNoneMatch != "*" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "If-None-Match only supports *",
+		})
+	}
+	if ifMatch == "" && ifNoneMatch == "" {
+		return c.JSON(http.StatusPreconditionRequired, map[string]string{
+			"error": "If-Match or If-None-Match: * is required",
+		})
+	}
+
+	// the precondition must still hold when the new content is recorded
+	unlock := h.locks.Lock(username, filename)
+	defer unlock()
+
+	current, err := h.meta.GetMetadataByName(ctx, username, filename)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("failed to load metadata: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to update file",
+		})
+	}
+	found := err == nil
+
+	if found {
+		if etag := contentETag(current); etag != "" {
+			c.Response().Header().Set("ETag", etag)
+		}
+	}
+	if ifNoneMatch == "*" && found {
+		return c.JSON(http.StatusPreconditionFailed, map[string]string{
+			"error": "file already exists",
+		})
+	}
+	if ifMatch != "" && (!found || !etagMatches(ifMatch, contentETag(current))) {
+		return c.JSON(http.StatusPreconditionFailed, map[string]string{
+			"error": "file was changed",
+		})
+	}
+
+	err = h.checkQuota(ctx, username, filename, c.Request().ContentLength)
+	var metadata models.FileMetadata
+	if err == nil {
+		metadata, _, err = h.writeFile(ctx, username, author(c, username), filename, nil, c.Request().Body)
+	}
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		return quotaExceeded(c)
+	}
+	if errors.Is(err, repositories.ErrPathTaken) {
+		return pathTaken(c)
+	}
+	if err != nil {
+		log.Printf("failed to update file: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to update file",
+		})
+	}
+
+	status := http.StatusOK
+	if !found {
+		status = http.StatusCreated
+	}
+	c.Response().Header().Set("ETag", contentETag(metadata))
+	return c.JSON(status, h.fileResponse(metadata))
+}
+
+// etagMatches compares the ETags listed in an If-Match header with etag.
+// Comparison is strong, so weak ETags never match; "*" matches any file.
+func etagMatches(header string, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate != "" && !strings.HasPrefix(candidate, "W/") && candidate == etag {
+			return true
+		}
+	}
+	return false
+}
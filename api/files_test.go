@@ -0,0 +1,207 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func uploadContent(t *testing.T, e *echo.Echo, username string, filename string, content string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/upload/"+username+"/"+filename, strings.NewReader(content))
+	authorize(req, username)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("failed to upload %v: %d %s", filename, rec.Code, rec.Body.String())
+	}
+}
+
+type listFilesResponse struct {
+	Files []struct {
+		FileName    string `json:"fileName"`
+		Size        int64  `json:"size"`
+		SHA256Hash  string `json:"sha256Hash"`
+		ContentType string `json:"contentType"`
+		CreatedAt   string `json:"createdAt"`
+		// LastAccessedAt is null until the first download
+		LastAccessedAt *string `json:"lastAccessedAt"`
+	} `json:"files"`
+	NextCursor string `json:"nextCursor"`
+}
+
+func listFiles(t *testing.T, e *echo.Echo, username string, query url.Values) (int, listFilesResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/files/"+username+"?"+query.Encode(), nil)
+	authorize(req, username)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var result listFilesResponse
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	return rec.Code, result
+}
+
+func TestListFiles(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	uploadContent(t, e, "alice", "notes.txt", "some notes")
+	uploadContent(t, e, "alice", "photo.png", "\x89PNG\r\n\x1a\n")
+	uploadContent(t, e, "alice", "report", "%PDF-1.4 report")
+	uploadContent(t, e, "bob", "other.txt", "not alice's")
+
+	code, page := listFiles(t, e, "alice", url.Values{"sort": {"size"}, "order": {"desc"}})
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if len(page.Files) != 3 || page.NextCursor != "" {
+		t.Fatalf("expected all of alice's files on one page, got %+v", page)
+	}
+	expected := []struct {
+		name        string
+		size        int64
+		contentType string
+	}{
+		{"report", 15, "application/pdf"},
+		{"notes.txt", 10, "text/plain; charset=utf-8"},
+		{"photo.png", 8, "image/png"},
+	}
+	for i, want := range expected {
+		got := page.Files[i]
+		if got.FileName != want.name || got.Size != want.size || got.ContentType != want.contentType {
+			t.Fatalf("expected %+v at %d, got %+v", want, i, got)
+		}
+		if got.SHA256Hash == "" || got.CreatedAt == "" {
+			t.Fatalf("expected hash and timestamps, got %+v", got)
+		}
+	}
+
+	t.Run("pagination", func(t *testing.T) {
+		var names []string
+		query := url.Values{"limit": {"2"}}
+		for {
+			code, page := listFiles(t, e, "alice", query)
+			if code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", code)
+			}
+			for _, file := range page.Files {
+				names = append(names, file.FileName)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			query.Set("cursor", page.NextCursor)
+		}
+		if strings.Join(names, ",") != "notes.txt,photo.png,report" {
+			t.Fatalf("unexpected listing %v", names)
+		}
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		_, page := listFiles(t, e, "alice", url.Values{"glob": {"*.png"}})
+		if len(page.Files) != 1 || page.Files[0].FileName != "photo.png" {
+			t.Fatalf("expected only photo.png, got %+v", page.Files)
+		}
+		_, page = listFiles(t, e, "alice", url.Values{"prefix": {"no"}})
+		if len(page.Files) != 1 || page.Files[0].FileName != "notes.txt" {
+			t.Fatalf("expected only notes.txt, got %+v", page.Files)
+		}
+	})
+
+	t.Run("last accessed", func(t *testing.T) {
+		_, page := listFiles(t, e, "alice", url.Values{"prefix": {"notes"}})
+		if page.Files[0].LastAccessedAt != nil {
+			t.Fatalf("expected no access yet, got %v", *page.Files[0].LastAccessedAt)
+		}
+		if code, _ := downloadContent(e, "alice", "notes.txt"); code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", code)
+		}
+		_, page = listFiles(t, e, "alice", url.Values{"prefix": {"notes"}})
+		if page.Files[0].LastAccessedAt == nil {
+			t.Fatal("expected the download to be recorded")
+		}
+	})
+
+	t.Run("bad request", func(t *testing.T) {
+		for _, query := range []url.Values{
+			{"sort": {"color"}},
+			{"order": {"sideways"}},
+			{"limit": {"0"}},
+			{"cursor": {"garbage"}},
+		} {
+			if code, _ := listFiles(t, e, "alice", query); code != http.StatusBadRequest {
+				t.Fatalf("expected 400 for %v, got %d", query, code)
+			}
+		}
+	})
+}
+
+func TestUpdateFile(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	put := func(content string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/files/alice/doc.txt", strings.NewReader(content))
+		authorize(req, "alice")
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := put("v1", nil); rec.Code != http.StatusPreconditionRequired {
+		t.Fatalf("expected 428 without a precondition, got %d", rec.Code)
+	}
+	if rec := put("v1", map[string]string{"If-Match": `"anything"`}); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for a missing file, got %d", rec.Code)
+	}
+
+	rec := put("v1", map[string]string{"If-None-Match": "*"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	v1 := rec.Header().Get("ETag")
+
+	if rec := put("again", map[string]string{"If-None-Match": "*"}); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected create-only to fail on an existing file, got %d", rec.Code)
+	}
+
+	rec = put("v2", map[string]string{"If-Match": v1})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	v2 := rec.Header().Get("ETag")
+	if v2 == v1 {
+		t.Fatal("expected the ETag to change with the content")
+	}
+
+	t.Run("stale ETag loses", func(t *testing.T) {
+		rec := put("v3", map[string]string{"If-Match": v1})
+		if rec.Code != http.StatusPreconditionFailed {
+			t.Fatalf("expected 412, got %d", rec.Code)
+		}
+		if rec.Header().Get("ETag") != v2 {
+			t.Fatalf("expected the current ETag %s, got %s", v2, rec.Header().Get("ETag"))
+		}
+		if code, content := downloadContent(e, "alice", "doc.txt"); code != http.StatusOK || content != "v2" {
+			t.Fatalf("expected v2 to be kept, got %d %q", code, content)
+		}
+	})
+
+	t.Run("weak ETags never match", func(t *testing.T) {
+		if rec := put("v3", map[string]string{"If-Match": "W/" + v2}); rec.Code != http.StatusPreconditionFailed {
+			t.Fatalf("expected 412, got %d", rec.Code)
+		}
+	})
+
+	t.Run("any of several ETags", func(t *testing.T) {
+		if rec := put("v3", map[string]string{"If-Match": v1 + ", " + v2}); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+	})
+}
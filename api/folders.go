@@ -0,0 +1,370 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type moveFolderRequest struct {
+	// Name renames the folder, keeping it in its parent
+	Name *string `json:"name"`
+	// Parent moves the folder into another one, "" for the top level
+	Parent *string `json:"parent"`
+}
+
+// registerFolderRoutes serves the folders of a user, which only the user can
+// manage. Deleting a folder needs the delete scope.
+func (h *Handler) registerFolderRoutes(e *echo.Group, read echo.MiddlewareFunc, write echo.MiddlewareFunc, remove echo.MiddlewareFunc) {
+	e.GET("/folders/:username", h.listFolder, read)
+	e.GET("/folders/:username/*", h.listFolder, withPath, read)
+	e.POST("/folders/:username/*", h.createFolder, withPath, write)
+	e.PATCH("/folders/:username/*", h.moveFolder, withPath, write)
+	e.DELETE("/folders/:username/*", h.deleteFolder, withPath, remove)
+}
+
+func folderResponse(folder models.Folder) map[string]any {
+	return map[string]any{
+		"path":      folder.Path,
+		"name":      folder.Name(),
+		"createdAt": folder.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+func pathTaken(c echo.Context) error {
+	return c.JSON(http.StatusConflict, map[string]string{
+		"error": "a file or folder already exists at this path",
+	})
+}
+
+// claimPath makes sure a file can be stored at path: no folder may exist
+// there and none of its parents may be a file. The missing parents are
+// created.
+func (h *Handler) claimPath(ctx context.Context, owner string, path string) error {
+	_, err := h.folders.Get(ctx, owner, path)
+	if err == nil {
+		return repositories.ErrPathTaken
+	}
+	if !errors.Is(err, services.ErrFolderNotFound) {
+		return err
+	}
+	if err := h.checkParents(ctx, owner, path); err != nil {
+		return err
+	}
+	return h.folders.EnsureParents(ctx, owner, path)
+}
+
+// checkParents fails with repositories.ErrPathTaken when a folder containing
+// path is taken by a file
+func (h *Handler) checkParents(ctx context.Context, owner string, path string) error {
+	for _, parent := range models.ParentFolders(path) {
+		_, err := h.meta.GetMetadataByName(ctx, owner, parent)
+		if err == nil {
+			return repositories.ErrPathTaken
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+	}
+	return nil
+}
+
+// createFolder creates a folder and any missing parents, answering 201 when
+// it is new and 200 when it already existed
+func (h *Handler) createFolder(c echo.Context) error {
+	ctx := c.Request().Context()
+	username := c.Param("username")
+	path := c.Param("filename")
+
+	_, err := h.meta.GetMetadataByName(ctx, username, path)
+	if err == nil {
+		return pathTaken(c)
+	}
+	if err == sql.ErrNoRows {
+		err = h.checkParents(ctx, username, path)
+	}
+	var folder models.Folder
+	created := false
+	if err == nil {
+		folder, created, err = h.folders.Create(ctx, username, path)
+	}
+	if errors.Is(err, repositories.ErrPathTaken) {
+		return pathTaken(c)
+	}
+	if err != nil {
+		log.Printf("failed to create folder: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to create folder",
+		})
+	}
+
+	if created {
+		return c.JSON(http.StatusCreated, folderResponse(folder))
+	}
+	return c.JSON(http.StatusOK, folderResponse(folder))
+}
+
+// listFolder lists the folders and files directly inside a folder, or at the
+// top level. Files are paged with limit and cursor like listFiles.
+func (h *Handler) listFolder(c echo.Context) error {
+	ctx := c.Request().Context()
+	username := c.Param("username")
+	path := c.Param("filename")
+
+	if path != "" {
+		_, err := h.folders.Get(ctx, username, path)
+		if errors.Is(err, services.ErrFolderNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "folder not found",
+			})
+		}
+		if err != nil {
+			log.Printf("failed to load folder: %v", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to list folder",
+			})
+		}
+	}
+
+	opts := repositories.ListOptions{
+		Owner:   username,
+		Shallow: true,
+		Cursor:  c.QueryParam("cursor"),
+	}
+	if path != "" {
+		opts.Prefix = path + "/"
+	}
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid limit",
+			})
+		}
+		opts.Limit = n
+	}
+
+	folders, err := h.folders.List(ctx, username, path)
+	if err != nil {
+		log.Printf("failed to list folders: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to list folder",
+		})
+	}
+	files, next, err := h.meta.ListMetadata(ctx, opts)
+	if errors.Is(err, repositories.ErrInvalidCursor) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid cursor",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to list files: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to list folder",
+		})
+	}
+
+	folderList := make([]map[string]any, 0, len(folders))
+	for _, folder := range folders {
+		folderList = append(folderList, folderResponse(folder))
+	}
+	fileList := make([]map[string]any, 0, len(files))
+	for _, file := range files {
+		fileList = append(fileList, h.fileResponse(file))
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"path":       path,
+		"folders":    folderList,
+		"files":      fileList,
+		"nextCursor": next,
+	})
+}
+
+// moveFolder renames a folder, moves it into another one, or both, together
+// with everything in it
+func (h *Handler) moveFolder(c echo.Context) error {
+	ctx := c.Request().Context()
+	username := c.Param("username")
+	from := c.Param("filename")
+
+	var req moveFolderRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+	if req.Name == nil && req.Parent == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "name or parent is required",
+		})
+	}
+
+	name := from[strings.LastIndex(from, "/")+1:]
+	parent := strings.TrimSuffix(strings.TrimSuffix(from, name), "/")
+	if req.Name != nil {
+		if _, err := cleanPath(*req.Name); err != nil || strings.Contains(*req.Name, "/") {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid name",
+			})
+		}
+		name = *req.Name
+	}
+	if req.Parent != nil {
+		parent = *req.Parent
+		if _, err := cleanPath(parent); parent != "" && err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid parent",
+			})
+		}
+	}
+	to := name
+	if parent != "" {
+		to = parent + "/" + name
+	}
+	if strings.HasPrefix(to+"/", from+"/") {
+		if to == from {
+			folder, err := h.folders.Get(ctx, username, from)
+			if err == nil {
+				return c.JSON(http.StatusOK, folderResponse(folder))
+			}
+		} else {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "a folder cannot be moved into itself",
+			})
+		}
+	}
+
+	_, err := h.folders.Get(ctx, username, from)
+	if err == nil {
+		err = h.checkParents(ctx, username, to)
+	}
+	if err == nil {
+		err = h.folders.Move(ctx, username, from, to)
+	}
+	var folder models.Folder
+	if err == nil {
+		folder, err = h.folders.Get(ctx, username, to)
+	}
+	switch {
+	case errors.Is(err, services.ErrFolderNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "folder not found",
+		})
+	case errors.Is(err, repositories.ErrPathTaken):
+		return pathTaken(c)
+	case err != nil:
+		log.Printf("failed to move folder: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to move folder",
+		})
+	}
+	return c.JSON(http.StatusOK, folderResponse(folder))
+}
+
+// deleteFolder deletes an empty folder, or with recursive=true a folder and
+// everything in it, moving its files into the trash. dryRun=true only
+// reports what would be deleted.
+func (h *Handler) deleteFolder(c echo.Context) error {
+	ctx := c.Request().Context()
+	username := c.Param("username")
+	path := c.Param("filename")
+	recursive := c.QueryParam("recursive") == "true"
+	dryRun := c.QueryParam("dryRun") == "true"
+
+	folders, files, err := h.folderContents(ctx, username, path)
+	if errors.Is(err, services.ErrFolderNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "folder not found",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to list folder: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to delete folder",
+		})
+	}
+	if !recursive && (len(folders) > 1 || len(files) > 0) {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "folder is not empty, delete it with recursive=true",
+		})
+	}
+
+	folderPaths := make([]string, 0, len(folders))
+	for _, folder := range folders {
+		folderPaths = append(folderPaths, folder.Path)
+	}
+	filePaths := make([]string, 0, len(files))
+	for _, file := range files {
+		filePaths = append(filePaths, file.FileName)
+	}
+	response := map[string]any{
+		"dryRun":  dryRun,
+		"folders": folderPaths,
+		"files":   filePaths,
+	}
+	if dryRun {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	uploader, err := h.newUploader(username)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to delete folder",
+		})
+	}
+	uploader.Author = author(c, username)
+	for _, file := range files {
+		unlock := h.locks.Lock(username, file.FileName)
+		_, err := uploader.TrashFile(ctx, file.FileName)
+		unlock()
+		if err != nil {
+			log.Printf("failed to delete %v: %v", file.FileName, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to delete folder",
+			})
+		}
+	}
+	if err := h.folders.DeleteTree(ctx, username, path); err != nil {
+		log.Printf("failed to delete folder: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to delete folder",
+		})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// folderContents returns the folder at path with every folder and file
+// below it
+func (h *Handler) folderContents(ctx context.Context, owner string, path string) ([]models.Folder, []models.FileMetadata, error) {
+	if _, err := h.folders.Get(ctx, owner, path); err != nil {
+		return nil, nil, err
+	}
+	folders, err := h.folders.Tree(ctx, owner, path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files []models.FileMetadata
+	opts := repositories.ListOptions{Owner: owner, Prefix: path + "/", Limit: services.MAX_LIST_LIMIT}
+	for {
+		page, next, err := h.meta.ListMetadata(ctx, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, page...)
+		if next == "" {
+			return folders, files, nil
+		}
+		opts.Cursor = next
+	}
+}
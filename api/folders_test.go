@@ -0,0 +1,191 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+type folderListResponse struct {
+	Path    string `json:"path"`
+	Folders []struct {
+		Path string `json:"path"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Files []struct {
+		FileName string `json:"fileName"`
+	} `json:"files"`
+}
+
+func TestFolders(t *testing.T) {
+	e, _ := newTestServer(t)
+	uploadContent(t, e, "alice", "docs/2024/report.pdf", "report")
+	uploadContent(t, e, "alice", "docs/readme.txt", "readme")
+	uploadContent(t, e, "alice", "top.txt", "top")
+
+	request := func(method string, target string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	list := func(target string) folderListResponse {
+		t.Helper()
+		rec := request(http.MethodGet, target, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result folderListResponse
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return result
+	}
+
+	t.Run("nested files", func(t *testing.T) {
+		if code, body := downloadContent(e, "alice", "docs/2024/report.pdf"); code != http.StatusOK || body != "report" {
+			t.Fatalf("expected the nested file, got %d %q", code, body)
+		}
+
+		root := list("/api/folders/alice")
+		if len(root.Folders) != 1 || root.Folders[0].Path != "docs" {
+			t.Fatalf("expected the docs folder, got %+v", root.Folders)
+		}
+		if len(root.Files) != 1 || root.Files[0].FileName != "top.txt" {
+			t.Fatalf("expected only top.txt at the top level, got %+v", root.Files)
+		}
+
+		docs := list("/api/folders/alice/docs")
+		if len(docs.Folders) != 1 || docs.Folders[0].Name != "2024" {
+			t.Fatalf("expected docs/2024, got %+v", docs.Folders)
+		}
+		if len(docs.Files) != 1 || docs.Files[0].FileName != "docs/readme.txt" {
+			t.Fatalf("expected docs/readme.txt, got %+v", docs.Files)
+		}
+
+		if rec := request(http.MethodGet, "/api/folders/alice/missing", ""); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", rec.Code)
+		}
+	})
+
+	t.Run("create folders", func(t *testing.T) {
+		if rec := request(http.MethodPost, "/api/folders/alice/empty/inner", ""); rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := request(http.MethodPost, "/api/folders/alice/empty", ""); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 for an existing folder, got %d", rec.Code)
+		}
+		if rec := request(http.MethodPost, "/api/folders/alice/top.txt/inner", ""); rec.Code != http.StatusConflict {
+			t.Fatalf("expected 409 inside a file, got %d", rec.Code)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/api/upload/alice/empty", strings.NewReader("clash"))
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("expected 409 for a file over a folder, got %d", rec.Code)
+		}
+	})
+
+	t.Run("rename and move", func(t *testing.T) {
+		rec := request(http.MethodPatch, "/api/folders/alice/docs", `{"name": "papers"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if code, body := downloadContent(e, "alice", "papers/2024/report.pdf"); code != http.StatusOK || body != "report" {
+			t.Fatalf("expected the file to move with its folder, got %d %q", code, body)
+		}
+		if code, _ := downloadContent(e, "alice", "docs/2024/report.pdf"); code != http.StatusNotFound {
+			t.Fatalf("expected the old path to be gone, got %d", code)
+		}
+
+		rec = request(http.MethodPatch, "/api/folders/alice/papers/2024", `{"parent": "empty"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if code, _ := downloadContent(e, "alice", "empty/2024/report.pdf"); code != http.StatusOK {
+			t.Fatalf("expected the moved file, got %d", code)
+		}
+
+		for body, want := range map[string]int{
+			`{"parent": "empty/2024"}`: http.StatusBadRequest,
+			`{"name": "a/b"}`:          http.StatusBadRequest,
+			`{}`:                       http.StatusBadRequest,
+			`{"name": "papers"}`:       http.StatusConflict,
+		} {
+			if rec := request(http.MethodPatch, "/api/folders/alice/empty", body); rec.Code != want {
+				t.Fatalf("expected %d for %s, got %d", want, body, rec.Code)
+			}
+		}
+	})
+
+	t.Run("delete folders", func(t *testing.T) {
+		if rec := request(http.MethodDelete, "/api/folders/alice/empty", ""); rec.Code != http.StatusConflict {
+			t.Fatalf("expected 409 for a folder that is not empty, got %d", rec.Code)
+		}
+
+		rec := request(http.MethodDelete, "/api/folders/alice/empty?recursive=true&dryRun=true", "")
+		var preview struct {
+			Folders []string `json:"folders"`
+			Files   []string `json:"files"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &preview)
+		if rec.Code != http.StatusOK || len(preview.Folders) != 3 || len(preview.Files) != 1 {
+			t.Fatalf("expected a preview of 3 folders and 1 file, got %d %s", rec.Code, rec.Body.String())
+		}
+		if code, _ := downloadContent(e, "alice", "empty/2024/report.pdf"); code != http.StatusOK {
+			t.Fatalf("expected a dry run to keep the file, got %d", code)
+		}
+
+		if rec := request(http.MethodDelete, "/api/folders/alice/empty?recursive=true", ""); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if code, _ := downloadContent(e, "alice", "empty/2024/report.pdf"); code != http.StatusNotFound {
+			t.Fatalf("expected the file to be deleted, got %d", code)
+		}
+		if rec := request(http.MethodGet, "/api/folders/alice/empty", ""); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected the folder to be deleted, got %d", rec.Code)
+		}
+	})
+
+	t.Run("traversal is rejected", func(t *testing.T) {
+		for _, target := range []string{
+			"/api/download/alice/%2e%2e/bob/secret.txt",
+			"/api/download/alice/docs/..%2F..%2Fbob/secret.txt",
+			"/api/download/alice/docs//readme.txt",
+			"/api/folders/alice/a/%2e",
+		} {
+			if rec := request(http.MethodGet, target, ""); rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400 for %s, got %d", target, rec.Code)
+			}
+		}
+	})
+
+	t.Run("users outside the storage are rejected", func(t *testing.T) {
+		for _, target := range []struct {
+			method string
+			path   string
+		}{
+			{http.MethodGet, "/api/download/../secret.txt"},
+			{http.MethodGet, "/api/download/%2e%2e/secret.txt"},
+			{http.MethodGet, "/api/download/.blobs/secret.txt"},
+			{http.MethodDelete, "/api/delete/../secret.txt"},
+			{http.MethodPost, "/api/upload/.tmp/secret.txt"},
+			{http.MethodGet, "/api/files/.."},
+			{http.MethodGet, "/api/trash/%2e%2e"},
+		} {
+			req := httptest.NewRequest(target.method, target.path, strings.NewReader("content"))
+			authorize(req, "root", "admin")
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400 for %s %s, got %d", target.method, target.path, rec.Code)
+			}
+		}
+	})
+}
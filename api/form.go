@@ -0,0 +1,155 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+// PROPERTY_FIELD_PREFIX marks the form fields that become custom properties
+// of the next file, e.g. "metadata.camera"
+const PROPERTY_FIELD_PREFIX = "metadata."
+
+const (
+	MAX_PROPERTIES       = 32
+	MAX_PROPERTY_KEY_LEN = 128
+	MAX_PROPERTY_LEN     = 1024
+)
+
+// formFile collects the fields that apply to the next file of a form
+type formFile struct {
+	path       string
+	properties map[string]string
+}
+
+// uploadForm stores every file of a multipart/form-data body, as browsers
+// send forms. Parts are streamed to storage as they arrive instead of being
+// parsed into memory or temporary files first. Text fields apply to the file
+// that follows them: "path" sets where it is stored, by default its file
+// name at the top level, and "metadata.<key>" fields become its properties.
+// Files fail on their own, so the result lists the outcome of each.
+func (h *Handler) uploadForm(c echo.Context) error {
+	ctx := c.Request().Context()
+	userid := c.Param("userid")
+
+	reader, err := c.Request().MultipartReader()
+	if err != nil {
+		return c.JSON(http.StatusUnsupportedMediaType, map[string]string{
+			"error": "body must be multipart/form-data",
+		})
+	}
+
+	results := []map[string]any{}
+	next := formFile{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": "invalid form: " + err.Error(),
+				"files": results,
+			})
+		}
+
+		field := part.FormName()
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, max(MAX_PATH_LENGTH, MAX_PROPERTY_LEN)+1))
+			part.Close()
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]any{
+					"error": "invalid form: " + err.Error(),
+					"files": results,
+				})
+			}
+			if err := next.set(field, string(value)); err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]any{
+					"error": err.Error(),
+					"files": results,
+				})
+			}
+			continue
+		}
+
+		filename := next.path
+		if filename == "" {
+			filename = part.FileName()
+		}
+		result := map[string]any{"field": field, "fileName": filename}
+		results = append(results, result)
+		properties := next.properties
+		next = formFile{}
+
+		if _, err := cleanPath(filename); err != nil {
+			part.Close()
+			result["error"] = "invalid path"
+			continue
+		}
+		metadata, exists, err := h.storeUpload(ctx, userid, author(c, userid), filename, properties, part)
+		part.Close()
+		switch {
+		case errors.Is(err, services.ErrQuotaExceeded):
+			result["error"] = "quota exceeded"
+			continue
+		case errors.Is(err, repositories.ErrPathTaken):
+			result["error"] = "a file or folder already exists at this path"
+			continue
+		case err != nil:
+			// a broken body also surfaces at the next part
+			log.Printf("failed to store form file: %v", err)
+			result["error"] = "failed to store file"
+			continue
+		}
+
+		if properties == nil {
+			properties = map[string]string{}
+		}
+		result["fileId"] = metadata.FileId
+		result["md5Hash"] = metadata.MD5Hash
+		result["sha256Hash"] = metadata.SHA256Hash
+		result["size"] = metadata.Size
+		result["exists"] = exists
+		result["url"] = h.fileURL(userid, filename)
+		result["properties"] = properties
+	}
+
+	if len(results) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "form holds no files",
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"files": results,
+	})
+}
+
+// set applies a text field of the form to the next file
+func (f *formFile) set(field string, value string) error {
+	switch {
+	case field == "path":
+		if len(value) > MAX_PATH_LENGTH {
+			return errors.New("path is too long")
+		}
+		f.path = value
+	case strings.HasPrefix(field, PROPERTY_FIELD_PREFIX):
+		key := strings.TrimPrefix(field, PROPERTY_FIELD_PREFIX)
+		if key == "" || len(key) > MAX_PROPERTY_KEY_LEN || len(value) > MAX_PROPERTY_LEN {
+			return errors.New("invalid property " + field)
+		}
+		if f.properties == nil {
+			f.properties = map[string]string{}
+		}
+		f.properties[key] = value
+		if len(f.properties) > MAX_PROPERTIES {
+			return errors.New("too many properties")
+		}
+	}
+	return nil
+}
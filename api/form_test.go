@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+type formUploadResponse struct {
+	Error string `json:"error"`
+	Files []struct {
+		Field      string            `json:"field"`
+		FileName   string            `json:"fileName"`
+		FileId     string            `json:"fileId"`
+		SHA256Hash string            `json:"sha256Hash"`
+		URL        string            `json:"url"`
+		Properties map[string]string `json:"properties"`
+		Error      string            `json:"error"`
+	} `json:"files"`
+}
+
+func TestFormUpload(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	upload := func(build func(form *multipart.Writer)) (int, formUploadResponse) {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		build(form)
+		form.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/upload/alice", &body)
+		req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var result formUploadResponse
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return rec.Code, result
+	}
+	addFile := func(form *multipart.Writer, field string, name string, content string) {
+		w, _ := form.CreateFormFile(field, name)
+		w.Write([]byte(content))
+	}
+
+	t.Run("several files", func(t *testing.T) {
+		code, result := upload(func(form *multipart.Writer) {
+			form.WriteField("path", "photos/beach.jpg")
+			form.WriteField("metadata.camera", "X100")
+			form.WriteField("metadata.album", "summer")
+			addFile(form, "photo", "IMG_0001.jpg", "jpeg bytes")
+			addFile(form, "notes", "notes.txt", "some notes")
+		})
+		if code != http.StatusOK || len(result.Files) != 2 {
+			t.Fatalf("expected 2 files, got %d: %+v", code, result)
+		}
+		photo, notes := result.Files[0], result.Files[1]
+		if photo.Error != "" || photo.FileName != "photos/beach.jpg" || photo.Properties["camera"] != "X100" || photo.Properties["album"] != "summer" {
+			t.Fatalf("unexpected photo result %+v", photo)
+		}
+		if photo.SHA256Hash == "" || photo.URL != "http://localhost/alice/photos/beach.jpg" {
+			t.Fatalf("expected the hash and URL, got %+v", photo)
+		}
+		if notes.Error != "" || notes.FileName != "notes.txt" || len(notes.Properties) != 0 {
+			t.Fatalf("expected the fields to apply to the first file only, got %+v", notes)
+		}
+		if code, body := downloadContent(e, "alice", "photos/beach.jpg"); code != http.StatusOK || body != "jpeg bytes" {
+			t.Fatalf("expected the uploaded file, got %d %q", code, body)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/files/alice?prefix=photos/", nil)
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if !strings.Contains(rec.Body.String(), `"properties":{"album":"summer","camera":"X100"}`) {
+			t.Fatalf("expected the listing to carry the properties, got %s", rec.Body.String())
+		}
+	})
+
+	t.Run("failures are per file", func(t *testing.T) {
+		code, result := upload(func(form *multipart.Writer) {
+			form.WriteField("path", "../escape.txt")
+			addFile(form, "file", "a.txt", "a")
+			form.WriteField("path", "photos")
+			addFile(form, "file", "b.txt", "b")
+			addFile(form, "file", "c.txt", "c")
+		})
+		if code != http.StatusOK || len(result.Files) != 3 {
+			t.Fatalf("expected 3 results, got %d: %+v", code, result)
+		}
+		if result.Files[0].Error != "invalid path" || result.Files[1].Error == "" || result.Files[2].Error != "" {
+			t.Fatalf("unexpected results %+v", result.Files)
+		}
+	})
+
+	t.Run("invalid forms", func(t *testing.T) {
+		if code, _ := upload(func(form *multipart.Writer) { form.WriteField("path", "a.txt") }); code != http.StatusBadRequest {
+			t.Fatalf("expected 400 without files, got %d", code)
+		}
+		if code, _ := upload(func(form *multipart.Writer) {
+			form.WriteField("metadata.note", strings.Repeat("x", MAX_PROPERTY_LEN+1))
+			addFile(form, "file", "a.txt", "a")
+		}); code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for a long property, got %d", code)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/api/upload/alice", strings.NewReader("raw"))
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnsupportedMediaType {
+			t.Fatalf("expected 415, got %d", rec.Code)
+		}
+	})
+}
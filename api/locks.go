@@ -0,0 +1,25 @@
+package api
+
+import "github.com/Iwoooooods/fs-upload-go/internal/keylock"
+
+// fileLocks serializes writes to the same file, so that a precondition
+// checked before storing new content still holds when it is stored
+type fileLocks struct {
+	keys *keylock.Locks
+}
+
+func newFileLocks() *fileLocks {
+	return &fileLocks{keys: keylock.New()}
+}
+
+// Lock blocks until no other write to owner's filename is in progress and
+// returns the function that releases the lock
+func (l *fileLocks) Lock(owner string, filename string) func() {
+	return l.keys.Lock(owner + "/" + filename)
+}
+
+// TryLock is Lock for callers that would rather give up than wait: it
+// reports false without blocking when owner's filename is already locked
+func (l *fileLocks) TryLock(owner string, filename string) (func(), bool) {
+	return l.keys.TryLock(owner + "/" + filename)
+}
@@ -0,0 +1,341 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type completedPart struct {
+	PartNumber int    `json:"partNumber"`
+	ETag       string `json:"etag"`
+}
+
+type completeMultipartRequest struct {
+	Parts []completedPart `json:"parts"`
+}
+
+func (h *Handler) registerMultipartRoutes(e *echo.Group) {
+	e.POST("/multipart/:userid/:filename", h.initiateMultipart)
+	e.GET("/multipart/:userid/:filename/:uploadid", h.listMultipartParts)
+	e.PUT("/multipart/:userid/:filename/:uploadid/:partnumber", h.uploadMultipartPart)
+	e.POST("/multipart/:userid/:filename/:uploadid/complete", h.completeMultipart)
+	e.DELETE("/multipart/:userid/:filename/:uploadid", h.abortMultipart)
+}
+
+// initiateMultipart starts an upload. The filename is a single path segment
+// of the route, so nested paths escape their slashes as "%2F".
+func (h *Handler) initiateMultipart(c echo.Context) error {
+	filename, err := pathParam(c, "filename")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid path",
+		})
+	}
+
+	// a file that cannot be stored is refused before any part is staged
+	err = h.checkQuota(c.Request().Context(), c.Param("userid"), filename, 0)
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		return quotaExceeded(c)
+	}
+	var upload models.MultipartUpload
+	if err == nil {
+		upload, err = h.multipart.Initiate(c.Request().Context(), c.Param("userid"), filename)
+	}
+	if err != nil {
+		log.Printf("failed to initiate multipart upload: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to initiate multipart upload",
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"uploadId": upload.UploadId,
+		"fileName": upload.FileName,
+	})
+}
+
+func (h *Handler) listMultipartParts(c echo.Context) error {
+	upload, status := h.loadMultipartUpload(c)
+	if status != 0 {
+		return multipartUploadError(c, status)
+	}
+
+	parts, err := h.multipart.ListParts(c.Request().Context(), upload.UploadId)
+	if err != nil {
+		log.Printf("failed to list parts: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to list parts",
+		})
+	}
+
+	result := make([]map[string]any, 0, len(parts))
+	for _, part := range parts {
+		result = append(result, map[string]any{
+			"partNumber": part.PartNumber,
+			"etag":       part.MD5Hash,
+			"size":       part.Size,
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"uploadId": upload.UploadId,
+		"parts":    result,
+	})
+}
+
+func (h *Handler) uploadMultipartPart(c echo.Context) error {
+	upload, status := h.loadMultipartUpload(c)
+	if status != 0 {
+		return multipartUploadError(c, status)
+	}
+
+	partNumber, err := strconv.Atoi(c.Param("partnumber"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": services.ErrInvalidPartNumber.Error(),
+		})
+	}
+
+	// Content-MD5 carries the base64 encoded digest of the part, as in S3
+	var expectedMD5 string
+	if contentMD5 := c.Request().Header.Get("Content-MD5"); contentMD5 != "" {
+		digest, err := base64.StdEncoding.DecodeString(contentMD5)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid Content-MD5",
+			})
+		}
+		expectedMD5 = hex.EncodeToString(digest)
+	}
+
+	// parts are held to the allowance of a single upload before they are
+	// staged, together with the parts staged before
+	ctx := c.Request().Context()
+	limit, err := h.multipartLimit(ctx, upload)
+	var left int64 = services.UNLIMITED
+	if err == nil {
+		left, err = h.partAllowance(ctx, upload, partNumber, limit)
+	}
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		return uploadTooLarge(c)
+	}
+	if err != nil {
+		log.Printf("failed to check multipart limits: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to upload part",
+		})
+	}
+	body := c.Request().Body
+	if left != services.UNLIMITED {
+		if c.Request().ContentLength > left {
+			return uploadTooLarge(c)
+		}
+		body = http.MaxBytesReader(c.Response(), body, left)
+	}
+
+	part, err := h.multipart.UploadPart(ctx, upload, partNumber, body, expectedMD5)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return uploadTooLarge(c)
+	}
+	if errors.Is(err, services.ErrInvalidPartNumber) || errors.Is(err, services.ErrBadDigest) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		log.Printf("failed to upload part: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to upload part",
+		})
+	}
+
+	// parts staged at the same time may not fit together
+	if limit != services.UNLIMITED {
+		staged, err := h.stagedBytes(ctx, upload.UploadId, 0)
+		if err == nil && staged > limit {
+			if err := h.multipart.DeletePart(ctx, upload.UploadId, partNumber); err != nil {
+				log.Printf("failed to drop part: %v", err)
+			}
+			return uploadTooLarge(c)
+		}
+		if err != nil {
+			log.Printf("failed to check multipart limits: %v", err)
+		}
+	}
+
+	c.Response().Header().Set("ETag", strconv.Quote(part.MD5Hash))
+	return c.JSON(http.StatusOK, map[string]any{
+		"partNumber": part.PartNumber,
+		"etag":       part.MD5Hash,
+		"size":       part.Size,
+	})
+}
+
+func (h *Handler) completeMultipart(c echo.Context) error {
+	ctx := c.Request().Context()
+	upload, status := h.loadMultipartUpload(c)
+	if status != 0 {
+		return multipartUploadError(c, status)
+	}
+
+	var req completeMultipartRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+	parts := make([]models.MultipartPart, 0, len(req.Parts))
+	for _, part := range req.Parts {
+		parts = append(parts, models.MultipartPart{PartNumber: part.PartNumber, MD5Hash: part.ETag})
+	}
+
+	content, err := h.multipart.Complete(ctx, upload, parts)
+	if errors.Is(err, services.ErrInvalidPart) || errors.Is(err, services.ErrInvalidPartOrder) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		log.Printf("failed to complete multipart upload: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to complete multipart upload",
+		})
+	}
+	defer content.Close()
+
+	metadata, exists, err := h.storeUpload(ctx, upload.Owner, upload.Owner, upload.FileName, nil, content)
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		return quotaExceeded(c)
+	}
+	if errors.Is(err, repositories.ErrPathTaken) {
+		return pathTaken(c)
+	}
+	if err != nil {
+		log.Printf("failed to store multipart upload: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to upload file",
+		})
+	}
+
+	if err := h.multipart.Abort(ctx, upload.UploadId); err != nil {
+		log.Printf("failed to clean up multipart upload: %v", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"fileId":   metadata.FileId,
+		"fileName": metadata.FileName,
+		"md5Hash":  metadata.MD5Hash,
+		"exists":   exists,
+		"url":      h.fileURL(upload.Owner, upload.FileName),
+	})
+}
+
+func (h *Handler) abortMultipart(c echo.Context) error {
+	upload, status := h.loadMultipartUpload(c)
+	if status != 0 {
+		return multipartUploadError(c, status)
+	}
+
+	if err := h.multipart.Abort(c.Request().Context(), upload.UploadId); err != nil {
+		log.Printf("failed to abort multipart upload: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to abort multipart upload",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// multipartLimit is how many bytes the staged parts of upload may hold
+// together: what the owner's quota allows for the file, capped by the
+// configured size of a multipart upload, or services.UNLIMITED
+func (h *Handler) multipartLimit(ctx context.Context, upload models.MultipartUpload) (int64, error) {
+	limit, err := h.uploadAllowance(ctx, upload.Owner, upload.FileName)
+	if err != nil {
+		return 0, err
+	}
+	return capLimit(limit, h.cfg.MultipartMaxBytes), nil
+}
+
+// partAllowance is how many bytes part partNumber may hold within limit,
+// next to the other staged parts and the configured size of a part
+func (h *Handler) partAllowance(ctx context.Context, upload models.MultipartUpload, partNumber int, limit int64) (int64, error) {
+	if limit != services.UNLIMITED {
+		// a part uploaded again replaces the staged one
+		staged, err := h.stagedBytes(ctx, upload.UploadId, partNumber)
+		if err != nil {
+			return 0, err
+		}
+		limit = max(limit-staged, 0)
+	}
+	return capLimit(limit, h.cfg.MultipartMaxPartBytes), nil
+}
+
+// stagedBytes sums the parts staged for an upload, except part skip
+func (h *Handler) stagedBytes(ctx context.Context, uploadId string, skip int) (int64, error) {
+	parts, err := h.multipart.ListParts(ctx, uploadId)
+	if err != nil {
+		return 0, err
+	}
+	var staged int64
+	for _, part := range parts {
+		if part.PartNumber != skip {
+			staged += part.Size
+		}
+	}
+	return staged, nil
+}
+
+// capLimit lowers limit, which may be services.UNLIMITED, to a configured
+// maximum, where 0 means no maximum
+func capLimit(limit int64, maximum int64) int64 {
+	if maximum > 0 && (limit == services.UNLIMITED || maximum < limit) {
+		return maximum
+	}
+	return limit
+}
+
+func uploadTooLarge(c echo.Context) error {
+	return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{
+		"error": "upload exceeds the allowed size or quota",
+	})
+}
+
+// loadMultipartUpload resolves the session addressed by the request, or
+// returns the status code to answer with when it cannot be used
+func (h *Handler) loadMultipartUpload(c echo.Context) (models.MultipartUpload, int) {
+	upload, err := h.multipart.GetUpload(c.Request().Context(), c.Param("uploadid"))
+	if err == sql.ErrNoRows {
+		return models.MultipartUpload{}, http.StatusNotFound
+	}
+	if err != nil {
+		log.Printf("failed to load multipart upload: %v", err)
+		return models.MultipartUpload{}, http.StatusInternalServerError
+	}
+	filename, err := pathParam(c, "filename")
+	if err != nil || upload.Owner != c.Param("userid") || upload.FileName != filename {
+		return models.MultipartUpload{}, http.StatusNotFound
+	}
+	return upload, 0
+}
+
+func multipartUploadError(c echo.Context, status int) error {
+	if status == http.StatusNotFound {
+		return c.JSON(status, map[string]string{
+			"error": "upload not found",
+		})
+	}
+	return c.JSON(status, map[string]string{
+		"error": "failed to load upload",
+	})
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestMultipartUpload(t *testing.T) {
+	e, cfg := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/multipart/testuser/data.bin", nil)
+	authorize(req, "testuser")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var initiated map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &initiated)
+	base := "/api/multipart/testuser/data.bin/" + initiated["uploadId"]
+
+	parts := [][]byte{[]byte("first part, "), []byte("second part")}
+	etags := make([]string, len(parts))
+
+	t.Run("upload parts out of order", func(t *testing.T) {
+		for _, i := range []int{1, 0} {
+			digest := md5.Sum(parts[i])
+			req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/%d", base, i+1), bytes.NewReader(parts[i]))
+			authorize(req, "testuser")
+			req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(digest[:]))
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			var uploaded map[string]any
+			json.Unmarshal(rec.Body.Bytes(), &uploaded)
+			etags[i] = uploaded["etag"].(string)
+		}
+	})
+
+	t.Run("reject part with bad digest", func(t *testing.T) {
+		digest := md5.Sum([]byte("something else"))
+		req := httptest.NewRequest(http.MethodPut, base+"/3", bytes.NewReader(parts[0]))
+		authorize(req, "testuser")
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(digest[:]))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("complete", func(t *testing.T) {
+		body := fmt.Sprintf(`{"parts":[{"partNumber":1,"etag":%q},{"partNumber":2,"etag":%q}]}`, etags[0], etags[1])
+		req := httptest.NewRequest(http.MethodPost, base+"/complete", strings.NewReader(body))
+		authorize(req, "testuser")
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		code, stored := downloadContent(e, "testuser", "data.bin")
+		if code != http.StatusOK || stored != "first part, second part" {
+			t.Fatalf("unexpected content %d %q", code, stored)
+		}
+		if _, err := os.Stat(filepath.Join(cfg.BasePath, ".multipart", initiated["uploadId"])); !os.IsNotExist(err) {
+			t.Fatalf("expected staged parts to be removed, got %v", err)
+		}
+	})
+}
+
+func TestMultipartAbort(t *testing.T) {
+	e, cfg := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/multipart/testuser/data.bin", nil)
+	authorize(req, "testuser")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var initiated map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &initiated)
+	base := "/api/multipart/testuser/data.bin/" + initiated["uploadId"]
+
+	req = httptest.NewRequest(http.MethodPut, base+"/1", strings.NewReader("some bytes"))
+	authorize(req, "testuser")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	req = httptest.NewRequest(http.MethodDelete, base, nil)
+	authorize(req, "testuser")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.BasePath, ".multipart", initiated["uploadId"])); !os.IsNotExist(err) {
+		t.Fatalf("expected staged parts to be removed, got %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, base, nil)
+	authorize(req, "testuser")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestMultipartLimits(t *testing.T) {
+	e, cfg := newTestServer(t)
+	cfg.MultipartMaxPartBytes = 10
+	cfg.MultipartMaxBytes = 15
+
+	request := func(method string, target string, body io.Reader, subject string, scopes ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, body)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		authorize(req, subject, scopes...)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	initiate := func(filename string) string {
+		t.Helper()
+		rec := request(http.MethodPost, "/api/multipart/alice/"+filename, nil, "alice")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var initiated map[string]string
+		json.Unmarshal(rec.Body.Bytes(), &initiated)
+		return "/api/multipart/alice/" + filename + "/" + initiated["uploadId"]
+	}
+	// unsized bodies are read until they no longer fit
+	unsized := func(content string) io.Reader {
+		return io.MultiReader(strings.NewReader(content))
+	}
+
+	base := initiate("big.bin")
+	tests := []struct {
+		name string
+		part int
+		body io.Reader
+		want int
+	}{
+		{"part over the part size", 1, strings.NewReader(strings.Repeat("x", 11)), http.StatusRequestEntityTooLarge},
+		{"unsized part over the part size", 1, unsized(strings.Repeat("x", 11)), http.StatusRequestEntityTooLarge},
+		{"part within the part size", 1, strings.NewReader(strings.Repeat("x", 10)), http.StatusOK},
+		{"parts over the upload size", 2, strings.NewReader(strings.Repeat("x", 6)), http.StatusRequestEntityTooLarge},
+		{"parts within the upload size", 2, strings.NewReader(strings.Repeat("x", 5)), http.StatusOK},
+		{"part uploaded again replaces the staged one", 1, strings.NewReader(strings.Repeat("y", 10)), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := request(http.MethodPut, fmt.Sprintf("%s/%d", base, tt.part), tt.body, "alice"); rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("quota", func(t *testing.T) {
+		if rec := request(http.MethodPut, "/api/quotas/alice", strings.NewReader(`{"maxBytes": 12, "maxFiles": 1}`), "root", "admin"); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		base := initiate("small.bin")
+		if rec := request(http.MethodPut, base+"/1", strings.NewReader(strings.Repeat("x", 8)), "alice"); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := request(http.MethodPut, base+"/2", strings.NewReader(strings.Repeat("x", 5)), "alice"); rec.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected 413 over the quota, got %d", rec.Code)
+		}
+
+		uploadContent(t, e, "alice", "only.txt", "x")
+		if rec := request(http.MethodPost, "/api/multipart/alice/more.bin", nil, "alice"); rec.Code != http.StatusInsufficientStorage {
+			t.Fatalf("expected 507 without room for another file, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MAX_PATH_LENGTH bounds the path of a file or folder within its owner's
+// storage
+const MAX_PATH_LENGTH = 1024
+
+var ErrInvalidPath = errors.New("invalid path")
+
+// cleanPath checks a path of a file or folder relative to its owner's
+// storage, such as "docs/2024/report.pdf". Paths are rejected rather than
+// normalized, so "..", "." and empty segments, absolute paths and backslashes
+// never reach the storage, and every file has exactly one name.
+func cleanPath(path string) (string, error) {
+	if path == "" || len(path) > MAX_PATH_LENGTH || strings.HasPrefix(path, "/") || strings.ContainsAny(path, "\\\x00") {
+		return "", ErrInvalidPath
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", ErrInvalidPath
+		}
+	}
+	return path, nil
+}
+
+// MAX_USER_LENGTH bounds the name of a user, which is a directory name
+const MAX_USER_LENGTH = 255
+
+// cleanUser checks the user a route or request acts on. Users name their
+// directory below the storage, so a user is a single segment that is neither
+// hidden, like the blobs and temporary files, nor leads out of it.
+func cleanUser(user string) (string, error) {
+	if user == "" || len(user) > MAX_USER_LENGTH || strings.HasPrefix(user, ".") || strings.ContainsAny(user, "/\\\x00") {
+		return "", ErrInvalidPath
+	}
+	return user, nil
+}
+
+// pathParam returns a clean path from a route parameter. Echo matches routes
+// against the raw path whenever the request escapes more than needed, such as
+// "%2F" or "%2e%2e", and then leaves the escapes in the parameter.
+func pathParam(c echo.Context, name string) (string, error) {
+	value, err := unescapeParam(c, name)
+	if err != nil {
+		return "", err
+	}
+	return cleanPath(value)
+}
+
+func unescapeParam(c echo.Context, name string) (string, error) {
+	value := c.Param(name)
+	if c.Request().URL.RawPath != "" {
+		unescaped, err := url.PathUnescape(value)
+		if err != nil {
+			return "", ErrInvalidPath
+		}
+		value = unescaped
+	}
+	return value, nil
+}
+
+// withUser rejects routes whose user is not a clean name, see cleanUser, and
+// binds the unescaped name. It runs for every route, before authentication.
+func withUser(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		names := append([]string(nil), c.ParamNames()...)
+		values := append([]string(nil), c.ParamValues()...)
+		for i, name := range names {
+			if name != "userid" && name != "username" {
+				continue
+			}
+			user, err := unescapeParam(c, name)
+			if err == nil {
+				user, err = cleanUser(user)
+			}
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "invalid user",
+				})
+			}
+			values[i] = user
+		}
+		c.SetParamNames(names...)
+		c.SetParamValues(values...)
+		return next(c)
+	}
+}
+
+// withPath binds the wildcard of a route to the filename parameter once it is
+// a clean path, so that handlers and authentication treat nested paths like
+// the single names of other routes. It must run before them.
+func withPath(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		path, err := pathParam(c, "*")
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid path",
+			})
+		}
+
+		// the names belong to the route, so they are copied before renaming
+		names := append([]string(nil), c.ParamNames()...)
+		values := append([]string(nil), c.ParamValues()...)
+		for i, name := range names {
+			if name == "*" {
+				names[i] = "filename"
+				values[i] = path
+			}
+		}
+		c.SetParamNames(names...)
+		c.SetParamValues(values...)
+		return next(c)
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/auth"
+	"github.com/labstack/echo/v4"
+)
+
+// DEFAULT_PRESIGN_EXPIRY is how long a pre-signed URL is valid unless the
+// request asks for another lifetime
+const DEFAULT_PRESIGN_EXPIRY = time.Hour
+
+type presignRequest struct {
+	// Method is GET for a download URL, PUT or POST for an upload URL
+	Method string `json:"method"`
+	// ExpiresIn is the lifetime in seconds
+	ExpiresIn int `json:"expiresIn"`
+	// MaxSize and ContentType constrain uploads
+	MaxSize     int64  `json:"maxSize"`
+	ContentType string `json:"contentType"`
+}
+
+func (h *Handler) registerPresignRoutes(e *echo.Group) {
+	e.POST("/presign/:username/*", h.presign, withPath)
+}
+
+// presign creates a URL that uploads or downloads one file without any
+// credentials, for handing to third parties
+func (h *Handler) presign(c echo.Context) error {
+	if h.signer == nil {
+		return c.JSON(http.StatusNotImplemented, map[string]string{
+			"error": "pre-signed URLs are not configured",
+		})
+	}
+	username := c.Param("username")
+	filename := c.Param("filename")
+
+	var req presignRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	var path string
+	switch req.Method {
+	case http.MethodGet:
+		if req.MaxSize != 0 || req.ContentType != "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "maxSize and contentType only apply to uploads",
+			})
+		}
+		path = API_PREFIX + "/download/" + username + "/" + filename
+	case http.MethodPut, http.MethodPost:
+		if !allows(c, auth.SCOPE_WRITE) {
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": "missing scope " + auth.SCOPE_WRITE,
+			})
+		}
+		path = API_PREFIX + "/upload/" + username + "/" + filename
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "method must be GET, PUT or POST",
+		})
+	}
+
+	expiry := DEFAULT_PRESIGN_EXPIRY
+	if req.ExpiresIn != 0 {
+		expiry = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if expiry <= 0 || expiry > h.cfg.PresignMaxExpiry {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "expiresIn must be positive and at most " + h.cfg.PresignMaxExpiry.String(),
+		})
+	}
+	if req.MaxSize < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "maxSize must not be negative",
+		})
+	}
+	if req.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(req.ContentType); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid contentType",
+			})
+		}
+	}
+
+	presigned := auth.Presigned{
+		Method:      req.Method,
+		Path:        path,
+		ExpiresAt:   time.Now().Add(expiry),
+		MaxSize:     req.MaxSize,
+		ContentType: req.ContentType,
+	}
+	query := h.signer.Sign(presigned)
+
+	escaped := (&url.URL{Path: path}).EscapedPath()
+	return c.JSON(http.StatusCreated, map[string]any{
+		"url":       h.cfg.ServerHost + escaped + "?" + query.Encode(),
+		"method":    presigned.Method,
+		"expiresAt": presigned.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// presignedOr accepts a pre-signed URL for the route and enforces its
+// constraints, handing requests without a signature to fallback
+func (h *Handler) presignedOr(fallback echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		otherwise := fallback(next)
+		return func(c echo.Context) error {
+			req := c.Request()
+			query := req.URL.Query()
+			if !query.Has(auth.PRESIGN_SIGNATURE) {
+				return otherwise(c)
+			}
+			if h.signer == nil {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "pre-signed URLs are not configured",
+				})
+			}
+
+			presigned, err := h.signer.Verify(req.URL.Path, query, time.Now())
+			if errors.Is(err, auth.ErrExpiredSignature) {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "pre-signed URL has expired",
+				})
+			}
+			if err != nil {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "invalid signature",
+				})
+			}
+
+			// a download URL also answers HEAD, which reveals nothing more
+			if req.Method != presigned.Method && !(req.Method == http.MethodHead && presigned.Method == http.MethodGet) {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "method not allowed by the signature",
+				})
+			}
+			// the signature grants the file as it is now, not its earlier versions
+			if query.Get("versionId") != "" {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "versionId is not allowed by the signature",
+				})
+			}
+			if presigned.ContentType != "" && !sameMediaType(req.Header.Get(echo.HeaderContentType), presigned.ContentType) {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "content type not allowed by the signature",
+				})
+			}
+			if presigned.MaxSize > 0 {
+				if req.ContentLength > presigned.MaxSize {
+					return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{
+						"error": "file exceeds the size allowed by the signature",
+					})
+				}
+				// the length may be unknown up front, so the body is capped too
+				req.Body = http.MaxBytesReader(c.Response(), req.Body, presigned.MaxSize)
+			}
+			return next(c)
+		}
+	}
+}
+
+func sameMediaType(a string, b string) bool {
+	typeA, _, errA := mime.ParseMediaType(a)
+	typeB, _, errB := mime.ParseMediaType(b)
+	return errA == nil && errB == nil && typeA == typeB
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/auth"
+	"github.com/labstack/echo/v4"
+)
+
+// presignURL asks the API for a pre-signed URL and returns its path and query
+func presignURL(t *testing.T, e *echo.Echo, subject string, target string, body string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	authorize(req, subject)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		return rec.Code, ""
+	}
+	var result map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	link, err := url.Parse(result["url"])
+	if err != nil {
+		t.Fatalf("invalid url %q: %v", result["url"], err)
+	}
+	return rec.Code, link.RequestURI()
+}
+
+func TestPresignedURLs(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	send := func(method string, target string, body string, contentType string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set(echo.HeaderContentType, contentType)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	_, upload := presignURL(t, e, "alice", "/api/presign/alice/photo%20one.png",
+		`{"method": "PUT", "maxSize": 10, "contentType": "image/png"}`)
+	if upload == "" {
+		t.Fatal("expected an upload URL")
+	}
+
+	t.Run("upload constraints", func(t *testing.T) {
+		if rec := send(http.MethodPost, upload, "png", "image/png"); rec.Code != http.StatusForbidden {
+			t.Fatalf("expected another method to be refused, got %d", rec.Code)
+		}
+		if rec := send(http.MethodPut, upload, "png", "text/plain"); rec.Code != http.StatusForbidden {
+			t.Fatalf("expected another content type to be refused, got %d", rec.Code)
+		}
+		if rec := send(http.MethodPut, upload, "far too large", "image/png"); rec.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected an oversized body to be refused, got %d", rec.Code)
+		}
+		// without a Content-Length the body is cut off while streaming
+		req := httptest.NewRequest(http.MethodPut, upload, strings.NewReader("far too large"))
+		req.Header.Set(echo.HeaderContentType, "image/png")
+		req.ContentLength = -1
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected a streamed oversized body to be refused, got %d", rec.Code)
+		}
+		tampered := strings.Replace(upload, "max_size=10", "max_size=1000", 1)
+		if rec := send(http.MethodPut, tampered, "far too large", "image/png"); rec.Code != http.StatusForbidden {
+			t.Fatalf("expected a tampered URL to be refused, got %d", rec.Code)
+		}
+		otherFile := strings.Replace(upload, "photo%20one.png", "other.png", 1)
+		if rec := send(http.MethodPut, otherFile, "png", "image/png"); rec.Code != http.StatusForbidden {
+			t.Fatalf("expected the URL to be bound to its file, got %d", rec.Code)
+		}
+		if rec := send(http.MethodPut, upload, "png bytes", "image/png; charset=binary"); rec.Code != http.StatusOK {
+			t.Fatalf("expected the upload to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("download", func(t *testing.T) {
+		_, download := presignURL(t, e, "alice", "/api/presign/alice/photo%20one.png", `{"method": "GET"}`)
+		rec := send(http.MethodGet, download, "", "")
+		if rec.Code != http.StatusOK || rec.Body.String() != "png bytes" {
+			t.Fatalf("expected the file, got %d %q", rec.Code, rec.Body.String())
+		}
+		if rec := send(http.MethodHead, download, "", ""); rec.Code != http.StatusOK {
+			t.Fatalf("expected HEAD to be allowed, got %d", rec.Code)
+		}
+		if rec := send(http.MethodPut, strings.Replace(download, "/download/", "/upload/", 1), "x", ""); rec.Code != http.StatusForbidden {
+			t.Fatalf("expected a download URL not to upload, got %d", rec.Code)
+		}
+
+		versions := versionIds(t, e, "alice", "photo one.png")
+		if rec := send(http.MethodGet, download+"&versionId="+url.QueryEscape(versions[len(versions)-1]), "", ""); rec.Code != http.StatusForbidden {
+			t.Fatalf("expected a download URL not to reach earlier versions, got %d", rec.Code)
+		}
+	})
+
+	t.Run("rotated key", func(t *testing.T) {
+		// URLs signed before the switch to the new key keep working
+		old, err := auth.NewSigner("old:old secret", "old")
+		if err != nil {
+			t.Fatalf("failed to create signer: %v", err)
+		}
+		query := old.Sign(auth.Presigned{
+			Method:    http.MethodGet,
+			Path:      "/api/download/alice/photo one.png",
+			ExpiresAt: time.Now().Add(time.Minute),
+		})
+		if rec := send(http.MethodGet, "/api/download/alice/photo%20one.png?"+query.Encode(), "", ""); rec.Code != http.StatusOK {
+			t.Fatalf("expected a URL signed with an older key to work, got %d", rec.Code)
+		}
+
+		retired, _ := auth.NewSigner("retired:retired secret", "")
+		query = retired.Sign(auth.Presigned{
+			Method:    http.MethodGet,
+			Path:      "/api/download/alice/photo one.png",
+			ExpiresAt: time.Now().Add(time.Minute),
+		})
+		if rec := send(http.MethodGet, "/api/download/alice/photo%20one.png?"+query.Encode(), "", ""); rec.Code != http.StatusForbidden {
+			t.Fatalf("expected a URL signed with a removed key to be refused, got %d", rec.Code)
+		}
+	})
+
+	t.Run("signing", func(t *testing.T) {
+		tests := []struct {
+			subject string
+			body    string
+			want    int
+		}{
+			{"bob", `{"method": "GET"}`, http.StatusForbidden},
+			{"alice", `{"method": "DELETE"}`, http.StatusBadRequest},
+			{"alice", `{"method": "GET", "maxSize": 10}`, http.StatusBadRequest},
+			{"alice", `{"method": "PUT", "expiresIn": 100000000}`, http.StatusBadRequest},
+			{"alice", `{"method": "PUT", "contentType": "not a type"}`, http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			if code, _ := presignURL(t, e, tt.subject, "/api/presign/alice/photo.png", tt.body); code != tt.want {
+				t.Fatalf("%v %v: expected %d, got %d", tt.subject, tt.body, tt.want, code)
+			}
+		}
+	})
+}
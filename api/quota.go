@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/auth"
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type setQuotaRequest struct {
+	// MaxBytes and MaxFiles of 0 mean no limit
+	MaxBytes int64 `json:"maxBytes"`
+	MaxFiles int64 `json:"maxFiles"`
+}
+
+func (h *Handler) registerUsageRoutes(e *echo.Group) {
+	e.GET("/usage/:username", h.getUsage)
+}
+
+func (h *Handler) registerQuotaRoutes(e *echo.Group) {
+	e.PUT("/quotas/:username", h.setQuota, requireAdmin)
+	e.DELETE("/quotas/:username", h.resetQuota, requireAdmin)
+}
+
+// uploadAllowance is how many bytes owner's filename may hold within the
+// owner's quota, or services.UNLIMITED
+func (h *Handler) uploadAllowance(ctx context.Context, owner string, filename string) (int64, error) {
+	previous, err := h.meta.GetMetadataByName(ctx, owner, filename)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	// the replaced content is kept as a version and stays charged, unless it
+	// was stored before the blob store
+	freed := previous.Size
+	if previous.SHA256Hash != "" {
+		freed = 0
+	}
+	return h.quotas.Allowance(ctx, owner, freed, err == sql.ErrNoRows)
+}
+
+// checkQuota fails with services.ErrQuotaExceeded when storing size bytes,
+// -1 if unknown, under owner's filename would exceed the owner's quota
+func (h *Handler) checkQuota(ctx context.Context, owner string, filename string, size int64) error {
+	allowance, err := h.uploadAllowance(ctx, owner, filename)
+	if err != nil {
+		return err
+	}
+	if allowance != services.UNLIMITED && size > allowance {
+		return services.ErrQuotaExceeded
+	}
+	return nil
+}
+
+func quotaExceeded(c echo.Context) error {
+	return c.JSON(http.StatusInsufficientStorage, map[string]string{
+		"error": "quota exceeded",
+	})
+}
+
+// quotaReader fails as soon as more than left bytes were read, so that an
+// upload of unknown size stops when it no longer fits
+type quotaReader struct {
+	src  io.Reader
+	left int64
+}
+
+func (r *quotaReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	r.left -= int64(n)
+	if r.left < 0 {
+		return n, services.ErrQuotaExceeded
+	}
+	return n, err
+}
+
+func (h *Handler) getUsage(c echo.Context) error {
+	ctx := c.Request().Context()
+	username := c.Param("username")
+
+	usage, err := h.quotas.Usage(ctx, username)
+	if err != nil {
+		log.Printf("failed to load usage: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to load usage",
+		})
+	}
+	quota, custom, err := h.quotas.Quota(ctx, username)
+	if err != nil {
+		log.Printf("failed to load quota: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to load usage",
+		})
+	}
+
+	// remaining is null without a limit
+	var bytesRemaining, filesRemaining any
+	if quota.MaxBytes > 0 {
+		bytesRemaining = max(quota.MaxBytes-usage.BytesUsed, 0)
+	}
+	if quota.MaxFiles > 0 {
+		filesRemaining = max(quota.MaxFiles-usage.FileCount, 0)
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"username":       username,
+		"bytesUsed":      usage.BytesUsed,
+		"fileCount":      usage.FileCount,
+		"maxBytes":       quota.MaxBytes,
+		"maxFiles":       quota.MaxFiles,
+		"bytesRemaining": bytesRemaining,
+		"filesRemaining": filesRemaining,
+		"customQuota":    custom,
+	})
+}
+
+// requireAdmin refuses requests without the admin scope. It runs after
+// authenticate(auth.SCOPE_ADMIN), which access tokens always pass for their
+// own files.
+func requireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if identity, ok := identityFrom(c); ok && !identity.HasScope(auth.SCOPE_ADMIN) {
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": "missing scope " + auth.SCOPE_ADMIN,
+			})
+		}
+		return next(c)
+	}
+}
+
+// setQuota gives a user limits of their own instead of the default ones
+func (h *Handler) setQuota(c echo.Context) error {
+	var req setQuotaRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+	if req.MaxBytes < 0 || req.MaxFiles < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "maxBytes and maxFiles must not be negative",
+		})
+	}
+
+	quota := models.Quota{Owner: c.Param("username"), MaxBytes: req.MaxBytes, MaxFiles: req.MaxFiles}
+	if err := h.quotas.SetQuota(c.Request().Context(), quota); err != nil {
+		log.Printf("failed to set quota: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to set quota",
+		})
+	}
+	return h.getUsage(c)
+}
+
+// resetQuota makes the default limits apply to a user again
+func (h *Handler) resetQuota(c echo.Context) error {
+	if err := h.quotas.ResetQuota(c.Request().Context(), c.Param("username")); err != nil {
+		log.Printf("failed to reset quota: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to reset quota",
+		})
+	}
+	return h.getUsage(c)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func getUsage(t *testing.T, e *echo.Echo, username string) map[string]any {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/usage/"+username, nil)
+	authorize(req, username)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var usage map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &usage)
+	return usage
+}
+
+func TestQuotas(t *testing.T) {
+	e, _ := newTestServer(t)
+	uploadContent(t, e, "alice", "a.txt", "0123456789")
+
+	setQuota := func(subject string, body string, scopes ...string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/quotas/alice", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		authorize(req, subject, scopes...)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	upload := func(filename string, body io.Reader, contentLength int64) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/upload/alice/"+filename, body)
+		req.ContentLength = contentLength
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	usage := getUsage(t, e, "alice")
+	if usage["bytesUsed"] != float64(10) || usage["fileCount"] != float64(1) || usage["bytesRemaining"] != nil {
+		t.Fatalf("unexpected usage %v", usage)
+	}
+
+	if code := setQuota("alice", `{"maxBytes": 1000}`); code != http.StatusForbidden {
+		t.Fatalf("expected users not to set their own quota, got %d", code)
+	}
+	if code := setQuota("root", `{"maxBytes": 25, "maxFiles": 2}`, "admin"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	t.Run("known size is refused before reading", func(t *testing.T) {
+		body := &countingReader{src: strings.NewReader(strings.Repeat("x", 20))}
+		if code := upload("big.txt", body, 20); code != http.StatusInsufficientStorage {
+			t.Fatalf("expected 507, got %d", code)
+		}
+		if body.read != 0 {
+			t.Fatalf("expected the body not to be read, %d bytes were", body.read)
+		}
+	})
+
+	t.Run("unknown size stops at the quota", func(t *testing.T) {
+		body := strings.NewReader(strings.Repeat("x", 20))
+		if code := upload("big.txt", body, -1); code != http.StatusInsufficientStorage {
+			t.Fatalf("expected 507, got %d", code)
+		}
+		if usage := getUsage(t, e, "alice"); usage["fileCount"] != float64(1) {
+			t.Fatalf("expected the upload not to be stored, got %v", usage)
+		}
+	})
+
+	t.Run("overwrites keep the previous version charged", func(t *testing.T) {
+		if code := upload("a.txt", strings.NewReader(strings.Repeat("y", 20)), 20); code != http.StatusInsufficientStorage {
+			t.Fatalf("expected 507 without room for the previous version, got %d", code)
+		}
+		if code := upload("a.txt", strings.NewReader(strings.Repeat("y", 15)), 15); code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", code)
+		}
+		usage := getUsage(t, e, "alice")
+		if usage["bytesUsed"] != float64(25) || usage["fileCount"] != float64(1) || usage["bytesRemaining"] != float64(0) {
+			t.Fatalf("unexpected usage %v", usage)
+		}
+		if code := upload("a.txt", strings.NewReader("z"), -1); code != http.StatusInsufficientStorage {
+			t.Fatalf("expected 507 for an overwrite of unknown size, got %d", code)
+		}
+	})
+
+	t.Run("file count", func(t *testing.T) {
+		if code := setQuota("root", `{"maxBytes": 100, "maxFiles": 2}`, "admin"); code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", code)
+		}
+		if code := upload("b.txt", strings.NewReader("b"), 1); code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", code)
+		}
+		if code := upload("c.txt", strings.NewReader("c"), 1); code != http.StatusInsufficientStorage {
+			t.Fatalf("expected 507 for a third file, got %d", code)
+		}
+	})
+
+	t.Run("deletes keep the bytes until purged", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/api/delete/alice/b.txt", nil)
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		usage := getUsage(t, e, "alice")
+		if usage["bytesUsed"] != float64(26) || usage["fileCount"] != float64(1) || usage["filesRemaining"] != float64(1) {
+			t.Fatalf("unexpected usage %v", usage)
+		}
+
+		var result map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		req = httptest.NewRequest(http.MethodDelete, "/api/trash/alice/"+result["trashId"].(string), nil)
+		authorize(req, "alice")
+		e.ServeHTTP(httptest.NewRecorder(), req)
+		if usage := getUsage(t, e, "alice"); usage["bytesUsed"] != float64(25) {
+			t.Fatalf("expected purging to free the bytes, got %v", usage)
+		}
+	})
+}
@@ -1,144 +1,454 @@
 package api
 
 import (
-	"bytes"
 	"context"
-	"crypto/md5"
 	"database/sql"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/Iwoooooods/fs-upload-go/internal/auth"
 	"github.com/Iwoooooods/fs-upload-go/internal/config"
 	"github.com/Iwoooooods/fs-upload-go/internal/localstorage"
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/Iwoooooods/fs-upload-go/internal/storage"
 	"github.com/labstack/echo/v4"
 )
 
+// API_PREFIX is where RegisterRoutes is mounted, used to build URLs
+const API_PREFIX = "/api"
+
 type Handler struct {
-	cfg *config.Config
-	db  *sql.DB
+	cfg       *config.Config
+	db        *sql.DB
+	verifier  *auth.Verifier
+	signer    *auth.Signer
+	storage   storage.Storage
+	meta      services.MetaService
+	tus       services.TusService
+	multipart services.MultipartService
+	streams   services.StreamTokenService
+	apiKeys   services.APIKeyService
+	acls      services.ACLService
+	links     services.ShareLinkService
+	quotas    services.QuotaService
+	versions  services.VersionService
+	trash     services.TrashService
+	folders   services.FolderService
+	locks     *fileLocks
+	// tusLocks holds each tus upload while a PATCH writes to it
+	tusLocks *fileLocks
 }
 
-func NewHandler(cfg *config.Config, db *sql.DB) *Handler {
-	return &Handler{
-		cfg: cfg,
-		db:  db,
+// NewHandler serves the API, keeping file content in backend. Unless
+// authentication is disabled, an access token key must be configured.
+func NewHandler(cfg *config.Config, db *sql.DB, backend storage.Storage) (*Handler, error) {
+	var verifier *auth.Verifier
+	if !cfg.AuthDisabled {
+		var err error
+		if verifier, err = auth.NewVerifier(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	var signer *auth.Signer
+	if cfg.PresignKeys != "" {
+		var err error
+		if signer, err = auth.NewSigner(cfg.PresignKeys, cfg.PresignKeyId); err != nil {
+			return nil, err
+		}
 	}
+
+	metaRepo := repositories.NewMetaRepositorySQLite(db)
+	tusRepo := repositories.NewTusRepositorySQLite(db)
+	multipartRepo := repositories.NewMultipartRepositorySQLite(db)
+	streamTokenRepo := repositories.NewStreamTokenRepositorySQLite(db)
+	apiKeyRepo := repositories.NewAPIKeyRepositorySQLite(db)
+	aclRepo := repositories.NewACLRepositorySQLite(db)
+	shareLinkRepo := repositories.NewShareLinkRepositorySQLite(db)
+	quotaRepo := repositories.NewQuotaRepositorySQLite(db)
+	versionRepo := repositories.NewFileVersionRepositorySQLite(db)
+	trashRepo := repositories.NewTrashRepositorySQLite(db)
+	folderRepo := repositories.NewFolderRepositorySQLite(db)
+	defaultQuota := models.Quota{MaxBytes: cfg.QuotaMaxBytes, MaxFiles: cfg.QuotaMaxFiles}
+
+	return &Handler{
+		cfg:       cfg,
+		db:        db,
+		verifier:  verifier,
+		signer:    signer,
+		storage:   backend,
+		meta:      services.NewMetaService(metaRepo),
+		tus:       services.NewTusService(tusRepo, filepath.Join(cfg.BasePath, ".tus"), cfg.TusExpiration),
+		multipart: services.NewMultipartService(multipartRepo, filepath.Join(cfg.BasePath, ".multipart"), cfg.MultipartExpiration),
+		streams:   services.NewStreamTokenService(streamTokenRepo),
+		apiKeys:   services.NewAPIKeyService(apiKeyRepo),
+		acls:      services.NewACLService(aclRepo),
+		links:     services.NewShareLinkService(shareLinkRepo),
+		quotas:    services.NewQuotaService(quotaRepo, defaultQuota),
+		versions:  services.NewVersionService(versionRepo),
+		trash:     services.NewTrashService(trashRepo),
+		folders:   services.NewFolderService(folderRepo),
+		locks:     newFileLocks(),
+		tusLocks:  newFileLocks(),
+	}, nil
 }
 
 func (h *Handler) RegisterRoutes(e *echo.Group) {
+	// users name directories of the storage, see withUser
+	e = e.Group("", withUser)
 	e.GET("/ping", func(c echo.Context) error {
 		return c.String(http.StatusOK, "pong")
 	})
-	// filename is the combination of fileid and extension
-	e.POST("/upload/:userid/:filename", h.uploadFile)
-	e.GET("/download/:username/:filename", h.downloadFile)
-	e.DELETE("/delete/:username/:filename", h.deleteFile)
+	// share links are public, the link itself is the credential
+	h.registerPublicShareRoutes(e)
+
+	// every other route needs an access token or API key with the scope of
+	// its group; uploads and downloads also accept a pre-signed URL, and
+	// downloads a stream token, in place of it. Single files may also be
+	// accessed by the users and groups they were shared with.
+	// Files are addressed by their path below the user, which may be nested
+	// in folders, see withPath.
+	read := h.authenticate(auth.SCOPE_READ)
+	write := h.authenticate(auth.SCOPE_WRITE)
+	remove := h.authenticate(auth.SCOPE_DELETE)
+	sharedRead := h.authenticateShared(auth.SCOPE_READ)
+	sharedWrite := h.authenticateShared(auth.SCOPE_WRITE)
+	e.POST("/upload/:userid/*", h.uploadFile, withPath, h.presignedOr(sharedWrite))
+	e.PUT("/upload/:userid/*", h.uploadFile, withPath, h.presignedOr(sharedWrite))
+	// browser forms carrying several files, see uploadForm
+	e.POST("/upload/:userid", h.uploadForm, write)
+	// archives unpacked into a user's files
+	h.registerExtractRoutes(e, write)
+	// ?versionId= downloads an earlier version
+	e.GET("/download/:username/*", h.downloadFile, withPath, h.presignedOr(h.streamTokenOr(sharedRead)))
+	e.HEAD("/download/:username/*", h.downloadFile, withPath, h.presignedOr(h.streamTokenOr(sharedRead)))
+	e.DELETE("/delete/:username/*", h.deleteFile, withPath, h.authenticateShared(auth.SCOPE_DELETE))
+	// conditional replacement, guarded by If-Match or If-None-Match: *
+	e.PUT("/files/:username/*", h.updateFile, withPath, sharedWrite)
+	h.registerTransferRoutes(e)
+	h.registerVersionRoutes(e, sharedRead, sharedWrite)
+	// deleted files wait in their owner's trash
+	h.registerTrashRoutes(e, read, write, remove)
+	h.registerFolderRoutes(e, read, write, remove)
+
+	readers := e.Group("", read)
+	h.registerFileRoutes(readers)
+	h.registerArchiveRoutes(readers)
+	h.registerStreamRoutes(readers)
+	// upload URLs additionally need the write scope, checked by the handler
+	h.registerPresignRoutes(readers)
+	h.registerSharedRoutes(readers)
+	h.registerUsageRoutes(readers)
+
+	writers := e.Group("", write)
+	h.registerACLRoutes(writers)
+	h.registerShareLinkRoutes(writers)
+	// resumable uploads following the tus 1.0 protocol
+	h.registerTusRoutes(writers)
+	// S3-style uploads of a file in parallel parts
+	h.registerMultipartRoutes(writers)
+
+	// API keys may only be managed by users and by keys with the admin scope
+	admins := e.Group("", h.authenticate(auth.SCOPE_ADMIN))
+	h.registerAPIKeyRoutes(admins)
+	// quotas can only be changed by admins, see requireAdmin
+	h.registerQuotaRoutes(admins)
 }
 
-func (h *Handler) uploadFile(c echo.Context) error {
-	ctx := context.Background()
+// StartBackgroundJobs periodically cleans up expired state and records the
+// last use of API keys until ctx is done
+func (h *Handler) StartBackgroundJobs(ctx context.Context) {
+	ticker := time.NewTicker(h.cfg.CleanupInterval)
+	flushTicker := time.NewTicker(h.cfg.APIKeyFlushInterval)
+	go func() {
+		defer ticker.Stop()
+		defer flushTicker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.runCleanup(ctx)
+			case <-flushTicker.C:
+				h.FlushAPIKeyUsage(ctx)
+			}
+		}
+	}()
+}
 
-	userid := c.Param("userid")
-	filename := c.Param("filename")
-	// load env config from dev.env
-	basePath := h.cfg.BasePath
-	log.Printf("storing files in: %v", basePath)
+// FlushAPIKeyUsage writes the last-used times of API keys to the database;
+// call it on shutdown so that none are lost
+func (h *Handler) FlushAPIKeyUsage(ctx context.Context) {
+	if _, err := h.apiKeys.FlushLastUsed(ctx); err != nil {
+		log.Printf("failed to record API key usage: %v", err)
+	}
+}
 
-	uploader, err := localstorage.NewUploader(basePath, userid, h.db)
+func (h *Handler) runCleanup(ctx context.Context) {
+	purged, err := h.tus.PurgeExpired(ctx)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to create uploader",
-		})
+		log.Printf("failed to purge expired tus uploads: %v", err)
+	} else if purged > 0 {
+		log.Printf("purged %d expired tus uploads", purged)
 	}
-	log.Printf("current uploader is the user: %v", uploader)
 
-	var buffer bytes.Buffer
-	// get file and md5 from request body
-	file := c.Request().Body
+	purged, err = h.multipart.PurgeStale(ctx)
+	if err != nil {
+		log.Printf("failed to purge stale multipart uploads: %v", err)
+	} else if purged > 0 {
+		log.Printf("purged %d stale multipart uploads", purged)
+	}
 
-	// generate md5 hash of the file
-	hasher := md5.New()
-	writer := io.MultiWriter(&buffer, hasher)
+	expired, err := h.streams.PurgeExpired(ctx)
+	if err != nil {
+		log.Printf("failed to purge expired stream tokens: %v", err)
+	} else if expired > 0 {
+		log.Printf("purged %d expired stream tokens", expired)
+	}
 
-	// Read the entire content
-	if _, err := io.Copy(writer, file); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to calculate MD5",
-		})
+	pruned, err := localstorage.PruneVersions(ctx, h.db, h.cfg.BasePath, h.storage, h.retentionPolicy())
+	if err != nil {
+		log.Printf("failed to prune file versions: %v", err)
+	} else if pruned > 0 {
+		log.Printf("pruned %d file versions", pruned)
+	}
+
+	purged, err = localstorage.PurgeLegacyBlobs(ctx, h.db, h.cfg.BasePath)
+	if err != nil {
+		log.Printf("failed to purge legacy blobs: %v", err)
+	} else if purged > 0 {
+		log.Printf("purged %d legacy blobs", purged)
+	}
+
+	if h.cfg.TrashRetention > 0 {
+		purged, err = localstorage.PurgeTrash(ctx, h.db, h.cfg.BasePath, h.storage, h.cfg.TrashRetention)
+		if err != nil {
+			log.Printf("failed to purge trash: %v", err)
+		} else if purged > 0 {
+			log.Printf("purged %d files from the trash", purged)
+		}
+	}
+}
+
+// storeUpload writes src into the user's storage and records its metadata,
+// the common last step of every way to upload a file. exists reports that the
+// content was already stored, in which case metadata carries the id of the
+// file that first stored it. properties replace those of the file unless nil.
+func (h *Handler) storeUpload(ctx context.Context, userid string, author string, filename string, properties map[string]string, src io.Reader) (metadata models.FileMetadata, exists bool, err error) {
+	unlock := h.locks.Lock(userid, filename)
+	defer unlock()
+
+	metadata, exists, err = h.writeFile(ctx, userid, author, filename, properties, src)
+	if err != nil {
+		return models.FileMetadata{}, false, err
+	}
+
+	if exists {
+		existing, err := h.meta.GetMetadataBySHA256(ctx, metadata.SHA256Hash)
+		if err != nil {
+			return models.FileMetadata{}, false, err
+		}
+		metadata.FileId = existing.FileId
+	}
+	return metadata, exists, nil
+}
+
+// newUploader returns the uploader of owner's files, which keeps the content
+// it stores within the owner's quota
+func (h *Handler) newUploader(owner string) (*localstorage.DefaultUploader, error) {
+	uploader, err := localstorage.NewUploader(h.cfg.BasePath, owner, h.db, h.storage)
+	if err != nil {
+		return nil, err
+	}
+	uploader.Quotas = h.quotas
+	return uploader, nil
+}
+
+// writeFile stores src as owner's filename within the owner's quota, written
+// by author. The caller must hold the file's lock.
+func (h *Handler) writeFile(ctx context.Context, owner string, author string, filename string, properties map[string]string, src io.Reader) (models.FileMetadata, bool, error) {
+	if err := h.claimPath(ctx, owner, filename); err != nil {
+		return models.FileMetadata{}, false, err
+	}
+	allowance, err := h.uploadAllowance(ctx, owner, filename)
+	if err != nil {
+		return models.FileMetadata{}, false, err
+	}
+	if allowance != services.UNLIMITED {
+		src = &quotaReader{src: src, left: allowance}
 	}
-	md5Hash := hex.EncodeToString(hasher.Sum(nil))
 
-	// upload file
-	err = uploader.UploadFile(ctx, &buffer, filename)
+	uploader, err := h.newUploader(owner)
 	if err != nil {
+		return models.FileMetadata{}, false, err
+	}
+	uploader.Author = author
+	uploader.Properties = properties
+	return uploader.UploadFile(ctx, src, filename)
+}
+
+func (h *Handler) fileURL(userid string, filename string) string {
+	return fmt.Sprintf("%v/%v/%v", h.cfg.ServerHost, userid, filename)
+}
+
+func (h *Handler) uploadFile(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	userid := c.Param("userid")
+	filename := c.Param("filename")
+
+	// refuse uploads of a known size that cannot fit before reading them
+	var metadata models.FileMetadata
+	var exists bool
+	err := h.checkQuota(ctx, userid, filename, c.Request().ContentLength)
+	if err == nil {
+		// stream the body straight to disk, hashing it on the way; content
+		// that is already stored is only linked to the new name
+		metadata, exists, err = h.storeUpload(ctx, userid, author(c, userid), filename, nil, c.Request().Body)
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{
+			"error": "file exceeds the allowed size",
+		})
+	}
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		return quotaExceeded(c)
+	}
+	if errors.Is(err, repositories.ErrPathTaken) {
+		return pathTaken(c)
+	}
+	if err != nil {
+		log.Printf("failed to upload file: %v", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "failed to upload file",
 		})
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{
+	return c.JSON(http.StatusOK, map[string]any{
+		"fileId":   metadata.FileId,
 		"fileName": filename,
-		"md5Hash":  md5Hash,
-		"url":      fmt.Sprintf("%v/%v/%v", h.cfg.ServerHost, userid, filename),
+		"md5Hash":  metadata.MD5Hash,
+		"exists":   exists,
+		"url":      h.fileURL(userid, filename),
 	})
 }
 
 func (h *Handler) downloadFile(c echo.Context) error {
+	if c.QueryParam("versionId") != "" {
+		return h.downloadVersion(c)
+	}
 	// Get username and filename from parameters
 	username := c.Param("username")
 	filename := c.Param("filename")
-	basePath := h.cfg.BasePath
 
-	// Create uploader instance to access metadata
-	uploader, err := localstorage.NewUploader(basePath, username, h.db)
+	// the name resolves to a blob, read from whichever backend is configured
+	reader, metadata, err := h.openFile(c.Request().Context(), username, filename)
+	if errors.Is(err, storage.ErrNotExist) {
+		return c.String(http.StatusNotFound, "file not found")
+	}
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "failed to create uploader")
+		log.Printf("failed to open file: %v", err)
+		return c.String(http.StatusInternalServerError, "failed to open file")
 	}
+	defer reader.Close()
 
-	// Get file path
-	filePath := filepath.Join(uploader.BasePath, filename)
-	log.Printf("getting file from: %v", filePath)
+	h.markAccessed(c, metadata)
+	serveFile(c, reader, metadata, filename)
+	return nil
+}
 
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return c.String(http.StatusNotFound, "file not found")
+// openFile opens owner's file in the storage backend
+func (h *Handler) openFile(ctx context.Context, owner string, filename string) (*storage.Reader, models.FileMetadata, error) {
+	uploader, err := h.newUploader(owner)
+	if err != nil {
+		return nil, models.FileMetadata{}, err
 	}
+	return uploader.OpenFile(ctx, filename)
+}
+
+// markAccessed records that a GET read the file; HEAD requests do not count
+func (h *Handler) markAccessed(c echo.Context, metadata models.FileMetadata) {
+	if metadata.FileId == "" || c.Request().Method != http.MethodGet {
+		return
+	}
+	if err := h.meta.MarkAccessed(c.Request().Context(), metadata.FileId); err != nil {
+		log.Printf("failed to record access to %v: %v", metadata.FileName, err)
+	}
+}
+
+// serveFile answers a GET or HEAD for a stored file. http.ServeContent does
+// the protocol work: single and multi-range requests, If-Range and the
+// If-None-Match/If-Modified-Since checks, given the validators set here.
+func serveFile(c echo.Context, reader *storage.Reader, metadata models.FileMetadata, filename string) {
+	header := c.Response().Header()
+	if etag := contentETag(metadata); etag != "" {
+		header.Set("ETag", etag)
+	}
+	// without a stored type ServeContent guesses from the name or content
+	if metadata.ContentType != "" {
+		header.Set(echo.HeaderContentType, metadata.ContentType)
+	}
+
+	http.ServeContent(c.Response(), c.Request(), filename, contentModTime(reader, metadata), reader)
+}
 
-	// Open and return the file
-	return c.File(filePath)
+// contentModTime is the Last-Modified time serveFile answers with
+func contentModTime(reader *storage.Reader, metadata models.FileMetadata) time.Time {
+	if metadata.UpdatedAt.Unix() > 0 {
+		return metadata.UpdatedAt
+	}
+	return reader.Info.ModTime
 }
 
+// contentETag is a strong validator derived from the content hash, so it
+// changes exactly when the content does
+func contentETag(metadata models.FileMetadata) string {
+	switch {
+	case metadata.SHA256Hash != "":
+		return `"` + metadata.SHA256Hash + `"`
+	case metadata.MD5Hash != "":
+		return `"` + metadata.MD5Hash + `"`
+	}
+	return ""
+}
+
+// deleteFile moves a file into its owner's trash
 func (h *Handler) deleteFile(c echo.Context) error {
-	ctx := context.Background()
+	ctx := c.Request().Context()
 	username := c.Param("username")
 	filename := c.Param("filename")
-	basePath := h.cfg.BasePath
 
-	// Create uploader instance to access metadata
-	uploader, err := localstorage.NewUploader(basePath, username, h.db)
+	uploader, err := h.newUploader(username)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, "failed to create uploader")
 	}
+	uploader.Author = author(c, username)
 
-	filePath := filepath.Join(uploader.BasePath, filename)
+	unlock := h.locks.Lock(username, filename)
+	defer unlock()
 
-	err = uploader.DeleteFile(ctx, filePath)
+	item, err := uploader.TrashFile(ctx, filename)
+	if errors.Is(err, storage.ErrNotExist) {
+		return c.String(http.StatusNotFound, "file not found")
+	}
 	if err != nil {
-		fmt.Printf("failed to delete file: %v", err)
+		log.Printf("failed to delete file: %v", err)
 		return c.String(http.StatusInternalServerError, "failed to delete file")
 	}
 
-	fmt.Printf("file deleted: %v", filePath)
-	return c.NoContent(http.StatusOK)
-}
-
-func (h *Handler) updateFile(c echo.Context) error {
-
-	return nil
+	log.Printf("file deleted: %v", filename)
+	if item.TrashId == "" {
+		return c.NoContent(http.StatusOK)
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"trashId": item.TrashId,
+	})
 }
-
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/config"
+	"github.com/Iwoooooods/fs-upload-go/internal/database"
+	"github.com/Iwoooooods/fs-upload-go/internal/storage"
+	"github.com/labstack/echo/v4"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestServer(t *testing.T) (*echo.Echo, *config.Config) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// every connection of an in-memory database is a new database
+	db.SetMaxOpenConns(1)
+
+	if err := database.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	cfg := &config.Config{
+		BasePath:            t.TempDir(),
+		ServerHost:          "http://localhost",
+		TusExpiration:       time.Hour,
+		MultipartExpiration: time.Hour,
+		CleanupInterval:     time.Minute,
+		JWTHMACSecret:       TEST_JWT_SECRET,
+		StreamTokenTTL:      time.Minute,
+		StreamTokenMaxTTL:   time.Hour,
+		PresignKeys:         "old:old secret,new:new secret",
+		PresignKeyId:        "new",
+		PresignMaxExpiry:    24 * time.Hour,
+		APIKeyFlushInterval: time.Minute,
+	}
+	e := echo.New()
+	backend := storage.NewLocalStorage(filepath.Join(cfg.BasePath, ".blobs"))
+	handler, err := NewHandler(cfg, db, backend)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	handler.RegisterRoutes(e.Group("/api"))
+	return e, cfg
+}
+
+func TestUploadDeduplication(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	upload := func(user string, target string) map[string]any {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader("duplicated content"))
+		authorize(req, user)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return result
+	}
+
+	first := upload("alice", "/api/upload/alice/a.txt")
+	if first["exists"] != false {
+		t.Fatalf("expected new content, got %v", first)
+	}
+	second := upload("bob", "/api/upload/bob/b.txt")
+	if second["exists"] != true || second["fileId"] != first["fileId"] {
+		t.Fatalf("expected the existing file %v, got %v", first["fileId"], second)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/delete/alice/a.txt", nil)
+	authorize(req, "alice")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	if code, content := downloadContent(e, "bob", "b.txt"); code != http.StatusOK || content != "duplicated content" {
+		t.Fatalf("expected the shared content to survive, got %d %q", code, content)
+	}
+	if code, _ := downloadContent(e, "alice", "a.txt"); code != http.StatusNotFound {
+		t.Fatalf("expected the deleted file to be gone, got %d", code)
+	}
+}
+
+func downloadContent(e *echo.Echo, username string, filename string) (int, string) {
+	req := httptest.NewRequest(http.MethodGet, "/api/download/"+username+"/"+filename, nil)
+	authorize(req, username)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.String()
+}
+
+func TestDownloadRangesAndConditionals(t *testing.T) {
+	e, _ := newTestServer(t)
+	uploadContent(t, e, "alice", "video.mp4", "0123456789abcdef")
+
+	download := func(method string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/download/alice/video.mp4", nil)
+		authorize(req, "alice")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	full := download(http.MethodGet, nil)
+	if full.Code != http.StatusOK || full.Body.String() != "0123456789abcdef" {
+		t.Fatalf("expected the whole file, got %d %q", full.Code, full.Body.String())
+	}
+	etag := full.Header().Get("ETag")
+	lastModified := full.Header().Get(echo.HeaderLastModified)
+	if len(etag) != 66 || lastModified == "" {
+		t.Fatalf("expected a SHA-256 ETag and Last-Modified, got %q %q", etag, lastModified)
+	}
+	if contentType := full.Header().Get(echo.HeaderContentType); contentType != "video/mp4" {
+		t.Fatalf("expected the stored content type, got %q", contentType)
+	}
+	if full.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatal("expected Accept-Ranges: bytes")
+	}
+
+	t.Run("single range", func(t *testing.T) {
+		rec := download(http.MethodGet, map[string]string{"Range": "bytes=2-5"})
+		if rec.Code != http.StatusPartialContent || rec.Body.String() != "2345" {
+			t.Fatalf("expected 206 with 2345, got %d %q", rec.Code, rec.Body.String())
+		}
+		if contentRange := rec.Header().Get("Content-Range"); contentRange != "bytes 2-5/16" {
+			t.Fatalf("unexpected Content-Range %q", contentRange)
+		}
+	})
+
+	t.Run("multiple ranges", func(t *testing.T) {
+		rec := download(http.MethodGet, map[string]string{"Range": "bytes=0-1,14-"})
+		if rec.Code != http.StatusPartialContent {
+			t.Fatalf("expected 206, got %d", rec.Code)
+		}
+		mediaType, params, err := mime.ParseMediaType(rec.Header().Get(echo.HeaderContentType))
+		if err != nil || mediaType != "multipart/byteranges" {
+			t.Fatalf("expected multipart/byteranges, got %q", rec.Header().Get(echo.HeaderContentType))
+		}
+		parts := multipart.NewReader(rec.Body, params["boundary"])
+		for _, want := range []string{"01", "ef"} {
+			part, err := parts.NextPart()
+			if err != nil {
+				t.Fatalf("expected a part: %v", err)
+			}
+			if part.Header.Get(echo.HeaderContentType) != "video/mp4" {
+				t.Fatalf("unexpected part type %q", part.Header.Get(echo.HeaderContentType))
+			}
+			content, _ := io.ReadAll(part)
+			if string(content) != want {
+				t.Fatalf("expected %q, got %q", want, content)
+			}
+		}
+	})
+
+	t.Run("unsatisfiable range", func(t *testing.T) {
+		if rec := download(http.MethodGet, map[string]string{"Range": "bytes=100-"}); rec.Code != http.StatusRequestedRangeNotSatisfiable {
+			t.Fatalf("expected 416, got %d", rec.Code)
+		}
+	})
+
+	t.Run("if-range", func(t *testing.T) {
+		rec := download(http.MethodGet, map[string]string{"Range": "bytes=0-3", "If-Range": etag})
+		if rec.Code != http.StatusPartialContent || rec.Body.String() != "0123" {
+			t.Fatalf("expected the range for a matching validator, got %d %q", rec.Code, rec.Body.String())
+		}
+		rec = download(http.MethodGet, map[string]string{"Range": "bytes=0-3", "If-Range": `"stale"`})
+		if rec.Code != http.StatusOK || rec.Body.Len() != 16 {
+			t.Fatalf("expected the whole file for a stale validator, got %d %q", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		if rec := download(http.MethodGet, map[string]string{"If-None-Match": etag}); rec.Code != http.StatusNotModified {
+			t.Fatalf("expected 304 for a matching ETag, got %d", rec.Code)
+		}
+		if rec := download(http.MethodGet, map[string]string{"If-Modified-Since": lastModified}); rec.Code != http.StatusNotModified {
+			t.Fatalf("expected 304 for an unmodified file, got %d", rec.Code)
+		}
+		if rec := download(http.MethodGet, map[string]string{"If-None-Match": `"stale"`}); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 for a stale ETag, got %d", rec.Code)
+		}
+	})
+
+	t.Run("changed content", func(t *testing.T) {
+		uploadContent(t, e, "alice", "video.mp4", "new content")
+		rec := download(http.MethodGet, map[string]string{"If-None-Match": etag})
+		if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+			t.Fatalf("expected the new content with a new ETag, got %d", rec.Code)
+		}
+	})
+
+	t.Run("head", func(t *testing.T) {
+		rec := download(http.MethodHead, nil)
+		if rec.Code != http.StatusOK || rec.Body.Len() != 0 || rec.Header().Get(echo.HeaderContentLength) != "11" {
+			t.Fatalf("expected headers only, got %d %v", rec.Code, rec.Header())
+		}
+	})
+}
@@ -0,0 +1,372 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/Iwoooooods/fs-upload-go/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// SHARE_PASSWORD_HEADER carries the password of a protected share link; the
+// password of HTTP basic authentication is accepted as well, so that
+// browsers can prompt for it
+const SHARE_PASSWORD_HEADER = "X-Share-Password"
+
+type createShareLinkRequest struct {
+	FileName string `json:"fileName"`
+	// ExpiresAt is optional and must be in the future
+	ExpiresAt *time.Time `json:"expiresAt"`
+	// Password is optional and stored hashed
+	Password string `json:"password"`
+	// MaxDownloads limits how often the file may be downloaded, 0 for no limit
+	MaxDownloads int `json:"maxDownloads"`
+}
+
+func (h *Handler) registerShareLinkRoutes(e *echo.Group) {
+	e.POST("/share-links/:username", h.createShareLink)
+	e.GET("/share-links/:username", h.listShareLinks)
+	e.DELETE("/share-links/:username/:linkid", h.revokeShareLink)
+	e.GET("/share-links/:username/:linkid/accesses", h.listShareLinkAccesses)
+}
+
+func (h *Handler) registerPublicShareRoutes(e *echo.Group) {
+	e.GET("/s/:token", h.downloadSharedLink)
+	e.HEAD("/s/:token", h.downloadSharedLink)
+}
+
+func (h *Handler) shareLinkURL(token string) string {
+	return h.cfg.ServerHost + API_PREFIX + "/s/" + token
+}
+
+// shareLinkResponse describes a link without its token, which is only
+// returned once on creation
+func shareLinkResponse(link models.ShareLink) map[string]any {
+	var expiresAt, revokedAt any
+	if !link.ExpiresAt.IsZero() {
+		expiresAt = link.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if link.Revoked() {
+		revokedAt = link.RevokedAt.UTC().Format(time.RFC3339)
+	}
+	return map[string]any{
+		"linkId":        link.LinkId,
+		"fileName":      link.FileName,
+		"hasPassword":   link.PasswordHash != "",
+		"expiresAt":     expiresAt,
+		"maxDownloads":  link.MaxDownloads,
+		"downloadCount": link.DownloadCount,
+		"createdAt":     link.CreatedAt.UTC().Format(time.RFC3339),
+		"revokedAt":     revokedAt,
+	}
+}
+
+func (h *Handler) createShareLink(c echo.Context) error {
+	ctx := c.Request().Context()
+	username := c.Param("username")
+
+	var req createShareLinkRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+	if req.FileName == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "fileName is required",
+		})
+	}
+	opts := services.ShareLinkOptions{
+		Password:     req.Password,
+		MaxDownloads: req.MaxDownloads,
+	}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "expiresAt must be in the future",
+			})
+		}
+		opts.ExpiresAt = req.ExpiresAt.UTC()
+	}
+	if req.MaxDownloads < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "maxDownloads must not be negative",
+		})
+	}
+
+	_, err := h.meta.GetMetadataByName(ctx, username, req.FileName)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "file not found",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to load metadata: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to create share link",
+		})
+	}
+
+	token, link, err := h.links.Create(ctx, username, req.FileName, opts)
+	if err != nil {
+		log.Printf("failed to create share link: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to create share link",
+		})
+	}
+
+	response := shareLinkResponse(link)
+	response["url"] = h.shareLinkURL(token)
+	return c.JSON(http.StatusCreated, response)
+}
+
+func (h *Handler) listShareLinks(c echo.Context) error {
+	links, err := h.links.List(c.Request().Context(), c.Param("username"))
+	if err != nil {
+		log.Printf("failed to list share links: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to list share links",
+		})
+	}
+
+	response := make([]map[string]any, 0, len(links))
+	for _, link := range links {
+		response = append(response, shareLinkResponse(link))
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"links": response,
+	})
+}
+
+func (h *Handler) revokeShareLink(c echo.Context) error {
+	err := h.links.Revoke(c.Request().Context(), c.Param("username"), c.Param("linkid"))
+	if errors.Is(err, services.ErrShareLinkNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "share link not found",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to revoke share link: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to revoke share link",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) listShareLinkAccesses(c echo.Context) error {
+	accesses, err := h.links.Accesses(c.Request().Context(), c.Param("username"), c.Param("linkid"))
+	if err != nil {
+		log.Printf("failed to list share link accesses: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to list share link accesses",
+		})
+	}
+
+	response := make([]map[string]any, 0, len(accesses))
+	for _, access := range accesses {
+		response = append(response, map[string]any{
+			"method":     access.Method,
+			"remoteAddr": access.RemoteAddr,
+			"userAgent":  access.UserAgent,
+			"accessedAt": access.AccessedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"accesses": response,
+	})
+}
+
+// downloadSharedLink serves the file of a share link to anyone holding it.
+// Only a GET that sends the file from its start counts as one download;
+// HEAD, revalidations and resumed ranges do not. All of them are recorded.
+func (h *Handler) downloadSharedLink(c echo.Context) error {
+	ctx := c.Request().Context()
+	password := c.Request().Header.Get(SHARE_PASSWORD_HEADER)
+	if password == "" {
+		if _, basicPassword, ok := c.Request().BasicAuth(); ok {
+			password = basicPassword
+		}
+	}
+
+	link, err := h.links.Open(ctx, c.Param("token"), password)
+	switch {
+	case errors.Is(err, services.ErrShareLinkNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "share link not found",
+		})
+	case errors.Is(err, services.ErrShareLinkExpired):
+		return c.JSON(http.StatusGone, map[string]string{
+			"error": "share link has expired",
+		})
+	case errors.Is(err, services.ErrPasswordRequired), errors.Is(err, services.ErrWrongLinkPassword):
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="share link"`)
+		return c.JSON(http.StatusUnauthorized, map[string]string{
+			"error": err.Error(),
+		})
+	case err != nil:
+		log.Printf("failed to open share link: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to open share link",
+		})
+	}
+
+	reader, metadata, err := h.openFile(ctx, link.Owner, link.FileName)
+	if errors.Is(err, storage.ErrNotExist) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "file not found",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to open file: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to open file",
+		})
+	}
+	defer reader.Close()
+
+	err = h.links.Redeem(ctx, link, models.ShareLinkAccess{
+		Method:     c.Request().Method,
+		RemoteAddr: c.RealIP(),
+		UserAgent:  c.Request().UserAgent(),
+	}, fullDownload(c.Request(), contentETag(metadata), contentModTime(reader, metadata), reader.Info.Size))
+	if errors.Is(err, services.ErrShareLinkExpired) {
+		return c.JSON(http.StatusGone, map[string]string{
+			"error": "share link has expired",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to redeem share link: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to open share link",
+		})
+	}
+
+	h.markAccessed(c, metadata)
+	serveFile(c, reader, metadata, link.FileName)
+	return nil
+}
+
+// fullDownload reports whether http.ServeContent answers req with the file
+// from its start: neither 304, 412 nor 416, and either the whole file or
+// ranges of size bytes of which one starts at 0
+func fullDownload(req *http.Request, etag string, modTime time.Time, size int64) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+	if match := req.Header.Get("If-Match"); match != "" && !etagListed(match, etag, false) {
+		return false
+	}
+	if noneMatch := req.Header.Get("If-None-Match"); noneMatch != "" {
+		if etagListed(noneMatch, etag, true) {
+			return false
+		}
+	} else if since, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil && modTime.Unix() > 0 && !modTime.Truncate(time.Second).After(since) {
+		return false
+	}
+
+	ranges := req.Header.Get("Range")
+	if ranges == "" {
+		return true
+	}
+	// a stale If-Range makes the range fall back to the whole file
+	if ifRange := req.Header.Get("If-Range"); ifRange != "" {
+		if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+			if etag == "" || ifRange != etag {
+				return true
+			}
+		} else if since, err := http.ParseTime(ifRange); err != nil || !modTime.Truncate(time.Second).Equal(since) {
+			return true
+		}
+	}
+	return rangesFromStart(ranges, size)
+}
+
+// rangesFromStart parses a Range header the way http.ServeContent does and
+// reports whether the response sends byte 0 of a file of size bytes
+func rangesFromStart(header string, size int64) bool {
+	specs, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return false
+	}
+	var served, total int64
+	fromStart, noOverlap := false, false
+	for _, spec := range strings.Split(specs, ",") {
+		spec = textproto.TrimString(spec)
+		if spec == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return false
+		}
+		first, last = textproto.TrimString(first), textproto.TrimString(last)
+
+		var start, length int64
+		if first == "" {
+			// a suffix of the file, the whole of it when longer
+			if last == "" || last[0] == '-' {
+				return false
+			}
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return false
+			}
+			start = size - min(n, size)
+			length = size - start
+		} else {
+			n, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || n < 0 {
+				return false
+			}
+			if n >= size {
+				noOverlap = true
+				continue
+			}
+			start = n
+			length = size - start
+			if last != "" {
+				end, err := strconv.ParseInt(last, 10, 64)
+				if err != nil || start > end {
+					return false
+				}
+				length = min(end, size-1) - start + 1
+			}
+		}
+		served++
+		total += length
+		fromStart = fromStart || start == 0
+	}
+	// ranges all past the end get 416, while no ranges at all or ranges
+	// adding up to more than the file send the whole of it
+	if served == 0 {
+		return !noOverlap
+	}
+	return fromStart || total > size
+}
+
+// etagListed reports whether etag is among the comma separated list of a
+// conditional header, comparing weakly or strongly
+func etagListed(list string, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if etag != "" && candidate == etag {
+			return true
+		}
+	}
+	return false
+}
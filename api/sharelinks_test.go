@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// createShareLink creates a link with the given request body and returns its
+// response
+func createShareLink(t *testing.T, e *echo.Echo, owner string, body string) map[string]any {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/share-links/"+owner, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	authorize(req, owner)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	return result
+}
+
+func TestShareLinks(t *testing.T) {
+	e, _ := newTestServer(t)
+	uploadContent(t, e, "alice", "deck.pdf", "slides")
+
+	fetch := func(method string, url string, prepare func(req *http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, strings.TrimPrefix(url, "http://localhost"), nil)
+		if prepare != nil {
+			prepare(req)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("limited downloads", func(t *testing.T) {
+		link := createShareLink(t, e, "alice", `{"fileName": "deck.pdf", "maxDownloads": 2}`)
+		url := link["url"].(string)
+
+		if rec := fetch(http.MethodHead, url, nil); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		for i := 0; i < 2; i++ {
+			rec := fetch(http.MethodGet, url, nil)
+			if rec.Code != http.StatusOK || rec.Body.String() != "slides" {
+				t.Fatalf("expected the file, got %d %q", rec.Code, rec.Body.String())
+			}
+		}
+		if rec := fetch(http.MethodGet, url, nil); rec.Code != http.StatusGone {
+			t.Fatalf("expected 410 once the downloads are used up, got %d", rec.Code)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/share-links/alice/"+link["linkId"].(string)+"/accesses", nil)
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var result struct {
+			Accesses []map[string]any `json:"accesses"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		if len(result.Accesses) != 3 {
+			t.Fatalf("expected 3 recorded accesses, got %v", result.Accesses)
+		}
+	})
+
+	t.Run("password", func(t *testing.T) {
+		link := createShareLink(t, e, "alice", `{"fileName": "deck.pdf", "password": "s3cret"}`)
+		url := link["url"].(string)
+		if link["hasPassword"] != true {
+			t.Fatalf("expected the link to have a password, got %v", link)
+		}
+
+		rec := fetch(http.MethodGet, url, nil)
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get(echo.HeaderWWWAuthenticate) == "" {
+			t.Fatalf("expected 401 with a challenge, got %d", rec.Code)
+		}
+		rec = fetch(http.MethodGet, url, func(req *http.Request) { req.Header.Set(SHARE_PASSWORD_HEADER, "wrong") })
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", rec.Code)
+		}
+		rec = fetch(http.MethodGet, url, func(req *http.Request) { req.SetBasicAuth("", "s3cret") })
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		link := createShareLink(t, e, "alice", `{"fileName": "deck.pdf"}`)
+		req := httptest.NewRequest(http.MethodDelete, "/api/share-links/alice/"+link["linkId"].(string), nil)
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", rec.Code)
+		}
+		if rec := fetch(http.MethodGet, link["url"].(string), nil); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", rec.Code)
+		}
+	})
+
+	t.Run("listing", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/share-links/alice", nil)
+		authorize(req, "alice")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var result struct {
+			Links []map[string]any `json:"links"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		if len(result.Links) != 3 {
+			t.Fatalf("expected 3 links, got %v", result.Links)
+		}
+		if _, ok := result.Links[0]["url"]; ok {
+			t.Fatal("expected listed links not to reveal their URL")
+		}
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+		for body, want := range map[string]int{
+			`{"fileName": "missing.pdf"}`:                           http.StatusNotFound,
+			`{"fileName": "deck.pdf", "expiresAt": "` + past + `"}`: http.StatusBadRequest,
+			`{"fileName": "deck.pdf", "maxDownloads": -1}`:          http.StatusBadRequest,
+		} {
+			req := httptest.NewRequest(http.MethodPost, "/api/share-links/alice", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			authorize(req, "alice")
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != want {
+				t.Fatalf("expected %d for %s, got %d", want, body, rec.Code)
+			}
+		}
+		if rec := fetch(http.MethodGet, "/api/s/unknown", nil); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", rec.Code)
+		}
+	})
+}
+
+func TestShareLinkDownloadCount(t *testing.T) {
+	e, _ := newTestServer(t)
+	uploadContent(t, e, "alice", "deck.pdf", "slides")
+
+	fetch := func(url string, prepare func(req *http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, strings.TrimPrefix(url, "http://localhost"), nil)
+		if prepare != nil {
+			prepare(req)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	link := createShareLink(t, e, "alice", `{"fileName": "deck.pdf", "maxDownloads": 1}`)
+	url := link["url"].(string)
+
+	rec := fetch(url, func(req *http.Request) { req.Header.Set("Range", "bytes=2-") })
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "ides" {
+		t.Fatalf("expected the rest of the file, got %d %q", rec.Code, rec.Body.String())
+	}
+	etag := rec.Header().Get("ETag")
+	if rec := fetch(url, func(req *http.Request) { req.Header.Set("If-None-Match", etag) }); rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rec.Code)
+	}
+
+	// a stale If-Range sends the whole file, which counts
+	rec = fetch(url, func(req *http.Request) {
+		req.Header.Set("Range", "bytes=2-")
+		req.Header.Set("If-Range", `"stale"`)
+	})
+	if rec.Code != http.StatusOK || rec.Body.String() != "slides" {
+		t.Fatalf("expected the file, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := fetch(url, nil); rec.Code != http.StatusGone {
+		t.Fatalf("expected 410 once the download is used up, got %d", rec.Code)
+	}
+
+	// ranges that send the file from its start count like a plain download
+	for _, ranges := range []string{"bytes=0-", "bytes=00-", "bytes=-999999999", "bytes=0-2,3-", "bytes=2-,1-", "bytes=,"} {
+		link := createShareLink(t, e, "alice", `{"fileName": "deck.pdf", "maxDownloads": 1}`)
+		url := link["url"].(string)
+		if rec := fetch(url, func(req *http.Request) { req.Header.Set("Range", ranges) }); rec.Code != http.StatusOK && rec.Code != http.StatusPartialContent {
+			t.Fatalf("%v: expected the file, got %d", ranges, rec.Code)
+		}
+		if rec := fetch(url, nil); rec.Code != http.StatusGone {
+			t.Fatalf("%v: expected the download to count, got %d", ranges, rec.Code)
+		}
+	}
+}
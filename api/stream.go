@@ -0,0 +1,130 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+// STREAM_TOKEN_HEADER and STREAM_TOKEN_QUERY carry a stream token, the query
+// parameter being for clients such as <video> tags that cannot set headers
+const (
+	STREAM_TOKEN_HEADER = "X-Stream-Token"
+	STREAM_TOKEN_QUERY  = "stream_token"
+)
+
+type mintStreamTokenRequest struct {
+	// ExpiresIn is the lifetime in seconds, STREAM_TOKEN_TTL by default
+	ExpiresIn int `json:"expiresIn"`
+	// MaxUses limits how many requests the token may serve, 0 for no limit
+	MaxUses int `json:"maxUses"`
+}
+
+func (h *Handler) registerStreamRoutes(e *echo.Group) {
+	e.POST("/stream-tokens/:username/*", h.mintStreamToken, withPath)
+}
+
+// mintStreamToken hands out a token that downloads one file without the
+// access token, e.g. from a browser media element
+func (h *Handler) mintStreamToken(c echo.Context) error {
+	ctx := c.Request().Context()
+	username := c.Param("username")
+	filename := c.Param("filename")
+
+	var req mintStreamTokenRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+	ttl := h.cfg.StreamTokenTTL
+	if req.ExpiresIn != 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if ttl <= 0 || ttl > h.cfg.StreamTokenMaxTTL {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "expiresIn must be positive and at most " + h.cfg.StreamTokenMaxTTL.String(),
+		})
+	}
+	if req.MaxUses < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "maxUses must not be negative",
+		})
+	}
+
+	_, err := h.meta.GetMetadataByName(ctx, username, filename)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "file not found",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to load metadata: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to create stream token",
+		})
+	}
+
+	token, streamToken, err := h.streams.Mint(ctx, username, filename, ttl, req.MaxUses)
+	if err != nil {
+		log.Printf("failed to mint stream token: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to create stream token",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]any{
+		"token":     token,
+		"expiresAt": streamToken.ExpiresAt.Format(time.RFC3339),
+		"maxUses":   streamToken.MaxUses,
+		"url":       h.downloadURL(username, filename) + "?" + STREAM_TOKEN_QUERY + "=" + url.QueryEscape(token),
+	})
+}
+
+// streamTokenOr lets a stream token for the requested file stand in for the
+// credentials checked by fallback. Every request served counts as one use of
+// the token, including each range request of a seeking player.
+func (h *Handler) streamTokenOr(fallback echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		otherwise := fallback(next)
+		return func(c echo.Context) error {
+			token := c.Request().Header.Get(STREAM_TOKEN_HEADER)
+			if token == "" {
+				token = c.QueryParam(STREAM_TOKEN_QUERY)
+			}
+			if token == "" {
+				return otherwise(c)
+			}
+			// the token grants the file as it is now, not its earlier versions
+			if c.QueryParam("versionId") != "" {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "versionId is not allowed with a stream token",
+				})
+			}
+
+			err := h.streams.Redeem(c.Request().Context(), token, c.Param("username"), c.Param("filename"))
+			if errors.Is(err, services.ErrInvalidStreamToken) {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "invalid stream token",
+				})
+			}
+			if err != nil {
+				log.Printf("failed to redeem stream token: %v", err)
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error": "failed to check stream token",
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+func (h *Handler) downloadURL(username string, filename string) string {
+	return h.cfg.ServerHost + (&url.URL{Path: API_PREFIX + "/download/" + username + "/" + filename}).EscapedPath()
+}
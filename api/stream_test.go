@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func mintStreamToken(e *echo.Echo, subject string, target string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	authorize(req, subject)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestStreamTokens(t *testing.T) {
+	e, _ := newTestServer(t)
+	uploadContent(t, e, "alice", "movie.mp4", "moving pictures")
+	uploadContent(t, e, "alice", "other.mp4", "other pictures")
+
+	stream := func(target string, header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Range", "bytes=0-5")
+		if header != "" {
+			req.Header.Set(STREAM_TOKEN_HEADER, header)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := mintStreamToken(e, "alice", "/api/stream-tokens/alice/movie.mp4", `{"maxUses": 2}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var minted struct {
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &minted)
+	link, err := url.Parse(minted.URL)
+	if err != nil || link.Query().Get(STREAM_TOKEN_QUERY) != minted.Token {
+		t.Fatalf("expected a download URL carrying the token, got %q", minted.URL)
+	}
+
+	if rec := stream("/api/download/alice/other.mp4", minted.Token); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the token to be limited to its file, got %d", rec.Code)
+	}
+	if rec := stream(link.RequestURI(), ""); rec.Code != http.StatusPartialContent || rec.Body.String() != "moving" {
+		t.Fatalf("expected to stream with the query parameter, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := stream("/api/download/alice/movie.mp4", minted.Token); rec.Code != http.StatusPartialContent {
+		t.Fatalf("expected to stream with the header, got %d", rec.Code)
+	}
+	if rec := stream(link.RequestURI(), ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the token to be used up, got %d", rec.Code)
+	}
+
+	t.Run("unlimited", func(t *testing.T) {
+		rec := mintStreamToken(e, "alice", "/api/stream-tokens/alice/movie.mp4", "")
+		json.Unmarshal(rec.Body.Bytes(), &minted)
+		for i := 0; i < 5; i++ {
+			if rec := stream("/api/download/alice/movie.mp4", minted.Token); rec.Code != http.StatusPartialContent {
+				t.Fatalf("expected request %d to be served, got %d", i, rec.Code)
+			}
+		}
+	})
+
+	t.Run("earlier versions", func(t *testing.T) {
+		uploadContent(t, e, "alice", "movie.mp4", "new pictures")
+		rec := mintStreamToken(e, "alice", "/api/stream-tokens/alice/movie.mp4", "")
+		json.Unmarshal(rec.Body.Bytes(), &minted)
+		versions := versionIds(t, e, "alice", "movie.mp4")
+		target := "/api/download/alice/movie.mp4?versionId=" + url.QueryEscape(versions[len(versions)-1])
+		if rec := stream(target, minted.Token); rec.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", rec.Code)
+		}
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		if rec := stream("/api/download/alice/movie.mp4", "forged"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", rec.Code)
+		}
+	})
+
+	t.Run("minting", func(t *testing.T) {
+		tests := []struct {
+			subject string
+			target  string
+			body    string
+			want    int
+		}{
+			{"bob", "/api/stream-tokens/alice/movie.mp4", "", http.StatusForbidden},
+			{"alice", "/api/stream-tokens/alice/missing.mp4", "", http.StatusNotFound},
+			{"alice", "/api/stream-tokens/alice/movie.mp4", `{"expiresIn": 86400}`, http.StatusBadRequest},
+			{"alice", "/api/stream-tokens/alice/movie.mp4", `{"expiresIn": -1}`, http.StatusBadRequest},
+			{"alice", "/api/stream-tokens/alice/movie.mp4", `{"maxUses": -1}`, http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			if rec := mintStreamToken(e, tt.subject, tt.target, tt.body); rec.Code != tt.want {
+				t.Fatalf("%v %v %v: expected %d, got %d", tt.subject, tt.target, tt.body, tt.want, rec.Code)
+			}
+		}
+	})
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/auth"
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/Iwoooooods/fs-upload-go/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	ACTION_COPY = "copy"
+	ACTION_MOVE = "move"
+)
+
+type transferRequest struct {
+	// Username receives the file, the file's owner by default
+	Username string `json:"username"`
+	// Path is where the file goes, its current path by default
+	Path string `json:"path"`
+	// Overwrite replaces a file at the destination instead of failing
+	Overwrite bool `json:"overwrite"`
+}
+
+// registerTransferRoutes serves copy and move, addressed as an action after
+// the file's path. Copying needs read access to the file and moving needs
+// delete access; both need write access to the destination.
+func (h *Handler) registerTransferRoutes(e *echo.Group) {
+	copyAuth := h.authenticateShared(auth.SCOPE_READ)
+	moveAuth := h.authenticateShared(auth.SCOPE_DELETE)
+	e.POST("/files/:username/*", h.transferFile, withPath, withAction, func(next echo.HandlerFunc) echo.HandlerFunc {
+		copyNext, moveNext := copyAuth(next), moveAuth(next)
+		return func(c echo.Context) error {
+			if c.Param("action") == ACTION_MOVE {
+				return moveNext(c)
+			}
+			return copyNext(c)
+		}
+	})
+}
+
+// withAction splits the action off the last segment of the path, so that
+// filename is the file the action applies to
+func withAction(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		filename := c.Param("filename")
+		i := strings.LastIndex(filename, "/")
+		if i < 0 || (filename[i+1:] != ACTION_COPY && filename[i+1:] != ACTION_MOVE) {
+			return echo.ErrNotFound
+		}
+
+		names := append(append([]string(nil), c.ParamNames()...), "action")
+		values := append(append([]string(nil), c.ParamValues()...), filename[i+1:])
+		for j, name := range names {
+			if name == "filename" {
+				values[j] = filename[:i]
+			}
+		}
+		c.SetParamNames(names...)
+		c.SetParamValues(values...)
+		return next(c)
+	}
+}
+
+// transferFile copies or moves a file to another path, of its owner or of
+// another user. Content is never copied, only its metadata.
+func (h *Handler) transferFile(c echo.Context) error {
+	ctx := c.Request().Context()
+	username := c.Param("username")
+	filename := c.Param("filename")
+	action := c.Param("action")
+
+	var req transferRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+	toUser := username
+	if req.Username != "" {
+		var err error
+		if toUser, err = cleanUser(req.Username); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid user",
+			})
+		}
+	}
+	toName := filename
+	if req.Path != "" {
+		var err error
+		if toName, err = cleanPath(req.Path); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid path",
+			})
+		}
+	}
+	if toUser == username && toName == filename {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "destination is the file itself",
+		})
+	}
+
+	allowed, err := h.mayAccess(c, toUser, toName, auth.SCOPE_WRITE)
+	if err != nil {
+		log.Printf("failed to check grants: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to check access",
+		})
+	}
+	if !allowed {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "access denied to destination",
+		})
+	}
+
+	// locks are always taken in the same order, so that a copy from a to b
+	// and one from b to a cannot wait for each other
+	first, second := [2]string{username, filename}, [2]string{toUser, toName}
+	if first[0]+"/"+first[1] > second[0]+"/"+second[1] {
+		first, second = second, first
+	}
+	unlockFirst := h.locks.Lock(first[0], first[1])
+	defer unlockFirst()
+	unlockSecond := h.locks.Lock(second[0], second[1])
+	defer unlockSecond()
+
+	source, err := h.meta.GetMetadataByName(ctx, username, filename)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "file not found",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to load metadata: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to " + action + " file",
+		})
+	}
+	_, err = h.meta.GetMetadataByName(ctx, toUser, toName)
+	replaced := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("failed to load metadata: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to " + action + " file",
+		})
+	}
+	if replaced && !req.Overwrite {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "a file already exists at the destination, set overwrite to replace it",
+		})
+	}
+
+	// a move within the owner's files leaves the usage as it is, while a move
+	// to another user hands them the earlier versions too
+	err = nil
+	switch {
+	case action == ACTION_COPY:
+		err = h.checkQuota(ctx, toUser, toName, source.Size)
+	case toUser != username:
+		var size int64
+		if size, err = h.versionBytes(ctx, source.FileId); err == nil {
+			err = h.checkQuota(ctx, toUser, toName, source.Size+size)
+		}
+	}
+	if err == nil {
+		err = h.claimPath(ctx, toUser, toName)
+	}
+	var metadata models.FileMetadata
+	if err == nil {
+		metadata, err = h.transfer(c, action, username, filename, toUser, toName)
+	}
+	switch {
+	case errors.Is(err, storage.ErrNotExist):
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "file not found",
+		})
+	case errors.Is(err, repositories.ErrPathTaken):
+		return pathTaken(c)
+	case errors.Is(err, services.ErrQuotaExceeded):
+		return quotaExceeded(c)
+	case err != nil:
+		log.Printf("failed to %v file: %v", action, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to " + action + " file",
+		})
+	}
+
+	status := http.StatusCreated
+	if replaced {
+		status = http.StatusOK
+	}
+	return c.JSON(status, h.fileResponse(metadata))
+}
+
+// versionBytes is the size of the earlier versions of a file
+func (h *Handler) versionBytes(ctx context.Context, fileId string) (int64, error) {
+	versions, err := h.versions.ListVersions(ctx, fileId)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, version := range versions {
+		size += version.Size
+	}
+	return size, nil
+}
+
+func (h *Handler) transfer(c echo.Context, action string, username string, filename string, toUser string, toName string) (models.FileMetadata, error) {
+	from, err := h.newUploader(username)
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
+	from.Author = author(c, username)
+	to, err := h.newUploader(toUser)
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
+	to.Author = author(c, toUser)
+
+	if action == ACTION_MOVE {
+		return from.MoveFile(c.Request().Context(), filename, to, toName)
+	}
+	return from.CopyFile(c.Request().Context(), filename, to, toName)
+}
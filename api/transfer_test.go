@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestCopyAndMove(t *testing.T) {
+	e, _ := newTestServer(t)
+	uploadContent(t, e, "alice", "a.txt", "0123456789")
+
+	transfer := func(subject string, target string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		authorize(req, subject)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	expectUsage := func(username string, bytes float64, files float64) {
+		t.Helper()
+		usage := getUsage(t, e, username)
+		if usage["bytesUsed"] != bytes || usage["fileCount"] != files {
+			t.Fatalf("expected %v bytes in %v files for %s, got %v", bytes, files, username, usage)
+		}
+	}
+
+	t.Run("copy", func(t *testing.T) {
+		rec := transfer("alice", "/api/files/alice/a.txt/copy", `{"path": "backup/a.txt"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if code, body := downloadContent(e, "alice", "backup/a.txt"); code != http.StatusOK || body != "0123456789" {
+			t.Fatalf("expected the copy, got %d %q", code, body)
+		}
+		if code, _ := downloadContent(e, "alice", "a.txt"); code != http.StatusOK {
+			t.Fatalf("expected the original to stay, got %d", code)
+		}
+		expectUsage("alice", 20, 2)
+
+		if rec := transfer("alice", "/api/files/alice/a.txt/copy", `{"path": "backup/a.txt"}`); rec.Code != http.StatusConflict {
+			t.Fatalf("expected 409 without overwrite, got %d", rec.Code)
+		}
+		if rec := transfer("alice", "/api/files/alice/a.txt/copy", `{"path": "backup/a.txt", "overwrite": true}`); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 when overwriting, got %d: %s", rec.Code, rec.Body.String())
+		}
+		// the replaced copy is kept as a version
+		expectUsage("alice", 30, 2)
+		if rec := transfer("alice", "/api/files/alice/a.txt/copy", `{}`); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for a copy onto itself, got %d", rec.Code)
+		}
+		if rec := transfer("alice", "/api/files/alice/missing.txt/copy", `{"path": "b.txt"}`); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", rec.Code)
+		}
+		if rec := transfer("alice", "/api/files/alice/a.txt/rename", `{"path": "b.txt"}`); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for an unknown action, got %d", rec.Code)
+		}
+	})
+
+	t.Run("move within the owner's files", func(t *testing.T) {
+		grant(t, e, "alice", `{"path": "backup/a.txt", "grantee": "carol"}`)
+		rec := transfer("alice", "/api/files/alice/backup/a.txt/move", `{"path": "archive/a.txt"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if code, _ := downloadContent(e, "alice", "backup/a.txt"); code != http.StatusNotFound {
+			t.Fatalf("expected the old path to be gone, got %d", code)
+		}
+		expectUsage("alice", 30, 2)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/download/alice/archive/a.txt", nil)
+		authorize(req, "carol")
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected the grant to follow the file, got %d", rec.Code)
+		}
+	})
+
+	t.Run("move to another user", func(t *testing.T) {
+		if rec := transfer("alice", "/api/files/alice/archive/a.txt/move", `{"username": "bob"}`); rec.Code != http.StatusForbidden {
+			t.Fatalf("expected 403 without access to bob's files, got %d", rec.Code)
+		}
+
+		grant(t, e, "bob", `{"path": "inbox/", "grantee": "alice", "permission": "read-write"}`)
+		rec := transfer("alice", "/api/files/alice/archive/a.txt/move", `{"username": "bob", "path": "inbox/a.txt"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		if result["fileName"] != "inbox/a.txt" {
+			t.Fatalf("unexpected response %v", result)
+		}
+		if code, body := downloadContent(e, "bob", "inbox/a.txt"); code != http.StatusOK || body != "0123456789" {
+			t.Fatalf("expected bob to have the file, got %d %q", code, body)
+		}
+		// the file takes its version along
+		expectUsage("alice", 10, 1)
+		expectUsage("bob", 20, 1)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/download/bob/inbox/a.txt", nil)
+		authorize(req, "carol")
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("expected alice's grant to stay behind, got %d", rec.Code)
+		}
+	})
+}
+
+func TestMoveChargesVersions(t *testing.T) {
+	e, _ := newTestServer(t)
+	uploadContent(t, e, "alice", "a.txt", "first")
+	uploadContent(t, e, "alice", "a.txt", "0123456789")
+	grant(t, e, "bob", `{"path": "inbox/", "grantee": "alice", "permission": "read-write"}`)
+
+	request := func(method string, target string, body string, subject string, scopes ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		authorize(req, subject, scopes...)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// the file fits, but not together with its earlier version
+	if rec := request(http.MethodPut, "/api/quotas/bob", `{"maxBytes": 12}`, "root", "admin"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec := request(http.MethodPost, "/api/files/alice/a.txt/move", `{"username": "bob", "path": "inbox/a.txt"}`, "alice")
+	if rec.Code != http.StatusInsufficientStorage {
+		t.Fatalf("expected 507, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if code, _ := downloadContent(e, "alice", "a.txt"); code != http.StatusOK {
+		t.Fatalf("expected alice to keep the file, got %d", code)
+	}
+
+	if rec := request(http.MethodPut, "/api/quotas/bob", `{"maxBytes": 15}`, "root", "admin"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = request(http.MethodPost, "/api/files/alice/a.txt/move", `{"username": "bob", "path": "inbox/a.txt"}`, "alice")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if usage := getUsage(t, e, "bob"); usage["bytesUsed"] != float64(15) {
+		t.Fatalf("expected bob to be charged for the file and its version, got %v", usage)
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/localstorage"
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+// registerTrashRoutes serves the trash, which only its owner can see;
+// permanent deletion needs the delete scope
+func (h *Handler) registerTrashRoutes(e *echo.Group, read echo.MiddlewareFunc, write echo.MiddlewareFunc, remove echo.MiddlewareFunc) {
+	e.GET("/trash/:username", h.listTrash, read)
+	e.POST("/trash/:username/:trashid/restore", h.restoreTrashItem, write)
+	e.DELETE("/trash/:username/:trashid", h.purgeTrashItem, remove)
+}
+
+func (h *Handler) trashItemResponse(item models.TrashItem) map[string]any {
+	var purgeAt any
+	if h.cfg.TrashRetention > 0 {
+		purgeAt = item.DeletedAt.Add(h.cfg.TrashRetention).UTC().Format(time.RFC3339)
+	}
+	return map[string]any{
+		"trashId":     item.TrashId,
+		"fileId":      item.File.FileId,
+		"path":        item.File.FileName,
+		"size":        item.File.Size,
+		"contentType": item.File.ContentType,
+		"deletedAt":   item.DeletedAt.UTC().Format(time.RFC3339Nano),
+		"deletedBy":   item.DeletedBy,
+		// null when the trash is never purged
+		"purgeAt": purgeAt,
+	}
+}
+
+func (h *Handler) listTrash(c echo.Context) error {
+	items, err := h.trash.List(c.Request().Context(), c.Param("username"))
+	if err != nil {
+		log.Printf("failed to list trash: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to list trash",
+		})
+	}
+
+	response := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		response = append(response, h.trashItemResponse(item))
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"items": response,
+	})
+}
+
+// restoreTrashItem moves a deleted file back to its original path, which
+// must not have been taken by another file in the meantime
+func (h *Handler) restoreTrashItem(c echo.Context) error {
+	ctx := c.Request().Context()
+	username := c.Param("username")
+
+	item, err := h.trash.Get(ctx, username, c.Param("trashid"))
+	if errors.Is(err, services.ErrTrashItemNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "trash item not found",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to load trash item: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to restore file",
+		})
+	}
+
+	unlock := h.locks.Lock(username, item.File.FileName)
+	defer unlock()
+
+	// trashed files keep their bytes charged, so a restored one only needs
+	// room for another file
+	_, err = h.quotas.Allowance(ctx, username, item.File.Size, true)
+	if err == nil {
+		// the folders holding the file may have been deleted or moved since
+		err = h.claimPath(ctx, username, item.File.FileName)
+	}
+	var metadata models.FileMetadata
+	if err == nil {
+		var uploader *localstorage.DefaultUploader
+		uploader, err = h.newUploader(username)
+		if err == nil {
+			metadata, err = uploader.RestoreFile(ctx, item.TrashId)
+		}
+	}
+	switch {
+	case errors.Is(err, services.ErrTrashItemNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "trash item not found",
+		})
+	case errors.Is(err, localstorage.ErrFileExists):
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "a file already exists at " + item.File.FileName,
+		})
+	case errors.Is(err, repositories.ErrPathTaken):
+		return pathTaken(c)
+	case errors.Is(err, services.ErrQuotaExceeded):
+		return quotaExceeded(c)
+	case err != nil:
+		log.Printf("failed to restore file: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to restore file",
+		})
+	}
+	return c.JSON(http.StatusOK, h.fileResponse(metadata))
+}
+
+// purgeTrashItem deletes a file for good, with its versions
+func (h *Handler) purgeTrashItem(c echo.Context) error {
+	uploader, err := h.newUploader(c.Param("username"))
+	if err == nil {
+		err = uploader.PurgeTrashItem(c.Request().Context(), c.Param("trashid"))
+	}
+	if errors.Is(err, services.ErrTrashItemNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "trash item not found",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to purge trash item: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to delete file",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
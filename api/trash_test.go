@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrash(t *testing.T) {
+	e, cfg := newTestServer(t)
+	uploadContent(t, e, "alice", "draft.txt", "draft")
+	uploadContent(t, e, "alice", "keep.txt", "keep")
+
+	request := func(method string, target string, subject string, scopes ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		authorize(req, subject, scopes...)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	deleteFile := func(filename string) string {
+		t.Helper()
+		rec := request(http.MethodDelete, "/api/delete/alice/"+filename, "alice")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return result["trashId"].(string)
+	}
+	listTrash := func() []map[string]any {
+		t.Helper()
+		rec := request(http.MethodGet, "/api/trash/alice", "alice")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result struct {
+			Items []map[string]any `json:"items"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return result.Items
+	}
+
+	trashId := deleteFile("draft.txt")
+	if code, _ := downloadContent(e, "alice", "draft.txt"); code != http.StatusNotFound {
+		t.Fatalf("expected a deleted file to be gone, got %d", code)
+	}
+	items := listTrash()
+	if len(items) != 1 || items[0]["path"] != "draft.txt" || items[0]["deletedBy"] != "alice" || items[0]["deletedAt"] == nil {
+		t.Fatalf("expected the deleted file in the trash, got %+v", items)
+	}
+	if usage := getUsage(t, e, "alice"); usage["fileCount"] != float64(1) || usage["bytesUsed"] != float64(9) {
+		t.Fatalf("expected trashed files to count as bytes only, got %+v", usage)
+	}
+
+	t.Run("only the owner sees the trash", func(t *testing.T) {
+		if rec := request(http.MethodGet, "/api/trash/alice", "bob"); rec.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", rec.Code)
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		uploadContent(t, e, "alice", "draft.txt", "another draft")
+		if rec := request(http.MethodPost, "/api/trash/alice/"+trashId+"/restore", "alice"); rec.Code != http.StatusConflict {
+			t.Fatalf("expected 409 while the path is taken, got %d", rec.Code)
+		}
+		deleteFile("draft.txt")
+
+		rec := request(http.MethodPost, "/api/trash/alice/"+trashId+"/restore", "alice")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if code, content := downloadContent(e, "alice", "draft.txt"); code != http.StatusOK || content != "draft" {
+			t.Fatalf("expected the restored file, got %d %q", code, content)
+		}
+		if items := listTrash(); len(items) != 1 {
+			t.Fatalf("expected only the other draft left in the trash, got %+v", items)
+		}
+		if rec := request(http.MethodPost, "/api/trash/alice/"+trashId+"/restore", "alice"); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for a restored item, got %d", rec.Code)
+		}
+	})
+
+	t.Run("permanent delete", func(t *testing.T) {
+		id := listTrash()[0]["trashId"].(string)
+		if rec := request(http.MethodDelete, "/api/trash/alice/"+id, "alice"); rec.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", rec.Code)
+		}
+		if items := listTrash(); len(items) != 0 {
+			t.Fatalf("expected an empty trash, got %+v", items)
+		}
+		if usage := getUsage(t, e, "alice"); usage["bytesUsed"] != float64(9) {
+			t.Fatalf("expected purging to free the bytes, got %+v", usage)
+		}
+		if rec := request(http.MethodDelete, "/api/trash/alice/"+id, "alice"); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 once purged, got %d", rec.Code)
+		}
+	})
+
+	t.Run("retention", func(t *testing.T) {
+		deleteFile("keep.txt")
+		if items := listTrash(); len(items) != 1 || items[0]["purgeAt"] != nil {
+			t.Fatalf("expected no purge time without retention, got %+v", items)
+		}
+		cfg.TrashRetention = 1
+		if items := listTrash(); items[0]["purgeAt"] == nil {
+			t.Fatalf("expected a purge time, got %+v", items)
+		}
+	})
+}
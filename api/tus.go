@@ -0,0 +1,273 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	TUS_VERSION        = "1.0.0"
+	TUS_EXTENSIONS     = "creation,termination,expiration"
+	TUS_CONTENT_TYPE   = "application/offset+octet-stream"
+	TUS_EXPIRES_LAYOUT = http.TimeFormat
+)
+
+var TusHeaders = []string{"Tus-Resumable", "Tus-Version", "Tus-Extension", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Expires"}
+
+func (h *Handler) registerTusRoutes(e *echo.Group) {
+	e.OPTIONS("/tus/:userid", h.tusOptions)
+	e.POST("/tus/:userid", h.tusCreate)
+	e.HEAD("/tus/:userid/:uploadid", h.tusHead)
+	e.PATCH("/tus/:userid/:uploadid", h.tusPatch)
+	e.DELETE("/tus/:userid/:uploadid", h.tusTerminate)
+}
+
+func (h *Handler) tusOptions(c echo.Context) error {
+	header := c.Response().Header()
+	header.Set("Tus-Resumable", TUS_VERSION)
+	header.Set("Tus-Version", TUS_VERSION)
+	header.Set("Tus-Extension", TUS_EXTENSIONS)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// checkTusResumable rejects requests speaking a protocol version we don't support
+func checkTusResumable(c echo.Context) bool {
+	c.Response().Header().Set("Tus-Resumable", TUS_VERSION)
+	if c.Request().Header.Get("Tus-Resumable") != TUS_VERSION {
+		c.Response().Header().Set("Tus-Version", TUS_VERSION)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) tusCreate(c echo.Context) error {
+	if !checkTusResumable(c) {
+		return c.NoContent(http.StatusPreconditionFailed)
+	}
+	ctx := c.Request().Context()
+	userid := c.Param("userid")
+
+	length, err := strconv.ParseInt(c.Request().Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid Upload-Length",
+		})
+	}
+
+	rawMetadata := c.Request().Header.Get("Upload-Metadata")
+	metadata, err := parseTusMetadata(rawMetadata)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid Upload-Metadata",
+		})
+	}
+	filename, err := cleanPath(metadata["filename"])
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Upload-Metadata must carry a valid filename",
+		})
+	}
+
+	// the final size is known up front, so uploads that cannot fit are
+	// refused before any chunk is sent
+	if err := h.checkQuota(ctx, userid, filename, length); errors.Is(err, services.ErrQuotaExceeded) {
+		return quotaExceeded(c)
+	} else if err != nil {
+		log.Printf("failed to check quota: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to create upload",
+		})
+	}
+
+	upload, err := h.tus.CreateUpload(ctx, userid, filename, length, rawMetadata)
+	if err != nil {
+		log.Printf("failed to create tus upload: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to create upload",
+		})
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderLocation, path.Join(c.Request().URL.Path, upload.UploadId))
+	header.Set("Upload-Expires", upload.ExpiresAt.Format(TUS_EXPIRES_LAYOUT))
+
+	// an empty file is complete as soon as it is created
+	if upload.Completed() {
+		err := h.finishTusUpload(ctx, upload)
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			return quotaExceeded(c)
+		}
+		if errors.Is(err, repositories.ErrPathTaken) {
+			return pathTaken(c)
+		}
+		if err != nil {
+			log.Printf("failed to finish tus upload: %v", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "failed to store upload",
+			})
+		}
+	}
+	return c.NoContent(http.StatusCreated)
+}
+
+func (h *Handler) tusHead(c echo.Context) error {
+	if !checkTusResumable(c) {
+		return c.NoContent(http.StatusPreconditionFailed)
+	}
+	upload, status := h.loadTusUpload(c)
+	if status != 0 {
+		return c.NoContent(status)
+	}
+
+	header := c.Response().Header()
+	header.Set("Cache-Control", "no-store")
+	header.Set("Upload-Offset", strconv.FormatInt(upload.UploadOffset, 10))
+	header.Set("Upload-Length", strconv.FormatInt(upload.UploadLength, 10))
+	header.Set("Upload-Expires", upload.ExpiresAt.Format(TUS_EXPIRES_LAYOUT))
+	if upload.Metadata != "" {
+		header.Set("Upload-Metadata", upload.Metadata)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *Handler) tusPatch(c echo.Context) error {
+	if !checkTusResumable(c) {
+		return c.NoContent(http.StatusPreconditionFailed)
+	}
+	if c.Request().Header.Get(echo.HeaderContentType) != TUS_CONTENT_TYPE {
+		return c.NoContent(http.StatusUnsupportedMediaType)
+	}
+	// a PATCH racing another one on the same upload loses, instead of both
+	// writing at the offset they read
+	unlock, ok := h.tusLocks.TryLock(c.Param("userid"), c.Param("uploadid"))
+	if !ok {
+		return c.NoContent(http.StatusConflict)
+	}
+	defer unlock()
+
+	upload, status := h.loadTusUpload(c)
+	if status != 0 {
+		return c.NoContent(status)
+	}
+
+	offset, err := strconv.ParseInt(c.Request().Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if offset != upload.UploadOffset {
+		return c.NoContent(http.StatusConflict)
+	}
+
+	upload, err = h.tus.WriteChunk(c.Request().Context(), upload, c.Request().Body)
+	if err != nil {
+		log.Printf("tus upload %v interrupted at offset %v: %v", upload.UploadId, upload.UploadOffset, err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	header := c.Response().Header()
+	header.Set("Upload-Offset", strconv.FormatInt(upload.UploadOffset, 10))
+	header.Set("Upload-Expires", upload.ExpiresAt.Format(TUS_EXPIRES_LAYOUT))
+
+	// a failed finish leaves the session in place, so an empty PATCH retries it
+	if upload.Completed() {
+		err := h.finishTusUpload(c.Request().Context(), upload)
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			return c.NoContent(http.StatusInsufficientStorage)
+		}
+		if errors.Is(err, repositories.ErrPathTaken) {
+			return c.NoContent(http.StatusConflict)
+		}
+		if err != nil {
+			log.Printf("failed to finish tus upload: %v", err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) tusTerminate(c echo.Context) error {
+	if !checkTusResumable(c) {
+		return c.NoContent(http.StatusPreconditionFailed)
+	}
+	upload, status := h.loadTusUpload(c)
+	if status != 0 {
+		return c.NoContent(status)
+	}
+
+	if err := h.tus.TerminateUpload(c.Request().Context(), upload.UploadId); err != nil {
+		log.Printf("failed to terminate tus upload: %v", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// loadTusUpload returns the upload addressed by the request, or the status
+// code to answer with when it does not exist, belongs to someone else or expired
+func (h *Handler) loadTusUpload(c echo.Context) (models.TusUpload, int) {
+	upload, err := h.tus.GetUpload(c.Request().Context(), c.Param("uploadid"))
+	if err == sql.ErrNoRows {
+		return models.TusUpload{}, http.StatusNotFound
+	}
+	if err != nil {
+		log.Printf("failed to load tus upload: %v", err)
+		return models.TusUpload{}, http.StatusInternalServerError
+	}
+	if upload.Owner != c.Param("userid") {
+		return models.TusUpload{}, http.StatusNotFound
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		h.tus.TerminateUpload(c.Request().Context(), upload.UploadId)
+		return models.TusUpload{}, http.StatusGone
+	}
+	return upload, 0
+}
+
+// finishTusUpload moves a completed upload into the user's storage and
+// records its metadata, exactly like a regular upload
+func (h *Handler) finishTusUpload(ctx context.Context, upload models.TusUpload) error {
+	staged, err := h.tus.OpenUpload(upload)
+	if err != nil {
+		return err
+	}
+	defer staged.Close()
+
+	if _, _, err := h.storeUpload(ctx, upload.Owner, upload.Owner, upload.FileName, nil, staged); err != nil {
+		return err
+	}
+
+	if err := h.tus.TerminateUpload(ctx, upload.UploadId); err != nil {
+		log.Printf("failed to clean up tus upload: %v", err)
+	}
+	return nil
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma separated
+// pairs of a key and an optional base64 encoded value
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if header == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func tusRequest(e *echo.Echo, method string, target string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	authorize(req, "testuser")
+	req.Header.Set("Tus-Resumable", TUS_VERSION)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTusUpload(t *testing.T) {
+	e, _ := newTestServer(t)
+	content := []byte("hello resumable world!")
+
+	rec := tusRequest(e, http.MethodPost, "/api/tus/testuser", nil, map[string]string{
+		"Upload-Length":   "22",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("hello.txt")),
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	location := rec.Header().Get(echo.HeaderLocation)
+	if !strings.HasPrefix(location, "/api/tus/testuser/") {
+		t.Fatalf("unexpected location %q", location)
+	}
+
+	t.Run("patch first chunk", func(t *testing.T) {
+		rec := tusRequest(e, http.MethodPatch, location, content[:10], map[string]string{
+			"Content-Type":  TUS_CONTENT_TYPE,
+			"Upload-Offset": "0",
+		})
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", rec.Code)
+		}
+		if rec.Header().Get("Upload-Offset") != "10" {
+			t.Fatalf("expected offset 10, got %q", rec.Header().Get("Upload-Offset"))
+		}
+	})
+
+	t.Run("head reports offset", func(t *testing.T) {
+		rec := tusRequest(e, http.MethodHead, location, nil, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		if rec.Header().Get("Upload-Offset") != "10" || rec.Header().Get("Upload-Length") != "22" {
+			t.Fatalf("unexpected offset headers: %v", rec.Header())
+		}
+	})
+
+	t.Run("patch with stale offset conflicts", func(t *testing.T) {
+		rec := tusRequest(e, http.MethodPatch, location, content, map[string]string{
+			"Content-Type":  TUS_CONTENT_TYPE,
+			"Upload-Offset": "0",
+		})
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d", rec.Code)
+		}
+	})
+
+	t.Run("patch final chunk", func(t *testing.T) {
+		rec := tusRequest(e, http.MethodPatch, location, content[10:], map[string]string{
+			"Content-Type":  TUS_CONTENT_TYPE,
+			"Upload-Offset": "10",
+		})
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", rec.Code)
+		}
+		code, stored := downloadContent(e, "testuser", "hello.txt")
+		if code != http.StatusOK || stored != string(content) {
+			t.Fatalf("expected %q, got %d %q", content, code, stored)
+		}
+	})
+
+	t.Run("finished upload is gone", func(t *testing.T) {
+		rec := tusRequest(e, http.MethodHead, location, nil, nil)
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", rec.Code)
+		}
+	})
+}
+
+func TestTusTermination(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	rec := tusRequest(e, http.MethodPost, "/api/tus/testuser", nil, map[string]string{
+		"Upload-Length":   "100",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("big.bin")),
+	})
+	location := rec.Header().Get(echo.HeaderLocation)
+
+	rec = tusRequest(e, http.MethodDelete, location, nil, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	rec = tusRequest(e, http.MethodHead, location, nil, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestTusConcurrentPatch(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	rec := tusRequest(e, http.MethodPost, "/api/tus/testuser", nil, map[string]string{
+		"Upload-Length":   "10",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("race.txt")),
+	})
+	location := rec.Header().Get(echo.HeaderLocation)
+
+	// the first PATCH holds the upload until its body is closed
+	body, writer := io.Pipe()
+	req := httptest.NewRequest(http.MethodPatch, location, body)
+	authorize(req, "testuser")
+	req.Header.Set("Tus-Resumable", TUS_VERSION)
+	req.Header.Set("Content-Type", TUS_CONTENT_TYPE)
+	req.Header.Set("Upload-Offset", "0")
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		e.ServeHTTP(first, req)
+		close(done)
+	}()
+	if _, err := writer.Write([]byte("hello")); err != nil {
+		t.Fatalf("failed to write body: %v", err)
+	}
+
+	rec = tusRequest(e, http.MethodPatch, location, []byte("world"), map[string]string{
+		"Content-Type":  TUS_CONTENT_TYPE,
+		"Upload-Offset": "0",
+	})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rec.Code)
+	}
+
+	writer.Close()
+	<-done
+	if first.Code != http.StatusNoContent || first.Header().Get("Upload-Offset") != "5" {
+		t.Fatalf("expected 204 at offset 5, got %d %v", first.Code, first.Header())
+	}
+}
+
+// disconnectingBody sends its content, then fails like a client that went
+// away, cancelling the request
+type disconnectingBody struct {
+	content []byte
+	cancel  context.CancelFunc
+}
+
+func (b *disconnectingBody) Read(p []byte) (int, error) {
+	if len(b.content) == 0 {
+		b.cancel()
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, b.content)
+	b.content = b.content[n:]
+	return n, nil
+}
+
+func TestTusPatchDisconnect(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	rec := tusRequest(e, http.MethodPost, "/api/tus/testuser", nil, map[string]string{
+		"Upload-Length":   "10",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("cut.txt")),
+	})
+	location := rec.Header().Get(echo.HeaderLocation)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := httptest.NewRequestWithContext(ctx, http.MethodPatch, location, &disconnectingBody{content: []byte("hello"), cancel: cancel})
+	authorize(req, "testuser")
+	req.Header.Set("Tus-Resumable", TUS_VERSION)
+	req.Header.Set("Content-Type", TUS_CONTENT_TYPE)
+	req.Header.Set("Upload-Offset", "0")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	rec = tusRequest(e, http.MethodHead, location, nil, nil)
+	if rec.Header().Get("Upload-Offset") != "5" {
+		t.Fatalf("expected the received bytes to be kept, got offset %q", rec.Header().Get("Upload-Offset"))
+	}
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/localstorage"
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/Iwoooooods/fs-upload-go/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// registerVersionRoutes serves the versions of single files, which are
+// listed and restored by whoever may read or write the file. Versions are
+// downloaded with the versionId query parameter of a regular download.
+func (h *Handler) registerVersionRoutes(e *echo.Group, read echo.MiddlewareFunc, write echo.MiddlewareFunc) {
+	e.GET("/versions/:username/*", h.listVersions, withPath, read)
+	// ?versionId= names the version to restore
+	e.POST("/versions/:username/*", h.restoreVersion, withPath, write)
+}
+
+func (h *Handler) retentionPolicy() services.RetentionPolicy {
+	return services.RetentionPolicy{
+		KeepLast: h.cfg.VersionKeepLast,
+		KeepFor:  time.Duration(h.cfg.VersionKeepDays) * 24 * time.Hour,
+	}
+}
+
+func versionResponse(version models.FileVersion, current bool) map[string]any {
+	return map[string]any{
+		"versionId":   version.VersionId,
+		"size":        version.Size,
+		"md5Hash":     version.MD5Hash,
+		"sha256Hash":  version.SHA256Hash,
+		"contentType": version.ContentType,
+		"author":      version.Author,
+		"createdAt":   version.CreatedAt.UTC().Format(time.RFC3339Nano),
+		"current":     current,
+	}
+}
+
+// listVersions lists the versions of a file, newest and current first
+func (h *Handler) listVersions(c echo.Context) error {
+	ctx := c.Request().Context()
+	current, err := h.meta.GetMetadataByName(ctx, c.Param("username"), c.Param("filename"))
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "file not found",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to load metadata: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to list versions",
+		})
+	}
+
+	versions, err := h.versions.ListVersions(ctx, current.FileId)
+	if err != nil {
+		log.Printf("failed to list versions: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to list versions",
+		})
+	}
+
+	response := make([]map[string]any, 0, len(versions)+1)
+	response = append(response, versionResponse(models.FileVersion{
+		VersionId:   current.VersionId,
+		MD5Hash:     current.MD5Hash,
+		SHA256Hash:  current.SHA256Hash,
+		Size:        current.Size,
+		ContentType: current.ContentType,
+		Author:      current.Author,
+		CreatedAt:   current.UpdatedAt,
+	}, true))
+	for _, version := range versions {
+		response = append(response, versionResponse(version, false))
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"fileId":   current.FileId,
+		"fileName": current.FileName,
+		"versions": response,
+	})
+}
+
+// downloadVersion serves the version given by the versionId query parameter
+func (h *Handler) downloadVersion(c echo.Context) error {
+	filename := c.Param("filename")
+	uploader, err := h.newUploader(c.Param("username"))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "failed to open file")
+	}
+
+	reader, metadata, err := uploader.OpenVersion(c.Request().Context(), filename, c.QueryParam("versionId"))
+	if errors.Is(err, storage.ErrNotExist) {
+		return c.String(http.StatusNotFound, "file not found")
+	}
+	if errors.Is(err, localstorage.ErrVersionNotFound) {
+		return c.String(http.StatusNotFound, "version not found")
+	}
+	if err != nil {
+		log.Printf("failed to open version: %v", err)
+		return c.String(http.StatusInternalServerError, "failed to open file")
+	}
+	defer reader.Close()
+
+	serveFile(c, reader, metadata, filename)
+	return nil
+}
+
+// restoreVersion makes an earlier version current again. The content it
+// replaces is kept as a version, like on any other write.
+func (h *Handler) restoreVersion(c echo.Context) error {
+	ctx := c.Request().Context()
+	username := c.Param("username")
+	filename := c.Param("filename")
+
+	unlock := h.locks.Lock(username, filename)
+	defer unlock()
+
+	current, err := h.meta.GetMetadataByName(ctx, username, filename)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "file not found",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to load metadata: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to restore version",
+		})
+	}
+	versionId := c.QueryParam("versionId")
+	if versionId == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "versionId is required",
+		})
+	}
+	version, err := h.versions.GetVersion(ctx, current.FileId, versionId)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "version not found",
+		})
+	}
+	if err != nil {
+		log.Printf("failed to load version: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to restore version",
+		})
+	}
+
+	err = h.checkQuota(ctx, username, filename, version.Size)
+	var metadata models.FileMetadata
+	if err == nil {
+		var uploader *localstorage.DefaultUploader
+		uploader, err = h.newUploader(username)
+		if err == nil {
+			uploader.Author = author(c, username)
+			metadata, err = uploader.RestoreVersion(ctx, filename, version.VersionId)
+		}
+	}
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		return quotaExceeded(c)
+	}
+	if err != nil {
+		log.Printf("failed to restore version: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to restore version",
+		})
+	}
+
+	c.Response().Header().Set("ETag", contentETag(metadata))
+	return c.JSON(http.StatusOK, h.fileResponse(metadata))
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+type versionsResponse struct {
+	Versions []struct {
+		VersionId string `json:"versionId"`
+		Size      int64  `json:"size"`
+		Author    string `json:"author"`
+		Current   bool   `json:"current"`
+	} `json:"versions"`
+}
+
+// versionIds lists the versions of owner's filename, newest first
+func versionIds(t *testing.T, e *echo.Echo, owner string, filename string) []string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, (&url.URL{Path: "/api/versions/" + owner + "/" + filename}).EscapedPath(), nil)
+	authorize(req, owner)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result versionsResponse
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	ids := make([]string, 0, len(result.Versions))
+	for _, version := range result.Versions {
+		ids = append(ids, version.VersionId)
+	}
+	return ids
+}
+
+func TestFileVersions(t *testing.T) {
+	e, _ := newTestServer(t)
+	uploadContent(t, e, "alice", "plan.txt", "first draft")
+	grant(t, e, "alice", `{"path": "plan.txt", "grantee": "bob", "permission": "read-write"}`)
+
+	// bob overwrites alice's file through the share
+	req := httptest.NewRequest(http.MethodPost, "/api/upload/alice/plan.txt", strings.NewReader("second"))
+	authorize(req, "bob")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	request := func(method string, target string, subject string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		authorize(req, subject)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	listVersions := func() versionsResponse {
+		t.Helper()
+		rec := request(http.MethodGet, "/api/versions/alice/plan.txt", "alice")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result versionsResponse
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return result
+	}
+
+	versions := listVersions().Versions
+	if len(versions) != 2 {
+		t.Fatalf("expected 2 versions, got %+v", versions)
+	}
+	if !versions[0].Current || versions[0].Author != "bob" || versions[0].Size != 6 {
+		t.Fatalf("expected bob's write to be current, got %+v", versions[0])
+	}
+	if versions[1].Current || versions[1].Author != "alice" || versions[1].Size != 11 {
+		t.Fatalf("expected alice's first draft, got %+v", versions[1])
+	}
+	firstId := versions[1].VersionId
+
+	t.Run("download a version", func(t *testing.T) {
+		rec := request(http.MethodGet, "/api/download/alice/plan.txt?versionId="+firstId, "bob")
+		if rec.Code != http.StatusOK || rec.Body.String() != "first draft" {
+			t.Fatalf("expected the first draft, got %d %q", rec.Code, rec.Body.String())
+		}
+		if rec := request(http.MethodGet, "/api/download/alice/plan.txt?versionId=unknown", "alice"); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for an unknown version, got %d", rec.Code)
+		}
+		if rec := request(http.MethodGet, "/api/download/alice/plan.txt?versionId="+firstId, "mallory"); rec.Code != http.StatusForbidden {
+			t.Fatalf("expected 403 for other users, got %d", rec.Code)
+		}
+	})
+
+	t.Run("restore a version", func(t *testing.T) {
+		rec := request(http.MethodPost, "/api/versions/alice/plan.txt?versionId="+firstId, "alice")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if code, content := downloadContent(e, "alice", "plan.txt"); code != http.StatusOK || content != "first draft" {
+			t.Fatalf("expected the restored content, got %d %q", code, content)
+		}
+
+		versions := listVersions().Versions
+		if len(versions) != 3 {
+			t.Fatalf("expected the restore to add a version, got %+v", versions)
+		}
+		if !versions[0].Current || versions[0].VersionId == firstId || versions[0].Size != 11 {
+			t.Fatalf("expected a new current version, got %+v", versions[0])
+		}
+	})
+
+	t.Run("a file uploaded to a deleted path starts a new history", func(t *testing.T) {
+		if rec := request(http.MethodDelete, "/api/delete/alice/plan.txt", "alice"); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		uploadContent(t, e, "alice", "plan.txt", "fresh start")
+		if versions := listVersions().Versions; len(versions) != 1 {
+			t.Fatalf("expected only the new version, got %+v", versions)
+		}
+	})
+}
@@ -14,14 +14,11 @@ import (
 	"github.com/Iwoooooods/fs-upload-go/api"
 	"github.com/Iwoooooods/fs-upload-go/internal/config"
 	"github.com/Iwoooooods/fs-upload-go/internal/database"
+	"github.com/Iwoooooods/fs-upload-go/internal/localstorage"
+	"github.com/Iwoooooods/fs-upload-go/internal/storage"
 	"github.com/rs/zerolog/log"
 )
 
-const (
-	ACCESS_TOKEN_HEADER = "X-Access-Token"
-	STREAM_TOKEN_HEADER = "X-Stream-Token"
-)
-
 func main() {
 	var port string
 	flag.StringVar(&port, "port", "8080", "port to listen on")
@@ -33,8 +30,8 @@ func main() {
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins:  []string{"*"},
-		AllowHeaders:  []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, ACCESS_TOKEN_HEADER, STREAM_TOKEN_HEADER},
-		ExposeHeaders: []string{echo.HeaderContentLength, echo.HeaderContentDisposition, echo.HeaderContentEncoding},
+		AllowHeaders:  append([]string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, api.ACCESS_TOKEN_HEADER, api.STREAM_TOKEN_HEADER}, api.TusHeaders...),
+		ExposeHeaders: append([]string{echo.HeaderContentLength, echo.HeaderContentDisposition, echo.HeaderContentEncoding, echo.HeaderLocation}, api.TusHeaders...),
 	}))
 
 	cfg := config.Load(".env")
@@ -46,10 +43,57 @@ func main() {
 	}
 	defer db.Close()
 
-	router := e.Group("api")
-	apiHandler := api.NewHandler(cfg, db)
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(context.Background(), db, flag.Args()[1:]); err != nil {
+			log.Fatal().Err(err).Msg("migration failed")
+		}
+		return
+	}
+
+	// the schema is brought up to date before anything touches the database
+	if err := database.Migrate(context.Background(), db); err != nil {
+		log.Fatal().Err(err).Msg("failed to migrate database")
+	}
+
+	// files stored before metadata tracked them are recorded on the first
+	// start after the migrations, later starts skip the walk
+	backfilled, err := localstorage.BackfillMetadata(context.Background(), db, cfg.BasePath)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to backfill file metadata")
+	} else if backfilled > 0 {
+		log.Info().Int("files", backfilled).Msg("backfilled file metadata")
+	}
+	// content stored by MD5 is recorded once, for cleanup to remove it
+	recorded, err := localstorage.BackfillLegacyBlobs(context.Background(), db, cfg.BasePath)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to record legacy blobs")
+	} else if recorded > 0 {
+		log.Info().Int("blobs", recorded).Msg("recorded legacy blobs")
+	}
+
+	backend, err := storage.NewFromConfig(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create storage backend")
+	}
+	log.Info().Str("backend", cfg.StorageBackend).Msg("storing file content")
+
+	router := e.Group(api.API_PREFIX)
+	apiHandler, err := api.NewHandler(cfg, db, backend)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create api handler")
+	}
+	if cfg.AuthDisabled {
+		log.Warn().Msg("authentication is disabled, anyone can access every file")
+	}
 	apiHandler.RegisterRoutes(router)
 
+	appCtx := context.Background()
+	// listen for os interrupt signals
+	ctx, cancel := signal.NotifyContext(appCtx, os.Interrupt)
+	defer cancel()
+
+	apiHandler.StartBackgroundJobs(ctx)
+
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%s", port),
 		Handler: e,
@@ -63,15 +107,11 @@ func main() {
 		}
 	}()
 
-	appCtx := context.Background()
-	// listen for os interrupt signals
-	ctx, cancel := signal.NotifyContext(appCtx, os.Interrupt)
-	defer cancel()
-
 	// block until user interrupts the program (ctrl+c)
 	<-ctx.Done()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Error().Err(err).Msg("error during server shutdown")
 	}
+	apiHandler.FlushAPIKeyUsage(appCtx)
 }
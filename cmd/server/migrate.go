@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/database"
+	"github.com/Iwoooooods/fs-upload-go/migrations"
+)
+
+const MIGRATE_USAGE = "usage: server migrate up | down | to <version> | version"
+
+// runMigrate handles the migrate subcommand, which moves the schema without
+// starting the server
+func runMigrate(ctx context.Context, db *sql.DB, args []string) error {
+	migrator, err := database.NewMigrator(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New(MIGRATE_USAGE)
+	}
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		err = migrator.Down(ctx)
+	case "to":
+		if len(args) != 2 {
+			return errors.New(MIGRATE_USAGE)
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		err = migrator.To(ctx, version)
+	case "version":
+	default:
+		return errors.New(MIGRATE_USAGE)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version %d, latest %d\n", version, migrator.Latest())
+	return nil
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// query parameters of a pre-signed URL
+const (
+	PRESIGN_METHOD       = "method"
+	PRESIGN_EXPIRES      = "expires"
+	PRESIGN_MAX_SIZE     = "max_size"
+	PRESIGN_CONTENT_TYPE = "content_type"
+	PRESIGN_KEY_ID       = "key_id"
+	PRESIGN_SIGNATURE    = "signature"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpiredSignature = errors.New("signature expired")
+)
+
+// Presigned are the constraints a pre-signed URL grants access under
+type Presigned struct {
+	Method    string
+	Path      string
+	ExpiresAt time.Time
+	// MaxSize limits the body of an upload, 0 for no limit
+	MaxSize int64
+	// ContentType is the only Content-Type an upload may use, "" for any
+	ContentType string
+}
+
+// Signer signs and verifies URLs with HMAC-SHA256. Every configured key
+// verifies, so a key stays valid for the URLs it signed until it is removed,
+// while new URLs are signed with the active key.
+type Signer struct {
+	keys        map[string][]byte
+	activeKeyId string
+}
+
+// NewSigner parses keys given as "id:secret,id:secret"; activeKeyId signs new
+// URLs and defaults to the first key
+func NewSigner(keys string, activeKeyId string) (*Signer, error) {
+	s := &Signer{keys: map[string][]byte{}, activeKeyId: activeKeyId}
+	for _, entry := range strings.Split(keys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("invalid pre-signing key %q, expected id:secret", id)
+		}
+		if _, exists := s.keys[id]; exists {
+			return nil, fmt.Errorf("duplicate pre-signing key id %q", id)
+		}
+		s.keys[id] = []byte(secret)
+		if s.activeKeyId == "" {
+			s.activeKeyId = id
+		}
+	}
+	if len(s.keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	if _, ok := s.keys[s.activeKeyId]; !ok {
+		return nil, fmt.Errorf("active pre-signing key %q is not configured", s.activeKeyId)
+	}
+	return s, nil
+}
+
+// Sign returns the query parameters that grant p
+func (s *Signer) Sign(p Presigned) url.Values {
+	query := url.Values{}
+	query.Set(PRESIGN_METHOD, p.Method)
+	query.Set(PRESIGN_EXPIRES, strconv.FormatInt(p.ExpiresAt.Unix(), 10))
+	if p.MaxSize > 0 {
+		query.Set(PRESIGN_MAX_SIZE, strconv.FormatInt(p.MaxSize, 10))
+	}
+	if p.ContentType != "" {
+		query.Set(PRESIGN_CONTENT_TYPE, p.ContentType)
+	}
+	query.Set(PRESIGN_KEY_ID, s.activeKeyId)
+	query.Set(PRESIGN_SIGNATURE, s.signature(s.keys[s.activeKeyId], p))
+	return query
+}
+
+// Verify checks the signature in query for a request to path and returns the
+// constraints it grants. Checking the request against them is up to the caller.
+func (s *Signer) Verify(path string, query url.Values, now time.Time) (Presigned, error) {
+	key, ok := s.keys[query.Get(PRESIGN_KEY_ID)]
+	if !ok {
+		return Presigned{}, fmt.Errorf("%w: unknown key id", ErrInvalidSignature)
+	}
+
+	expires, err := strconv.ParseInt(query.Get(PRESIGN_EXPIRES), 10, 64)
+	if err != nil {
+		return Presigned{}, fmt.Errorf("%w: invalid expiry", ErrInvalidSignature)
+	}
+	p := Presigned{
+		Method:      query.Get(PRESIGN_METHOD),
+		Path:        path,
+		ExpiresAt:   time.Unix(expires, 0),
+		ContentType: query.Get(PRESIGN_CONTENT_TYPE),
+	}
+	if maxSize := query.Get(PRESIGN_MAX_SIZE); maxSize != "" {
+		if p.MaxSize, err = strconv.ParseInt(maxSize, 10, 64); err != nil || p.MaxSize <= 0 {
+			return Presigned{}, fmt.Errorf("%w: invalid max size", ErrInvalidSignature)
+		}
+	}
+
+	signature, err := hex.DecodeString(query.Get(PRESIGN_SIGNATURE))
+	if err != nil {
+		return Presigned{}, ErrInvalidSignature
+	}
+	expected, _ := hex.DecodeString(s.signature(key, p))
+	if !hmac.Equal(signature, expected) {
+		return Presigned{}, ErrInvalidSignature
+	}
+
+	// checked after the signature so that the expiry cannot be forged
+	if !now.Before(p.ExpiresAt) {
+		return Presigned{}, ErrExpiredSignature
+	}
+	return p, nil
+}
+
+// signature covers every constraint, each on its own line so that no value
+// can be shifted into another
+func (s *Signer) signature(key []byte, p Presigned) string {
+	canonical := strings.Join([]string{
+		p.Method,
+		p.Path,
+		strconv.FormatInt(p.ExpiresAt.Unix(), 10),
+		strconv.FormatInt(p.MaxSize, 10),
+		p.ContentType,
+	}, "\n")
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSigner(t *testing.T) {
+	signer, err := NewSigner("k1:first secret, k2:second secret", "k2")
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	now := time.Now()
+	presigned := Presigned{
+		Method:      "PUT",
+		Path:        "/api/upload/alice/a.png",
+		ExpiresAt:   now.Add(time.Hour).Truncate(time.Second),
+		MaxSize:     1024,
+		ContentType: "image/png",
+	}
+	query := signer.Sign(presigned)
+	if query.Get(PRESIGN_KEY_ID) != "k2" {
+		t.Fatalf("expected the active key to sign, got %q", query.Get(PRESIGN_KEY_ID))
+	}
+
+	verified, err := signer.Verify(presigned.Path, query, now)
+	if err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+	if verified != presigned {
+		t.Fatalf("expected %+v, got %+v", presigned, verified)
+	}
+
+	tamper := func(key string, value string) url.Values {
+		changed := url.Values{}
+		for k, v := range query {
+			changed[k] = v
+		}
+		if value == "" {
+			changed.Del(key)
+		} else {
+			changed.Set(key, value)
+		}
+		return changed
+	}
+	for name, q := range map[string]url.Values{
+		"method":       tamper(PRESIGN_METHOD, "GET"),
+		"expiry":       tamper(PRESIGN_EXPIRES, "99999999999"),
+		"max size":     tamper(PRESIGN_MAX_SIZE, "2048"),
+		"no max size":  tamper(PRESIGN_MAX_SIZE, ""),
+		"content type": tamper(PRESIGN_CONTENT_TYPE, "text/html"),
+		"key id":       tamper(PRESIGN_KEY_ID, "k1"),
+		"unknown key":  tamper(PRESIGN_KEY_ID, "k3"),
+		"signature":    tamper(PRESIGN_SIGNATURE, "00"),
+	} {
+		if _, err := signer.Verify(presigned.Path, q, now); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("%v: expected ErrInvalidSignature, got %v", name, err)
+		}
+	}
+	if _, err := signer.Verify("/api/upload/alice/b.png", query, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected the signature to cover the path, got %v", err)
+	}
+	if _, err := signer.Verify(presigned.Path, query, now.Add(2*time.Hour)); !errors.Is(err, ErrExpiredSignature) {
+		t.Fatalf("expected ErrExpiredSignature, got %v", err)
+	}
+
+	// after rotation the previous key still verifies what it signed
+	rotated, err := NewSigner("k2:second secret,k3:third secret", "k3")
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	if _, err := rotated.Verify(presigned.Path, query, now); err != nil {
+		t.Fatalf("expected the retained key to verify, got %v", err)
+	}
+	retired, _ := NewSigner("k3:third secret", "")
+	if _, err := retired.Verify(presigned.Path, query, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected a removed key to stop verifying, got %v", err)
+	}
+}
+
+func TestNewSignerKeys(t *testing.T) {
+	for _, tt := range []struct {
+		keys   string
+		active string
+	}{
+		{"", ""},
+		{"k1", ""},
+		{"k1:", ""},
+		{"k1:a,k1:b", ""},
+		{"k1:a", "k2"},
+	} {
+		if _, err := NewSigner(tt.keys, tt.active); err == nil {
+			t.Fatalf("expected %q with active %q to be rejected", tt.keys, tt.active)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Package auth verifies the credentials presented to the API and turns them
+// into the identity a request acts as.
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/config"
+	"github.com/golang-jwt/jwt"
+)
+
+// scopes limit what an API key may do; SCOPE_ADMIN also lets a token or key
+// act on every user's files
+const (
+	SCOPE_READ   = "read"
+	SCOPE_WRITE  = "write"
+	SCOPE_DELETE = "delete"
+	SCOPE_ADMIN  = "admin"
+)
+
+// ValidScope reports whether scope is one of the known scopes
+func ValidScope(scope string) bool {
+	switch scope {
+	case SCOPE_READ, SCOPE_WRITE, SCOPE_DELETE, SCOPE_ADMIN:
+		return true
+	}
+	return false
+}
+
+var (
+	ErrNoKeys       = errors.New("no access token key configured")
+	ErrInvalidToken = errors.New("invalid access token")
+)
+
+// Identity is who a request acts as
+type Identity struct {
+	Subject string
+	Scopes  []string
+	// Groups receive the files shared with any of them
+	Groups []string
+	// APIKeyId is set when the request authenticated with an API key
+	APIKeyId string
+}
+
+func (i Identity) HasScope(scope string) bool {
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the identity may perform an operation needing scope.
+// Access tokens act with the full rights of their subject, while API keys are
+// limited to the scopes they were created with.
+func (i Identity) Allows(scope string) bool {
+	if i.APIKeyId == "" {
+		return true
+	}
+	return i.HasScope(scope) || i.HasScope(SCOPE_ADMIN)
+}
+
+// Grants reports whether the identity may give scope to an API key it
+// creates, so that a key never holds more than its creator: admin needs a
+// real admin, and a key can only pass on the scopes it has itself
+func (i Identity) Grants(scope string) bool {
+	if scope == SCOPE_ADMIN {
+		return i.HasScope(SCOPE_ADMIN)
+	}
+	return i.Allows(scope)
+}
+
+// CanActAs reports whether the identity may access the files of user
+func (i Identity) CanActAs(user string) bool {
+	return i.Subject == user || i.HasScope(SCOPE_ADMIN)
+}
+
+// Claims are the JWT claims an access token must carry
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	// Scope is space separated, as in OAuth 2.0
+	Scope string `json:"scope,omitempty"`
+	// Groups are the groups the subject belongs to, for sharing
+	Groups []string `json:"groups,omitempty"`
+}
+
+// Valid checks the time based claims; jwt calls it after the signature
+func (c *Claims) Valid() error {
+	now := time.Now().Unix()
+	if c.Subject == "" {
+		return errors.New("token has no subject")
+	}
+	// a token without expiry would be valid forever
+	if c.ExpiresAt == 0 {
+		return errors.New("token has no expiry")
+	}
+	if now >= c.ExpiresAt {
+		return errors.New("token is expired")
+	}
+	if c.NotBefore != 0 && now < c.NotBefore {
+		return errors.New("token is not valid yet")
+	}
+	return nil
+}
+
+// audience accepts both forms JWT allows, a string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// Verifier checks access tokens signed with HS256/384/512 or EdDSA
+type Verifier struct {
+	hmacSecret []byte
+	edKey      ed25519.PublicKey
+	issuer     string
+	audience   string
+}
+
+// NewVerifier loads the token keys from cfg; at least one must be set
+func NewVerifier(cfg *config.Config) (*Verifier, error) {
+	v := &Verifier{
+		issuer:   cfg.JWTIssuer,
+		audience: cfg.JWTAudience,
+	}
+	if cfg.JWTHMACSecret != "" {
+		v.hmacSecret = []byte(cfg.JWTHMACSecret)
+	}
+	if cfg.JWTEd25519PublicKey != "" {
+		key, err := parseEd25519PublicKey(cfg.JWTEd25519PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWT_ED25519_PUBLIC_KEY: %w", err)
+		}
+		v.edKey = key
+	}
+	if v.hmacSecret == nil && v.edKey == nil {
+		return nil, ErrNoKeys
+	}
+	return v, nil
+}
+
+func parseEd25519PublicKey(value string) (ed25519.PublicKey, error) {
+	pemData := []byte(value)
+	if !strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		if raw, err := base64.StdEncoding.DecodeString(value); err == nil && len(raw) == ed25519.PublicKeySize {
+			return ed25519.PublicKey(raw), nil
+		}
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return nil, err
+		}
+		pemData = data
+	}
+
+	key, err := jwt.ParseEdPublicKeyFromPEM(pemData)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 public key")
+	}
+	return edKey, nil
+}
+
+// Verify checks the token's signature and claims and returns its identity
+func (v *Verifier) Verify(token string) (Identity, error) {
+	var claims Claims
+	parser := &jwt.Parser{ValidMethods: []string{"HS256", "HS384", "HS512", "EdDSA"}}
+	_, err := parser.ParseWithClaims(token, &claims, v.key)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return Identity{}, fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+	if v.audience != "" && !claims.hasAudience(v.audience) {
+		return Identity{}, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+
+	return Identity{
+		Subject: claims.Subject,
+		Scopes:  strings.Fields(claims.Scope),
+		Groups:  claims.Groups,
+	}, nil
+}
+
+// key picks the verification key matching the token's algorithm, so that a
+// token can never be checked with a key of another kind
+func (v *Verifier) key(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if v.hmacSecret != nil {
+			return v.hmacSecret, nil
+		}
+	case *jwt.SigningMethodEd25519:
+		if v.edKey != nil {
+			return v.edKey, nil
+		}
+	}
+	return nil, fmt.Errorf("no key for algorithm %v", token.Header["alg"])
+}
+
+func (c *Claims) hasAudience(want string) bool {
+	for _, aud := range c.Audience {
+		if aud == want {
+			return true
+		}
+	}
+	return false
+}
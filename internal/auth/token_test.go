@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/config"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestVerifier(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	secret := []byte("hmac secret")
+
+	verifier, err := NewVerifier(&config.Config{
+		JWTHMACSecret:       string(secret),
+		JWTEd25519PublicKey: base64.StdEncoding.EncodeToString(public),
+		JWTIssuer:           "issuer",
+		JWTAudience:         "fs-upload",
+	})
+	if err != nil {
+		t.Fatalf("failed to create verifier: %v", err)
+	}
+
+	claims := func(changes map[string]any) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"sub":   "alice",
+			"iss":   "issuer",
+			"aud":   []string{"other", "fs-upload"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"scope": "read admin",
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	sign := func(method jwt.SigningMethod, key any, c jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(method, c).SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return token
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		for name, token := range map[string]string{
+			"HS256": sign(jwt.SigningMethodHS256, secret, claims(nil)),
+			"HS512": sign(jwt.SigningMethodHS512, secret, claims(map[string]any{"aud": "fs-upload"})),
+			"EdDSA": sign(jwt.SigningMethodEdDSA, private, claims(nil)),
+		} {
+			identity, err := verifier.Verify(token)
+			if err != nil {
+				t.Fatalf("%v: expected a valid token, got %v", name, err)
+			}
+			if identity.Subject != "alice" || !identity.HasScope(SCOPE_ADMIN) || !identity.CanActAs("bob") {
+				t.Fatalf("%v: unexpected identity %+v", name, identity)
+			}
+		}
+	})
+
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	invalid := map[string]string{
+		"wrong secret":     sign(jwt.SigningMethodHS256, []byte("other"), claims(nil)),
+		"wrong key":        sign(jwt.SigningMethodEdDSA, otherKey, claims(nil)),
+		"expired":          sign(jwt.SigningMethodHS256, secret, claims(map[string]any{"exp": time.Now().Add(-time.Minute).Unix()})),
+		"no expiry":        sign(jwt.SigningMethodHS256, secret, claims(map[string]any{"exp": nil})),
+		"not yet valid":    sign(jwt.SigningMethodHS256, secret, claims(map[string]any{"nbf": time.Now().Add(time.Hour).Unix()})),
+		"no subject":       sign(jwt.SigningMethodHS256, secret, claims(map[string]any{"sub": nil})),
+		"wrong issuer":     sign(jwt.SigningMethodHS256, secret, claims(map[string]any{"iss": "someone"})),
+		"wrong audience":   sign(jwt.SigningMethodHS256, secret, claims(map[string]any{"aud": "other"})),
+		"unsigned":         sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims(nil)),
+		"public key as hs": sign(jwt.SigningMethodHS256, []byte(public), claims(nil)),
+		"malformed":        "not.a.token",
+	}
+	for name, token := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := verifier.Verify(token); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+
+	t.Run("scopes", func(t *testing.T) {
+		identity, err := verifier.Verify(sign(jwt.SigningMethodHS256, secret, claims(map[string]any{"scope": "read"})))
+		if err != nil {
+			t.Fatalf("expected a valid token, got %v", err)
+		}
+		if identity.CanActAs("bob") || !identity.CanActAs("alice") {
+			t.Fatalf("expected a token without admin scope to be limited to its subject")
+		}
+	})
+}
+
+func TestNewVerifierKeys(t *testing.T) {
+	if _, err := NewVerifier(&config.Config{}); !errors.Is(err, ErrNoKeys) {
+		t.Fatalf("expected ErrNoKeys, got %v", err)
+	}
+
+	public, _, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	path := filepath.Join(t.TempDir(), "key.pem")
+	os.WriteFile(path, pemKey, 0600)
+
+	for name, value := range map[string]string{"pem": string(pemKey), "file": path} {
+		verifier, err := NewVerifier(&config.Config{JWTEd25519PublicKey: value})
+		if err != nil {
+			t.Fatalf("%v: failed to load key: %v", name, err)
+		}
+		if !verifier.edKey.Equal(public) {
+			t.Fatalf("%v: loaded the wrong key", name)
+		}
+	}
+
+	if _, err := NewVerifier(&config.Config{JWTEd25519PublicKey: "/does/not/exist"}); err == nil {
+		t.Fatal("expected an error for a missing key file")
+	}
+}
+
+func TestIdentityAllows(t *testing.T) {
+	user := Identity{Subject: "alice"}
+	if !user.Allows(SCOPE_DELETE) {
+		t.Fatal("expected an access token to act with the full rights of its subject")
+	}
+
+	key := Identity{Subject: "alice", Scopes: []string{SCOPE_READ}, APIKeyId: "k1"}
+	if !key.Allows(SCOPE_READ) || key.Allows(SCOPE_WRITE) {
+		t.Fatal("expected an API key to be limited to its scopes")
+	}
+
+	admin := Identity{Subject: "alice", Scopes: []string{SCOPE_ADMIN}, APIKeyId: "k2"}
+	if !admin.Allows(SCOPE_DELETE) || !admin.CanActAs("bob") {
+		t.Fatal("expected an admin key to be allowed everything")
+	}
+}
+
+func TestIdentityGrants(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity Identity
+		scope    string
+		want     bool
+	}{
+		{"user grants write", Identity{Subject: "alice"}, SCOPE_WRITE, true},
+		{"user cannot grant admin", Identity{Subject: "alice", Scopes: []string{SCOPE_READ}}, SCOPE_ADMIN, false},
+		{"admin grants admin", Identity{Subject: "root", Scopes: []string{SCOPE_ADMIN}}, SCOPE_ADMIN, true},
+		{"key passes on its scope", Identity{Subject: "alice", Scopes: []string{SCOPE_READ}, APIKeyId: "k1"}, SCOPE_READ, true},
+		{"key cannot widen", Identity{Subject: "alice", Scopes: []string{SCOPE_READ}, APIKeyId: "k1"}, SCOPE_DELETE, false},
+		{"admin key grants admin", Identity{Subject: "root", Scopes: []string{SCOPE_ADMIN}, APIKeyId: "k2"}, SCOPE_ADMIN, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.identity.Grants(tt.scope); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
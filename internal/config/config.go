@@ -1,20 +1,100 @@
 package config
 
 import (
+	"time"
+
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	DSN      string
-	DbName   string
-	BasePath string
+	DSN        string
+	DbName     string
+	BasePath   string
 	ServerHost string
+
+	// StorageBackend selects where file content is kept: "local" or "s3"
+	StorageBackend string
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3PathStyle    bool
+
+	// how long an unfinished tus upload is kept before it is purged
+	TusExpiration time.Duration
+	// how long a multipart upload may stay idle before it is aborted
+	MultipartExpiration time.Duration
+	// the most bytes one part, and all staged parts of a multipart upload
+	// together, may hold, 0 for no limit
+	MultipartMaxPartBytes int64
+	MultipartMaxBytes     int64
+	// how often background jobs look for expired state
+	CleanupInterval time.Duration
+
+	// access tokens are JWTs signed with the HMAC secret or the Ed25519 key;
+	// the public key is PEM, a path to a PEM file or the base64 raw key
+	JWTHMACSecret       string
+	JWTEd25519PublicKey string
+	// when set, tokens must carry this issuer and audience
+	JWTIssuer   string
+	JWTAudience string
+	// lifetime of a stream token unless the request asks for another one,
+	// and the longest lifetime that may be asked for
+	StreamTokenTTL    time.Duration
+	StreamTokenMaxTTL time.Duration
+	// pre-signed URLs are signed with HMAC keys given as "id:secret,..."; the
+	// key PresignKeyId signs new URLs while every listed key verifies
+	PresignKeys      string
+	PresignKeyId     string
+	PresignMaxExpiry time.Duration
+	// default limits of the bytes and number of files a user may store, 0 for
+	// no limit; users may be given quotas of their own
+	QuotaMaxBytes int64
+	QuotaMaxFiles int64
+	// earlier versions of a file are kept while they are among the
+	// VersionKeepLast newest or younger than VersionKeepDays; 0 leaves a rule
+	// out, and with both 0 every version is kept
+	VersionKeepLast int
+	VersionKeepDays int
+	// how long deleted files stay in the trash before they are purged, 0 to
+	// keep them until they are deleted from the trash
+	TrashRetention time.Duration
+	// the most content bytes one archive download may hold, 0 for no limit
+	ArchiveMaxBytes int64
+	// limits of an uploaded archive being extracted: the bytes of content it
+	// expands to, its number of entries, and how many times larger than the
+	// archive the content may be
+	ExtractMaxBytes   int64
+	ExtractMaxEntries int
+	ExtractMaxRatio   int64
+	// how often the last-used times of API keys are written to the database
+	APIKeyFlushInterval time.Duration
+	// AuthDisabled serves every request without a token, for development only
+	AuthDisabled bool
 }
 
 func Load(envFile string) *Config {
 	viper.SetConfigFile(envFile)
 	viper.SetConfigType("env")
+	viper.SetDefault("STORAGE_BACKEND", "local")
+	viper.SetDefault("S3_REGION", "us-east-1")
+	viper.SetDefault("S3_PATH_STYLE", true)
+	viper.SetDefault("TUS_EXPIRATION", "24h")
+	viper.SetDefault("MULTIPART_EXPIRATION", "24h")
+	viper.SetDefault("MULTIPART_MAX_PART_BYTES", 5<<30)
+	viper.SetDefault("MULTIPART_MAX_BYTES", 100<<30)
+	viper.SetDefault("CLEANUP_INTERVAL", "10m")
+	viper.SetDefault("STREAM_TOKEN_TTL", "5m")
+	viper.SetDefault("STREAM_TOKEN_MAX_TTL", "24h")
+	viper.SetDefault("PRESIGN_MAX_EXPIRY", "168h")
+	viper.SetDefault("API_KEY_FLUSH_INTERVAL", "1m")
+	viper.SetDefault("TRASH_RETENTION", "720h")
+	viper.SetDefault("ARCHIVE_MAX_BYTES", 10<<30)
+	viper.SetDefault("EXTRACT_MAX_BYTES", 10<<30)
+	viper.SetDefault("EXTRACT_MAX_ENTRIES", 10000)
+	viper.SetDefault("EXTRACT_MAX_RATIO", 100)
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
 			log.Fatal().Msg("config file not found")
@@ -24,9 +104,44 @@ func Load(envFile string) *Config {
 	}
 
 	return &Config{
-		DSN:      viper.GetString("DSN"),
-		DbName:   viper.GetString("DB_NAME"),
-		BasePath: viper.GetString("BASE_PATH"),
+		DSN:        viper.GetString("DSN"),
+		DbName:     viper.GetString("DB_NAME"),
+		BasePath:   viper.GetString("BASE_PATH"),
 		ServerHost: viper.GetString("SERVER_HOST"),
+
+		StorageBackend: viper.GetString("STORAGE_BACKEND"),
+		S3Endpoint:     viper.GetString("S3_ENDPOINT"),
+		S3Region:       viper.GetString("S3_REGION"),
+		S3Bucket:       viper.GetString("S3_BUCKET"),
+		S3AccessKey:    viper.GetString("S3_ACCESS_KEY"),
+		S3SecretKey:    viper.GetString("S3_SECRET_KEY"),
+		S3PathStyle:    viper.GetBool("S3_PATH_STYLE"),
+
+		TusExpiration:         viper.GetDuration("TUS_EXPIRATION"),
+		MultipartExpiration:   viper.GetDuration("MULTIPART_EXPIRATION"),
+		MultipartMaxPartBytes: viper.GetInt64("MULTIPART_MAX_PART_BYTES"),
+		MultipartMaxBytes:     viper.GetInt64("MULTIPART_MAX_BYTES"),
+		CleanupInterval:       viper.GetDuration("CLEANUP_INTERVAL"),
+
+		JWTHMACSecret:       viper.GetString("JWT_HMAC_SECRET"),
+		JWTEd25519PublicKey: viper.GetString("JWT_ED25519_PUBLIC_KEY"),
+		JWTIssuer:           viper.GetString("JWT_ISSUER"),
+		JWTAudience:         viper.GetString("JWT_AUDIENCE"),
+		StreamTokenTTL:      viper.GetDuration("STREAM_TOKEN_TTL"),
+		StreamTokenMaxTTL:   viper.GetDuration("STREAM_TOKEN_MAX_TTL"),
+		PresignKeys:         viper.GetString("PRESIGN_KEYS"),
+		PresignKeyId:        viper.GetString("PRESIGN_KEY_ID"),
+		PresignMaxExpiry:    viper.GetDuration("PRESIGN_MAX_EXPIRY"),
+		APIKeyFlushInterval: viper.GetDuration("API_KEY_FLUSH_INTERVAL"),
+		QuotaMaxBytes:       viper.GetInt64("QUOTA_MAX_BYTES"),
+		QuotaMaxFiles:       viper.GetInt64("QUOTA_MAX_FILES"),
+		VersionKeepLast:     viper.GetInt("VERSION_KEEP_LAST"),
+		VersionKeepDays:     viper.GetInt("VERSION_KEEP_DAYS"),
+		TrashRetention:      viper.GetDuration("TRASH_RETENTION"),
+		ArchiveMaxBytes:     viper.GetInt64("ARCHIVE_MAX_BYTES"),
+		ExtractMaxBytes:     viper.GetInt64("EXTRACT_MAX_BYTES"),
+		ExtractMaxEntries:   viper.GetInt("EXTRACT_MAX_ENTRIES"),
+		ExtractMaxRatio:     viper.GetInt64("EXTRACT_MAX_RATIO"),
+		AuthDisabled:        viper.GetBool("AUTH_DISABLED"),
 	}
 }
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Iwoooooods/fs-upload-go/migrations"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// every connection of an in-memory database is a new database
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count)
+	if err != nil {
+		t.Fatalf("failed to query schema: %v", err)
+	}
+	return count > 0
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	fsys := fstest.MapFS{
+		"001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"001_create_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"002_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER); CREATE TABLE c (id INTEGER);")},
+		"002_create_b.down.sql": {Data: []byte("DROP TABLE c; DROP TABLE b;")},
+		"005_create_d.up.sql":   {Data: []byte("CREATE TABLE d (id INTEGER);")},
+		"migrations.go":         {Data: []byte("package migrations")},
+	}
+
+	migrator, err := NewMigrator(db, fsys)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if migrator.Latest() != 5 {
+		t.Fatalf("expected latest version 5, got %d", migrator.Latest())
+	}
+
+	version := func() int {
+		t.Helper()
+		v, err := migrator.Version(ctx)
+		if err != nil {
+			t.Fatalf("failed to read version: %v", err)
+		}
+		return v
+	}
+
+	if err := migrator.To(ctx, 2); err != nil {
+		t.Fatalf("failed to migrate to 2: %v", err)
+	}
+	if version() != 2 || !tableExists(t, db, "c") || tableExists(t, db, "d") {
+		t.Fatalf("expected exactly migrations 1 and 2, at version %d", version())
+	}
+
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("failed to migrate up: %v", err)
+	}
+	if version() != 5 || !tableExists(t, db, "d") {
+		t.Fatalf("expected version 5, got %d", version())
+	}
+	// running again is a no-op
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("failed to migrate up again: %v", err)
+	}
+
+	if err := migrator.Down(ctx); !errors.Is(err, ErrNoDownMigration) {
+		t.Fatalf("expected ErrNoDownMigration, got %v", err)
+	}
+	if err := migrator.To(ctx, 3); !errors.Is(err, ErrUnknownVersion) {
+		t.Fatalf("expected ErrUnknownVersion, got %v", err)
+	}
+
+	t.Run("down", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"001_create_a.up.sql":   fsys["001_create_a.up.sql"],
+			"001_create_a.down.sql": fsys["001_create_a.down.sql"],
+			"002_create_b.up.sql":   fsys["002_create_b.up.sql"],
+			"002_create_b.down.sql": fsys["002_create_b.down.sql"],
+			"004_create_d.up.sql":   {Data: []byte("CREATE TABLE d (id INTEGER);")},
+			"004_create_d.down.sql": {Data: []byte("DROP TABLE d;")},
+		}
+		db := newTestDB(t)
+		migrator, err := NewMigrator(db, fsys)
+		if err != nil {
+			t.Fatalf("failed to load migrations: %v", err)
+		}
+		if err := migrator.Up(ctx); err != nil {
+			t.Fatalf("failed to migrate up: %v", err)
+		}
+		if err := migrator.Down(ctx); err != nil {
+			t.Fatalf("failed to migrate down: %v", err)
+		}
+		if v, _ := migrator.Version(ctx); v != 2 || tableExists(t, db, "d") {
+			t.Fatalf("expected version 2 after down, got %d", v)
+		}
+		if err := migrator.To(ctx, 0); err != nil {
+			t.Fatalf("failed to revert everything: %v", err)
+		}
+		if tableExists(t, db, "a") || tableExists(t, db, "b") {
+			t.Fatal("expected every table to be dropped")
+		}
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		fsys["001_create_a.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE a (id INTEGER, name TEXT);")}
+		migrator, err := NewMigrator(db, fsys)
+		if err != nil {
+			t.Fatalf("failed to load migrations: %v", err)
+		}
+		if err := migrator.Up(ctx); !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+		}
+	})
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	migrator, err := NewMigrator(db, migrations.FS)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("failed to migrate up: %v", err)
+	}
+	for _, table := range []string{"metadata", "blobs", "tus_uploads", "multipart_uploads", "multipart_parts"} {
+		if !tableExists(t, db, table) {
+			t.Fatalf("expected table %v", table)
+		}
+	}
+
+	// every migration can be reverted and applied again
+	if err := migrator.To(ctx, 0); err != nil {
+		t.Fatalf("failed to revert everything: %v", err)
+	}
+	if tableExists(t, db, "metadata") {
+		t.Fatal("expected metadata to be dropped")
+	}
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("failed to migrate up again: %v", err)
+	}
+}
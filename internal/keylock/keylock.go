@@ -0,0 +1,63 @@
+// Package keylock provides mutexes addressed by a key, for serializing work
+// on the same file, blob or upload without a lock per object held forever
+package keylock
+
+import "sync"
+
+// Locks holds one mutex per key that is locked or waited for; a key's mutex
+// is dropped once nobody holds or waits for it
+type Locks struct {
+	mu    sync.Mutex
+	locks map[string]*lock
+}
+
+type lock struct {
+	sync.Mutex
+	// refs counts the holders and waiters, the lock is dropped at zero
+	refs int
+}
+
+func New() *Locks {
+	return &Locks{locks: map[string]*lock{}}
+}
+
+// Lock blocks until key is free and returns the function that releases it
+func (l *Locks) Lock(key string) func() {
+	l.mu.Lock()
+	held, ok := l.locks[key]
+	if !ok {
+		held = &lock{}
+		l.locks[key] = held
+	}
+	held.refs++
+	l.mu.Unlock()
+
+	held.Lock()
+	return l.unlock(key, held)
+}
+
+// TryLock is Lock for callers that would rather give up than wait: it
+// reports false without blocking when key is already locked
+func (l *Locks) TryLock(key string) (func(), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.locks[key]; ok {
+		return nil, false
+	}
+	held := &lock{refs: 1}
+	held.Lock()
+	l.locks[key] = held
+	return l.unlock(key, held), true
+}
+
+func (l *Locks) unlock(key string, held *lock) func() {
+	return func() {
+		held.Unlock()
+		l.mu.Lock()
+		held.refs--
+		if held.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
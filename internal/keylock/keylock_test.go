@@ -0,0 +1,51 @@
+package keylock
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestLocks(t *testing.T) {
+	locks := New()
+
+	t.Run("serializes a key", func(t *testing.T) {
+		var wg sync.WaitGroup
+		counter := 0
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				unlock := locks.Lock("a")
+				defer unlock()
+				current := counter
+				counter = current + 1
+			}()
+		}
+		wg.Wait()
+		if counter != 50 {
+			t.Fatalf("expected 50 increments, got %d", counter)
+		}
+	})
+
+	t.Run("try lock", func(t *testing.T) {
+		unlock := locks.Lock("a")
+		if _, ok := locks.TryLock("a"); ok {
+			t.Fatal("expected a held key not to be taken")
+		}
+		other, ok := locks.TryLock("b")
+		if !ok {
+			t.Fatal("expected other keys to be free")
+		}
+		other()
+		unlock()
+		again, ok := locks.TryLock("a")
+		if !ok {
+			t.Fatal("expected a released key to be free")
+		}
+		again()
+	})
+
+	if len(locks.locks) != 0 {
+		t.Fatalf("expected released keys to be dropped, got %v", locks.locks)
+	}
+}
@@ -0,0 +1,237 @@
+package localstorage
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/google/uuid"
+)
+
+const (
+	// METADATA_BACKFILL names the backfill of legacy files, which completes
+	// the rows of migration 007
+	METADATA_BACKFILL = "metadata"
+	// LEGACY_BLOBS_BACKFILL names the backfill that fills the table of
+	// migration 020
+	LEGACY_BLOBS_BACKFILL = "legacy-blobs"
+)
+
+// BackfillMetadata records the files found in the user directories under
+// basePath, which hold everything stored before the blob store. Files without
+// a row get one, rows from before files had an owner are claimed when their
+// MD5 matches, and rows missing size, content type, timestamps or storage path
+// are completed. It returns how many rows changed. Once it has gone through
+// every file it is marked done and later calls return right away.
+func BackfillMetadata(ctx context.Context, db *sql.DB, basePath string) (int, error) {
+	return backfillOnce(ctx, db, METADATA_BACKFILL, func() (int, error) {
+		return backfillMetadata(ctx, db, basePath)
+	})
+}
+
+// BackfillLegacyBlobs records the content stored by MD5 under
+// basePath/.blobs before the blob store, for PurgeLegacyBlobs to remove once
+// unused. Like BackfillMetadata it runs to the end only once.
+func BackfillLegacyBlobs(ctx context.Context, db *sql.DB, basePath string) (int, error) {
+	return backfillOnce(ctx, db, LEGACY_BLOBS_BACKFILL, func() (int, error) {
+		blobService := services.NewBlobService(repositories.NewBlobRepositorySQLite(db))
+		entries, err := os.ReadDir(filepath.Join(basePath, ".blobs"))
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		recorded := 0
+		// the blob store keeps its content in fan-out directories, legacy
+		// content sits right in .blobs
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() || !isMD5Hash(entry.Name()) {
+				continue
+			}
+			if err := blobService.RecordLegacyBlob(ctx, entry.Name()); err != nil {
+				return recorded, err
+			}
+			recorded++
+		}
+		return recorded, nil
+	})
+}
+
+// backfillOnce runs the backfill called name unless it completed before
+func backfillOnce(ctx context.Context, db *sql.DB, name string, run func() (int, error)) (int, error) {
+	backfills := repositories.NewBackfillRepositorySQLite(db)
+	if completed, err := backfills.Completed(ctx, name); err != nil || completed {
+		return 0, err
+	}
+
+	changed, err := run()
+	if err != nil {
+		return changed, err
+	}
+	return changed, backfills.Complete(ctx, name, time.Now())
+}
+
+func backfillMetadata(ctx context.Context, db *sql.DB, basePath string) (int, error) {
+	metaService := services.NewMetaService(repositories.NewMetaRepositorySQLite(db))
+
+	users, err := os.ReadDir(basePath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, user := range users {
+		// dot directories hold blobs and in-progress uploads
+		if !user.IsDir() || strings.HasPrefix(user.Name(), ".") {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(basePath, user.Name()))
+		if err != nil {
+			return changed, err
+		}
+		for _, file := range files {
+			if !file.Type().IsRegular() || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			updated, err := backfillFile(ctx, metaService, basePath, user.Name(), file)
+			if err != nil {
+				return changed, err
+			}
+			if updated {
+				changed++
+			}
+		}
+	}
+	return changed, nil
+}
+
+func backfillFile(ctx context.Context, metaService services.MetaService, basePath string, owner string, file os.DirEntry) (bool, error) {
+	info, err := file.Info()
+	if err != nil {
+		return false, err
+	}
+	storagePath := owner + "/" + file.Name()
+
+	metadata, err := metaService.GetMetadataByName(ctx, owner, file.Name())
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	found := err == nil
+	// the name was uploaded again into the blob store, the file is stale
+	if found && metadata.SHA256Hash != "" {
+		return false, nil
+	}
+	if found && metadata.StoragePath == storagePath && metadata.Size == info.Size() && metadata.ContentType != "" {
+		return false, nil
+	}
+
+	md5Hash, head, err := hashLegacyFile(filepath.Join(basePath, owner, file.Name()))
+	if err != nil {
+		return false, err
+	}
+
+	if !found {
+		// rows written before uploads recorded their owner
+		unowned, err := metaService.GetMetadataByName(ctx, "", file.Name())
+		if err != nil && err != sql.ErrNoRows {
+			return false, err
+		}
+		if err == nil && unowned.SHA256Hash == "" && unowned.MD5Hash == md5Hash {
+			metadata, found = unowned, true
+		}
+	}
+	if !found {
+		metadata = models.FileMetadata{FileId: uuid.NewString(), FileName: file.Name()}
+	}
+
+	metadata.Owner = owner
+	metadata.MD5Hash = md5Hash
+	metadata.Size = info.Size()
+	metadata.ContentType = detectContentType(file.Name(), head)
+	metadata.StoragePath = storagePath
+	if metadata.VersionId == "" {
+		metadata.VersionId = uuid.NewString()
+		metadata.Author = owner
+	}
+	if isUnset(metadata.CreatedAt) {
+		metadata.CreatedAt = info.ModTime().UTC()
+	}
+	if isUnset(metadata.UpdatedAt) {
+		metadata.UpdatedAt = info.ModTime().UTC()
+	}
+
+	if found {
+		return true, metaService.UpdateMetadata(ctx, metadata)
+	}
+	return true, metaService.SaveMetadata(ctx, metadata)
+}
+
+// PurgeLegacyBlobs removes the content that was deduplicated by MD5 before
+// the blob store, kept in basePath/.blobs/<md5>, once no file stored that way
+// references it anymore. Those files hard link the content, so it is only
+// freed when the last of them was deleted or moved into the blob store. It
+// returns how many were removed.
+func PurgeLegacyBlobs(ctx context.Context, db *sql.DB, basePath string) (int, error) {
+	blobService := services.NewBlobService(repositories.NewBlobRepositorySQLite(db))
+	unused, err := blobService.UnusedLegacyBlobs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, md5Hash := range unused {
+		// the hash names a file, so it must not be anything but a hash
+		if isMD5Hash(md5Hash) {
+			err = os.Remove(filepath.Join(basePath, ".blobs", md5Hash))
+			if err != nil && !os.IsNotExist(err) {
+				return purged, err
+			}
+		}
+		if err := blobService.ForgetLegacyBlob(ctx, md5Hash); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// hashLegacyFile returns the MD5 hash and the first bytes of a file
+func hashLegacyFile(path string) (md5Hash string, head []byte, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	sniff := &sniffReader{src: f}
+	hash := md5.New()
+	if _, err := io.CopyBuffer(hash, sniff, make([]byte, BUFFER_SIZE)); err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), sniff.head, nil
+}
+
+// isUnset reports whether a timestamp still holds the column default, which
+// predates any upload
+func isUnset(t time.Time) bool {
+	return t.Unix() <= 0
+}
+
+func isMD5Hash(name string) bool {
+	decoded, err := hex.DecodeString(name)
+	return err == nil && len(decoded) == md5.Size
+}
@@ -0,0 +1,139 @@
+package localstorage
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+func TestBackfillMetadata(t *testing.T) {
+	ctx := context.Background()
+	basePath := t.TempDir()
+	db := newTestDB(t)
+
+	writeFile := func(path string, content string) {
+		t.Helper()
+		path = filepath.Join(basePath, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	writeFile("alice/notes.txt", "legacy notes")
+	writeFile("alice/.hidden", "skipped")
+	writeFile("bob/image.png", "\x89PNG\r\n\x1a\n")
+	writeFile(".blobs/ab/cd/abcd", "skipped")
+
+	// a row written before uploads recorded their owner
+	sum := md5.Sum([]byte("\x89PNG\r\n\x1a\n"))
+	alice := newTestUploaderWithDB(t, db, basePath, "alice")
+	err := alice.MetaService.SaveMetadata(ctx, models.FileMetadata{
+		FileId:   "unowned",
+		FileName: "image.png",
+		MD5Hash:  hex.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		t.Fatalf("failed to save metadata: %v", err)
+	}
+
+	changed, err := BackfillMetadata(ctx, db, basePath)
+	if err != nil {
+		t.Fatalf("failed to backfill: %v", err)
+	}
+	if changed != 2 {
+		t.Fatalf("expected 2 rows to change, got %d", changed)
+	}
+
+	notes, err := alice.MetaService.GetMetadataByName(ctx, "alice", "notes.txt")
+	if err != nil {
+		t.Fatalf("expected a row for alice/notes.txt: %v", err)
+	}
+	if notes.Size != 12 || notes.ContentType != "text/plain; charset=utf-8" || notes.StoragePath != "alice/notes.txt" || isUnset(notes.CreatedAt) {
+		t.Fatalf("unexpected metadata %+v", notes)
+	}
+
+	image, err := alice.MetaService.GetMetadataByName(ctx, "bob", "image.png")
+	if err != nil {
+		t.Fatalf("expected a row for bob/image.png: %v", err)
+	}
+	if image.FileId != "unowned" || image.ContentType != "image/png" {
+		t.Fatalf("expected the unowned row to be claimed, got %+v", image)
+	}
+
+	// a completed backfill does not walk the files again
+	if err := os.WriteFile(filepath.Join(basePath, "alice", "late.txt"), []byte("late"), 0644); err != nil {
+		t.Fatalf("failed to write legacy file: %v", err)
+	}
+	changed, err = BackfillMetadata(ctx, db, basePath)
+	if err != nil {
+		t.Fatalf("failed to backfill again: %v", err)
+	}
+	if changed != 0 {
+		t.Fatalf("expected nothing left to backfill, got %d", changed)
+	}
+	if _, err := alice.MetaService.GetMetadataByName(ctx, "alice", "late.txt"); err != sql.ErrNoRows {
+		t.Fatalf("expected the backfill not to run again, got %v", err)
+	}
+
+	reader, _, err := alice.OpenFile(ctx, "notes.txt")
+	if err != nil {
+		t.Fatalf("failed to open backfilled file: %v", err)
+	}
+	defer reader.Close()
+	content, _ := io.ReadAll(reader)
+	if string(content) != "legacy notes" {
+		t.Fatalf("unexpected content %q", content)
+	}
+}
+
+func TestPurgeLegacyBlobs(t *testing.T) {
+	ctx := context.Background()
+	basePath := t.TempDir()
+	db := newTestDB(t)
+
+	legacy := func(content string) string {
+		t.Helper()
+		sum := md5.Sum([]byte(content))
+		md5Hash := hex.EncodeToString(sum[:])
+		if err := os.MkdirAll(filepath.Join(basePath, ".blobs"), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(basePath, ".blobs", md5Hash), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write blob: %v", err)
+		}
+		return md5Hash
+	}
+	used := legacy("still linked")
+	unused := legacy("deleted long ago")
+	if recorded, err := BackfillLegacyBlobs(ctx, db, basePath); err != nil || recorded != 2 {
+		t.Fatalf("expected 2 legacy blobs recorded, got %d %v", recorded, err)
+	}
+
+	alice := newTestUploaderWithDB(t, db, basePath, "alice")
+	if err := alice.MetaService.SaveMetadata(ctx, models.FileMetadata{FileId: "1", Owner: "alice", FileName: "a.txt", MD5Hash: used}); err != nil {
+		t.Fatalf("failed to save metadata: %v", err)
+	}
+
+	purged, err := PurgeLegacyBlobs(ctx, db, basePath)
+	if err != nil || purged != 1 {
+		t.Fatalf("expected 1 blob purged, got %d %v", purged, err)
+	}
+	if _, err := os.Stat(filepath.Join(basePath, ".blobs", unused)); !os.IsNotExist(err) {
+		t.Fatalf("expected the unused blob to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(basePath, ".blobs", used)); err != nil {
+		t.Fatalf("expected the linked blob to be kept: %v", err)
+	}
+	if purged, err := PurgeLegacyBlobs(ctx, db, basePath); err != nil || purged != 0 {
+		t.Fatalf("expected nothing left to purge, got %d %v", purged, err)
+	}
+}
@@ -0,0 +1,170 @@
+package localstorage
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/keylock"
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/Iwoooooods/fs-upload-go/internal/storage"
+)
+
+var ErrBlobCorrupted = errors.New("blob content does not match its hash")
+
+// blobLocks make taking and dropping a reference atomic with writing and
+// deleting the content, so that a blob released to zero is never deleted
+// under a new reference. Stores are created per request, so they share them.
+var blobLocks = keylock.New()
+
+// BlobStore keeps file content addressed by its SHA-256 hash in a fan-out
+// layout (ab/cd/abcdef...), so identical content is stored once however many
+// users and names refer to it. The names live in the metadata table, and the
+// blobs table counts how many of them reference each blob.
+type BlobStore struct {
+	Backend storage.Storage
+	// SpoolDir holds incoming content while it is hashed, before its
+	// address is known
+	SpoolDir    string
+	BlobService services.BlobService
+}
+
+func NewBlobStore(backend storage.Storage, spoolDir string, blobService services.BlobService) *BlobStore {
+	return &BlobStore{
+		Backend:     backend,
+		SpoolDir:    spoolDir,
+		BlobService: blobService,
+	}
+}
+
+func (s *BlobStore) Key(sha256Hash string) string {
+	return sha256Hash[:2] + "/" + sha256Hash[2:4] + "/" + sha256Hash
+}
+
+// Put streams src into the store and takes a reference to the resulting
+// blob. The returned blob's RefCount is above one when the content was
+// already stored, in which case the new copy is simply dropped. The MD5 hash
+// of the content is computed on the way as well.
+func (s *BlobStore) Put(ctx context.Context, src io.Reader) (blob models.Blob, md5Hash string, err error) {
+	if err := os.MkdirAll(s.SpoolDir, 0755); err != nil {
+		return models.Blob{}, "", err
+	}
+	tmp, err := os.CreateTemp(s.SpoolDir, ".upload-*")
+	if err != nil {
+		return models.Blob{}, "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sha256Hasher := sha256.New()
+	md5Hasher := md5.New()
+	buffer := make([]byte, BUFFER_SIZE)
+	size, err := io.CopyBuffer(io.MultiWriter(tmp, sha256Hasher, md5Hasher), &contextReader{ctx, src}, buffer)
+	if err != nil {
+		return models.Blob{}, "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		return models.Blob{}, "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return models.Blob{}, "", err
+	}
+
+	blob = models.Blob{
+		SHA256Hash: hex.EncodeToString(sha256Hasher.Sum(nil)),
+		Size:       size,
+		CreatedAt:  time.Now().UTC(),
+	}
+	unlock := blobLocks.Lock(blob.SHA256Hash)
+	defer unlock()
+	blob.RefCount, err = s.BlobService.AcquireBlob(ctx, blob)
+	if err != nil {
+		return models.Blob{}, "", err
+	}
+
+	key := s.Key(blob.SHA256Hash)
+	_, statErr := s.Backend.Stat(ctx, key)
+	if blob.RefCount == 1 || errors.Is(statErr, storage.ErrNotExist) {
+		if err := storage.PutFile(ctx, s.Backend, key, tmp.Name()); err != nil {
+			if err := s.release(ctx, blob.SHA256Hash); err != nil {
+				log.Printf("failed to release blob %v: %v", blob.SHA256Hash, err)
+			}
+			return models.Blob{}, "", err
+		}
+	}
+
+	return blob, hex.EncodeToString(md5Hasher.Sum(nil)), nil
+}
+
+// Open returns a seekable reader over the blob's content
+func (s *BlobStore) Open(ctx context.Context, sha256Hash string) (*storage.Reader, error) {
+	return storage.Open(ctx, s.Backend, s.Key(sha256Hash))
+}
+
+// Acquire takes another reference to a stored blob, e.g. for a second name
+func (s *BlobStore) Acquire(ctx context.Context, sha256Hash string) error {
+	unlock := blobLocks.Lock(sha256Hash)
+	defer unlock()
+	blob, err := s.BlobService.GetBlob(ctx, sha256Hash)
+	if err != nil {
+		return err
+	}
+	_, err = s.BlobService.AcquireBlob(ctx, blob)
+	return err
+}
+
+// Release drops a reference to the blob and deletes its content once no
+// reference is left
+func (s *BlobStore) Release(ctx context.Context, sha256Hash string) error {
+	unlock := blobLocks.Lock(sha256Hash)
+	defer unlock()
+	return s.release(ctx, sha256Hash)
+}
+
+// release is Release for callers holding the blob's lock
+func (s *BlobStore) release(ctx context.Context, sha256Hash string) error {
+	refCount, err := s.BlobService.ReleaseBlob(ctx, sha256Hash)
+	if err != nil {
+		return err
+	}
+	if refCount == 0 {
+		return s.Backend.Delete(ctx, s.Key(sha256Hash))
+	}
+	return nil
+}
+
+// Verify re-hashes the stored content and reports ErrBlobCorrupted when it no
+// longer matches its address
+func (s *BlobStore) Verify(ctx context.Context, sha256Hash string) error {
+	content, err := s.Backend.Get(ctx, s.Key(sha256Hash), 0, -1)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	hasher := sha256.New()
+	if _, err := io.CopyBuffer(hasher, content, make([]byte, BUFFER_SIZE)); err != nil {
+		return err
+	}
+	if hex.EncodeToString(hasher.Sum(nil)) != sha256Hash {
+		return ErrBlobCorrupted
+	}
+	return nil
+}
+
+// releaseQuietly is Release for cleanup paths where the caller has nothing
+// better to do with an error than log it
+func (s *BlobStore) releaseQuietly(ctx context.Context, sha256Hash string) {
+	err := s.Release(ctx, sha256Hash)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("failed to release blob %v: %v", sha256Hash, err)
+	}
+}
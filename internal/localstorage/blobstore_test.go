@@ -0,0 +1,108 @@
+package localstorage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/storage"
+)
+
+func TestBlobStore(t *testing.T) {
+	basePath := t.TempDir()
+	store := newTestUploader(t, basePath, "testuser").Blobs
+	ctx := context.Background()
+
+	digest := sha256.Sum256([]byte("blob content"))
+	sha256Hash := hex.EncodeToString(digest[:])
+	blobPath := filepath.Join(basePath, ".blobs", sha256Hash[:2], sha256Hash[2:4], sha256Hash)
+
+	t.Run("fan-out layout", func(t *testing.T) {
+		blob, _, err := store.Put(ctx, strings.NewReader("blob content"))
+		if err != nil {
+			t.Fatalf("failed to put blob: %v", err)
+		}
+		if blob.SHA256Hash != sha256Hash || blob.Size != 12 || blob.RefCount != 1 {
+			t.Fatalf("unexpected blob %+v", blob)
+		}
+		if _, err := os.Stat(blobPath); err != nil {
+			t.Fatalf("expected blob at %v: %v", blobPath, err)
+		}
+	})
+
+	t.Run("identical content is referenced", func(t *testing.T) {
+		blob, _, err := store.Put(ctx, strings.NewReader("blob content"))
+		if err != nil {
+			t.Fatalf("failed to put blob: %v", err)
+		}
+		if blob.RefCount != 2 {
+			t.Fatalf("expected 2 references, got %d", blob.RefCount)
+		}
+	})
+
+	t.Run("verify detects corruption", func(t *testing.T) {
+		if err := store.Verify(ctx, sha256Hash); err != nil {
+			t.Fatalf("expected intact blob, got %v", err)
+		}
+		if err := os.WriteFile(blobPath, []byte("tampered"), 0644); err != nil {
+			t.Fatalf("failed to tamper with blob: %v", err)
+		}
+		if err := store.Verify(ctx, sha256Hash); err != ErrBlobCorrupted {
+			t.Fatalf("expected ErrBlobCorrupted, got %v", err)
+		}
+	})
+}
+
+// slowDelete widens the window between dropping the last reference to a blob
+// and deleting its content
+type slowDelete struct {
+	storage.Storage
+}
+
+func (s slowDelete) Delete(ctx context.Context, key string) error {
+	time.Sleep(10 * time.Millisecond)
+	return s.Storage.Delete(ctx, key)
+}
+
+func TestBlobStoreConcurrentPutAndRelease(t *testing.T) {
+	store := newTestUploader(t, t.TempDir(), "testuser").Blobs
+	store.Backend = slowDelete{store.Backend}
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		blob, _, err := store.Put(ctx, strings.NewReader("shared content"))
+		if err != nil {
+			t.Fatalf("failed to put blob: %v", err)
+		}
+
+		// the last reference is dropped while the same content arrives again
+		var wg sync.WaitGroup
+		var releaseErr, putErr error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			releaseErr = store.Release(ctx, blob.SHA256Hash)
+		}()
+		go func() {
+			defer wg.Done()
+			_, _, putErr = store.Put(ctx, strings.NewReader("shared content"))
+		}()
+		wg.Wait()
+		if releaseErr != nil || putErr != nil {
+			t.Fatalf("failed to release or put blob: %v %v", releaseErr, putErr)
+		}
+
+		if err := store.Verify(ctx, blob.SHA256Hash); err != nil {
+			t.Fatalf("expected the referenced content to be kept, got %v", err)
+		}
+		if err := store.Release(ctx, blob.SHA256Hash); err != nil {
+			t.Fatalf("failed to release blob: %v", err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package localstorage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/Iwoooooods/fs-upload-go/internal/storage"
+)
+
+// PurgeTrash permanently deletes the trash items deleted longer than
+// retention ago and returns how many were purged
+func PurgeTrash(ctx context.Context, db *sql.DB, basePath string, backend storage.Storage, retention time.Duration) (int, error) {
+	trash := services.NewTrashService(repositories.NewTrashRepositorySQLite(db))
+	expired, err := trash.Expired(ctx, retention)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, item := range expired {
+		// the owner's uploader knows where legacy content lives
+		uploader, err := NewUploader(basePath, item.File.Owner, db, backend)
+		if err != nil {
+			return purged, err
+		}
+		if err := uploader.purge(ctx, item); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
@@ -0,0 +1,87 @@
+package localstorage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/storage"
+)
+
+func TestTrash(t *testing.T) {
+	basePath := t.TempDir()
+	db := newTestDB(t)
+	uploader := newTestUploaderWithDB(t, db, basePath, "alice")
+	ctx := context.Background()
+
+	t.Run("legacy files move into the blob store", func(t *testing.T) {
+		if err := os.MkdirAll(filepath.Join(basePath, "alice"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(basePath, "alice", "old.txt"), []byte("legacy"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := BackfillMetadata(ctx, db, basePath); err != nil {
+			t.Fatalf("failed to backfill metadata: %v", err)
+		}
+
+		item, err := uploader.TrashFile(ctx, "old.txt")
+		if err != nil {
+			t.Fatalf("failed to trash file: %v", err)
+		}
+		if item.File.SHA256Hash == "" {
+			t.Fatal("expected the content to be stored as a blob")
+		}
+		if _, err := os.Stat(filepath.Join(basePath, "alice", "old.txt")); !os.IsNotExist(err) {
+			t.Fatalf("expected the legacy file to be removed, got %v", err)
+		}
+		// a restart must not bring the file back
+		if changed, err := BackfillMetadata(ctx, db, basePath); err != nil || changed != 0 {
+			t.Fatalf("expected nothing to backfill, got %d %v", changed, err)
+		}
+
+		restored, err := uploader.RestoreFile(ctx, item.TrashId)
+		if err != nil {
+			t.Fatalf("failed to restore file: %v", err)
+		}
+		reader, _, err := uploader.OpenFile(ctx, restored.FileName)
+		if err != nil {
+			t.Fatalf("failed to open restored file: %v", err)
+		}
+		content, _ := io.ReadAll(reader)
+		reader.Close()
+		if string(content) != "legacy" {
+			t.Fatalf("expected the legacy content, got %q", content)
+		}
+	})
+
+	t.Run("purge releases content and versions", func(t *testing.T) {
+		first, _, err := uploader.UploadFile(ctx, bytes.NewReader([]byte("v1")), "doc")
+		if err != nil {
+			t.Fatalf("failed to upload file: %v", err)
+		}
+		second, _, err := uploader.UploadFile(ctx, bytes.NewReader([]byte("v2")), "doc")
+		if err != nil {
+			t.Fatalf("failed to upload file: %v", err)
+		}
+		if err := uploader.DeleteFile(ctx, "doc"); err != nil {
+			t.Fatalf("failed to delete file: %v", err)
+		}
+
+		if purged, err := PurgeTrash(ctx, db, basePath, uploader.Blobs.Backend, time.Hour); err != nil || purged != 0 {
+			t.Fatalf("expected recent items to be kept, got %d %v", purged, err)
+		}
+		if purged, err := PurgeTrash(ctx, db, basePath, uploader.Blobs.Backend, 0); err != nil || purged != 1 {
+			t.Fatalf("expected the file to be purged, got %d %v", purged, err)
+		}
+		for _, hash := range []string{first.SHA256Hash, second.SHA256Hash} {
+			if _, err := uploader.Blobs.Backend.Stat(ctx, uploader.Blobs.Key(hash)); err != storage.ErrNotExist {
+				t.Fatalf("expected the content to be deleted, got %v", err)
+			}
+		}
+	})
+}
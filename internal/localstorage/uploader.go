@@ -3,78 +3,432 @@ package localstorage
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"io"
 	"log"
-	"os"
+	"mime"
+	"net/http"
+	"path"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
 	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
 	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/Iwoooooods/fs-upload-go/internal/storage"
+	"github.com/google/uuid"
 )
 
 const BUFFER_SIZE = 1024 * 1024 * 4
 
+// SNIFF_LEN is how much content http.DetectContentType looks at
+const SNIFF_LEN = 512
+
 type Uploader interface {
-	UploadFile(filePath string, md5 string, metaService services.MetaService) (fileId string, err error)
-	DeleteFile(filePath string) error
+	UploadFile(ctx context.Context, src io.Reader, fileName string) (metadata models.FileMetadata, exists bool, err error)
+	OpenFile(ctx context.Context, fileName string) (*storage.Reader, models.FileMetadata, error)
+	DeleteFile(ctx context.Context, fileName string) error
 }
 
+var (
+	// ErrVersionNotFound is returned for a version the file does not have
+	ErrVersionNotFound = errors.New("version not found")
+	// ErrFileExists is returned when restoring a file whose path was taken
+	ErrFileExists = errors.New("file already exists")
+	// ErrInvalidPath is returned for a file outside the user's directory
+	ErrInvalidPath = errors.New("path leaves the user directory")
+)
+
+var _ Uploader = (*DefaultUploader)(nil)
+
 type DefaultUploader struct {
-	ServerURL   string
-	Username    string
+	ServerURL string
+	Username  string
+	// Author is recorded as the writer of new versions, Username by default
+	Author string
+	// Properties replace the custom properties of the files UploadFile
+	// writes; nil keeps those of a file it overwrites
+	Properties map[string]string
+	// BasePath is the user's own directory, which only holds files stored
+	// before content moved into the blob store
 	BasePath    string
 	MetaService services.MetaService
+	Versions    services.VersionService
+	Trash       services.TrashService
+	// Quotas, when set, refuse content that does not fit the user's quota
+	// next to the version it replaces
+	Quotas services.QuotaService
+	Blobs  *BlobStore
+
+	legacy *storage.LocalStorage
 }
 
-func NewUploader(serverURL string, username string, db *sql.DB) (*DefaultUploader, error) {
-	// check if user exists, if not create new fold for the user
+// NewUploader creates an uploader for username whose content goes to backend
+func NewUploader(serverURL string, username string, db *sql.DB, backend storage.Storage) (*DefaultUploader, error) {
 	basePath := serverURL + "/" + username + "/"
-	if _, err := os.Stat(basePath); os.IsNotExist(err) {
-		// give permission to the user to read and write to the folder
-		os.MkdirAll(basePath, 0755)
-	}
 
 	metaRepo := repositories.NewMetaRepositorySQLite(db)
 	metaService := services.NewMetaService(metaRepo)
+	blobRepo := repositories.NewBlobRepositorySQLite(db)
+	blobService := services.NewBlobService(blobRepo)
+	versionRepo := repositories.NewFileVersionRepositorySQLite(db)
+	trashRepo := repositories.NewTrashRepositorySQLite(db)
 
 	return &DefaultUploader{
 		ServerURL:   serverURL,
 		Username:    username,
+		Author:      username,
 		BasePath:    basePath,
 		MetaService: metaService,
+		Versions:    services.NewVersionService(versionRepo),
+		Trash:       services.NewTrashService(trashRepo),
+		Blobs:       NewBlobStore(backend, filepath.Join(serverURL, ".tmp"), blobService),
+		legacy:      storage.NewLocalStorage(serverURL),
 	}, nil
 }
 
-func (u *DefaultUploader) UploadFile(ctx context.Context, src io.Reader, fileName string) error {
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
+// legacyKey is where fileName lives in the user directory. Both names come
+// from requests, so the key must not lead anywhere else below the storage,
+// such as another user, the blobs or the database.
+func (u *DefaultUploader) legacyKey(fileName string) (string, error) {
+	if u.Username == "" || strings.HasPrefix(u.Username, ".") || strings.Contains(u.Username, "/") || strings.ContainsAny(u.Username+fileName, "\\\x00") {
+		return "", ErrInvalidPath
+	}
+	key := path.Join(u.Username, fileName)
+	if !strings.HasPrefix(key, u.Username+"/") {
+		return "", ErrInvalidPath
+	}
+	return key, nil
+}
 
-	done := make(chan error, 1)
+// legacyPath is where a file stored before the blob store lives
+func (u *DefaultUploader) legacyPath(metadata models.FileMetadata) (string, error) {
+	if metadata.StoragePath != "" {
+		return metadata.StoragePath, nil
+	}
+	return u.legacyKey(metadata.FileName)
+}
 
-	go func() {
-		buffer := make([]byte, BUFFER_SIZE)
-		filePath := filepath.Join(u.BasePath, fileName)
-		file, err := os.Create(filePath)
-		if err != nil {
-			done <- err
-			return
+// UploadFile streams src into the blob store and points fileName at it. When
+// the content is already stored, by this or any other user, no second copy is
+// kept and exists is true. Overwritten content is kept as a version.
+func (u *DefaultUploader) UploadFile(ctx context.Context, src io.Reader, fileName string) (metadata models.FileMetadata, exists bool, err error) {
+	sniff := &sniffReader{src: src}
+	blob, md5Hash, err := u.Blobs.Put(ctx, sniff)
+	if err != nil {
+		return models.FileMetadata{}, false, err
+	}
+
+	metadata, err = u.store(ctx, fileName, models.FileMetadata{
+		MD5Hash:     md5Hash,
+		SHA256Hash:  blob.SHA256Hash,
+		Size:        blob.Size,
+		ContentType: detectContentType(fileName, sniff.head),
+		Properties:  u.Properties,
+	})
+	if err != nil {
+		u.Blobs.releaseQuietly(ctx, blob.SHA256Hash)
+		return models.FileMetadata{}, false, err
+	}
+	return metadata, blob.RefCount > 1, nil
+}
+
+// store points fileName at content, which holds a reference on its blob that
+// the file takes over, along with its properties unless they are nil.
+// Overwritten content is kept as a version.
+func (u *DefaultUploader) store(ctx context.Context, fileName string, content models.FileMetadata) (models.FileMetadata, error) {
+	previous, err := u.MetaService.GetMetadataByName(ctx, u.Username, fileName)
+	if err != nil && err != sql.ErrNoRows {
+		return models.FileMetadata{}, err
+	}
+
+	if err := u.checkQuota(ctx, previous, content.Size); err != nil {
+		return models.FileMetadata{}, err
+	}
+
+	now := time.Now().UTC()
+	metadata := previous
+	if previous.FileId == "" {
+		metadata = models.FileMetadata{
+			FileId:    uuid.NewString(),
+			Owner:     u.Username,
+			FileName:  fileName,
+			CreatedAt: now,
 		}
-		defer file.Close()
+	}
+	metadata.MD5Hash = content.MD5Hash
+	metadata.SHA256Hash = content.SHA256Hash
+	metadata.Size = content.Size
+	metadata.ContentType = content.ContentType
+	if content.Properties != nil {
+		metadata.Properties = content.Properties
+	}
+	metadata.UpdatedAt = now
+	metadata.StoragePath = u.Blobs.Key(content.SHA256Hash)
+	metadata.VersionId = uuid.NewString()
+	metadata.Author = u.Author
 
-		_, err = io.CopyBuffer(file, src, buffer)
-		done <- err
-	}()
+	if previous.FileId == "" {
+		err = u.MetaService.SaveMetadata(ctx, metadata)
+	} else {
+		err = u.MetaService.UpdateMetadata(ctx, metadata)
+	}
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
+
+	if previous.FileId != "" {
+		u.archiveContent(ctx, previous)
+	}
+	return metadata, nil
+}
 
-	// Wait for either completion or timeout
-	select {
-	case err := <-done:
+// checkQuota fails with services.ErrQuotaExceeded when size bytes of new
+// content for the file that is currently previous do not fit the quota. The
+// previous content stays charged as a version, so only files stored before
+// the blob store, which are not versioned, free their bytes.
+func (u *DefaultUploader) checkQuota(ctx context.Context, previous models.FileMetadata, size int64) error {
+	if u.Quotas == nil {
+		return nil
+	}
+	freed := int64(0)
+	if previous.SHA256Hash == "" {
+		freed = previous.Size
+	}
+	allowance, err := u.Quotas.Allowance(ctx, u.Username, freed, previous.FileId == "")
+	if err != nil {
 		return err
-	case <-ctxWithTimeout.Done():
-		// Clean up the partially written file
-		os.Remove(filepath.Join(u.BasePath, fileName))
-		return ctxWithTimeout.Err()
 	}
+	if allowance != services.UNLIMITED && size > allowance {
+		return services.ErrQuotaExceeded
+	}
+	return nil
+}
+
+// CopyFile stores the content of fileName as toName of to's user, which may
+// be this one. Content is never copied: the new file references the same
+// blob, and files stored before the blob store are imported into it first.
+func (u *DefaultUploader) CopyFile(ctx context.Context, fileName string, to *DefaultUploader, toName string) (models.FileMetadata, error) {
+	source, err := u.blobMetadata(ctx, fileName)
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
+	if err := u.Blobs.Acquire(ctx, source.SHA256Hash); err != nil {
+		return models.FileMetadata{}, err
+	}
+	metadata, err := to.store(ctx, toName, source)
+	if err != nil {
+		u.Blobs.releaseQuietly(ctx, source.SHA256Hash)
+		return models.FileMetadata{}, err
+	}
+	return metadata, nil
+}
+
+// MoveFile renames fileName to toName of to's user, which may be this one.
+// Only metadata changes: the file keeps its id, content and versions. A file
+// already at toName is moved into to's trash.
+func (u *DefaultUploader) MoveFile(ctx context.Context, fileName string, to *DefaultUploader, toName string) (models.FileMetadata, error) {
+	source, err := u.blobMetadata(ctx, fileName)
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
+
+	_, err = to.MetaService.GetMetadataByName(ctx, to.Username, toName)
+	if err == nil {
+		_, err = to.TrashFile(ctx, toName)
+	} else if err == sql.ErrNoRows {
+		err = nil
+	}
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
+
+	if err := u.MetaService.MoveMetadata(ctx, source.FileId, to.Username, toName); err != nil {
+		return models.FileMetadata{}, err
+	}
+	return u.MetaService.GetMetadataById(ctx, source.FileId)
+}
+
+// blobMetadata returns the metadata of fileName once its content is in the
+// blob store, importing files stored before it
+func (u *DefaultUploader) blobMetadata(ctx context.Context, fileName string) (models.FileMetadata, error) {
+	metadata, err := u.MetaService.GetMetadataByName(ctx, u.Username, fileName)
+	if err == sql.ErrNoRows {
+		return models.FileMetadata{}, storage.ErrNotExist
+	}
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
+	if metadata.SHA256Hash == "" {
+		return u.importLegacy(ctx, metadata)
+	}
+	return metadata, nil
+}
+
+// OpenVersion opens a version of fileName, which may be the current one
+func (u *DefaultUploader) OpenVersion(ctx context.Context, fileName string, versionId string) (*storage.Reader, models.FileMetadata, error) {
+	current, err := u.MetaService.GetMetadataByName(ctx, u.Username, fileName)
+	if err == sql.ErrNoRows {
+		return nil, models.FileMetadata{}, storage.ErrNotExist
+	}
+	if err != nil {
+		return nil, models.FileMetadata{}, err
+	}
+	if current.VersionId == versionId {
+		return u.OpenFile(ctx, fileName)
+	}
+
+	version, err := u.Versions.GetVersion(ctx, current.FileId, versionId)
+	if err == sql.ErrNoRows {
+		return nil, models.FileMetadata{}, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, models.FileMetadata{}, err
+	}
+	reader, err := u.Blobs.Open(ctx, version.SHA256Hash)
+	return reader, u.versionMetadata(current, version), err
+}
+
+// RestoreVersion makes the content of an earlier version current again. The
+// restored content becomes a new version, so history is never rewritten.
+func (u *DefaultUploader) RestoreVersion(ctx context.Context, fileName string, versionId string) (models.FileMetadata, error) {
+	current, err := u.MetaService.GetMetadataByName(ctx, u.Username, fileName)
+	if err == sql.ErrNoRows {
+		return models.FileMetadata{}, storage.ErrNotExist
+	}
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
+	version, err := u.Versions.GetVersion(ctx, current.FileId, versionId)
+	if err == sql.ErrNoRows {
+		return models.FileMetadata{}, ErrVersionNotFound
+	}
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
+
+	if err := u.checkQuota(ctx, current, version.Size); err != nil {
+		return models.FileMetadata{}, err
+	}
+	// the restored name takes a reference of its own, the version keeps its
+	if err := u.Blobs.Acquire(ctx, version.SHA256Hash); err != nil {
+		return models.FileMetadata{}, err
+	}
+	metadata := u.versionMetadata(current, version)
+	metadata.VersionId = uuid.NewString()
+	metadata.Author = u.Author
+	metadata.UpdatedAt = time.Now().UTC()
+	if err := u.MetaService.UpdateMetadata(ctx, metadata); err != nil {
+		u.Blobs.releaseQuietly(ctx, version.SHA256Hash)
+		return models.FileMetadata{}, err
+	}
+
+	u.archiveContent(ctx, current)
+	return metadata, nil
+}
+
+// versionMetadata describes a version as the file metadata it once was
+func (u *DefaultUploader) versionMetadata(current models.FileMetadata, version models.FileVersion) models.FileMetadata {
+	metadata := current
+	metadata.MD5Hash = version.MD5Hash
+	metadata.SHA256Hash = version.SHA256Hash
+	metadata.Size = version.Size
+	metadata.ContentType = version.ContentType
+	metadata.UpdatedAt = version.CreatedAt
+	metadata.StoragePath = u.Blobs.Key(version.SHA256Hash)
+	metadata.VersionId = version.VersionId
+	metadata.Author = version.Author
+	return metadata
+}
+
+// OpenFile opens the content stored under fileName for reading
+func (u *DefaultUploader) OpenFile(ctx context.Context, fileName string) (*storage.Reader, models.FileMetadata, error) {
+	metadata, err := u.MetaService.GetMetadataByName(ctx, u.Username, fileName)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, models.FileMetadata{}, err
+	}
+
+	// files stored before the blob store still live in the user directory
+	if metadata.SHA256Hash == "" {
+		metadata.FileName = fileName
+		legacyPath, err := u.legacyPath(metadata)
+		if err != nil {
+			return nil, models.FileMetadata{}, err
+		}
+		reader, err := storage.Open(ctx, u.legacy, legacyPath)
+		return reader, metadata, err
+	}
+
+	reader, err := u.Blobs.Open(ctx, metadata.SHA256Hash)
+	return reader, metadata, err
+}
+
+// archiveContent keeps content that was just replaced as a version, which
+// takes over its reference to the blob. Files stored before the blob store
+// cannot be versioned and are removed as before.
+func (u *DefaultUploader) archiveContent(ctx context.Context, previous models.FileMetadata) {
+	if previous.SHA256Hash == "" {
+		u.releaseContent(ctx, previous)
+		return
+	}
+	if _, err := u.Versions.Archive(ctx, previous); err != nil {
+		log.Printf("failed to keep previous version of %v: %v", previous.FileName, err)
+		u.releaseContent(ctx, previous)
+	}
+}
+
+// releaseContent drops the reference metadata holds on its content
+func (u *DefaultUploader) releaseContent(ctx context.Context, metadata models.FileMetadata) {
+	if metadata.SHA256Hash == "" {
+		legacyPath, err := u.legacyPath(metadata)
+		if err == nil {
+			err = u.legacy.Delete(ctx, legacyPath)
+		}
+		if err != nil {
+			log.Printf("failed to remove legacy file %v: %v", metadata.FileName, err)
+		}
+		return
+	}
+	u.Blobs.releaseQuietly(ctx, metadata.SHA256Hash)
+}
+
+// sniffReader keeps the first bytes read through it so the content type can
+// be detected without buffering the upload
+type sniffReader struct {
+	src  io.Reader
+	head []byte
+}
+
+func (r *sniffReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	if missing := SNIFF_LEN - len(r.head); missing > 0 {
+		r.head = append(r.head, p[:min(n, missing)]...)
+	}
+	return n, err
+}
+
+// detectContentType prefers the type registered for the file extension and
+// falls back to sniffing the content
+func detectContentType(fileName string, head []byte) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(fileName)); contentType != "" {
+		return contentType
+	}
+	return http.DetectContentType(head)
+}
+
+// contextReader stops a copy as soon as ctx is cancelled, e.g. when the
+// client goes away, instead of bounding the whole upload by a fixed timeout
+type contextReader struct {
+	ctx context.Context
+	src io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.src.Read(p)
 }
 
 func (u *DefaultUploader) CheckFileExists(ctx context.Context, md5 string) (exists bool, err error) {
@@ -98,22 +452,128 @@ func (u *DefaultUploader) CheckFileExists(ctx context.Context, md5 string) (exis
 	return false, nil
 }
 
-func (u *DefaultUploader) DeleteFile(ctx context.Context, filePath string) error {
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
+// DeleteFile moves fileName into the user's trash, where it keeps its
+// content and versions until it is restored or purged
+func (u *DefaultUploader) DeleteFile(ctx context.Context, fileName string) error {
+	_, err := u.TrashFile(ctx, fileName)
+	return err
+}
 
-	done := make(chan error, 1)
+// TrashFile is DeleteFile returning the trash item. Files that predate
+// metadata tracking have nothing to restore and are removed right away, with
+// a zero item.
+func (u *DefaultUploader) TrashFile(ctx context.Context, fileName string) (models.TrashItem, error) {
+	metadata, err := u.MetaService.GetMetadataByName(ctx, u.Username, fileName)
+	if err == sql.ErrNoRows {
+		legacyKey, err := u.legacyKey(fileName)
+		if err != nil {
+			return models.TrashItem{}, err
+		}
+		if _, err := u.legacy.Stat(ctx, legacyKey); err != nil {
+			return models.TrashItem{}, err
+		}
+		return models.TrashItem{}, u.legacy.Delete(ctx, legacyKey)
+	}
+	if err != nil {
+		return models.TrashItem{}, err
+	}
+
+	// the user directory is backfilled on startup, which would bring trashed
+	// legacy files back, so their content moves into the blob store first
+	if metadata.SHA256Hash == "" {
+		imported, err := u.importLegacy(ctx, metadata)
+		if errors.Is(err, storage.ErrNotExist) {
+			// nothing left to keep, only the stale row
+			if err := u.MetaService.DeleteMetadata(ctx, metadata.FileId); err != nil {
+				return models.TrashItem{}, err
+			}
+			return models.TrashItem{}, storage.ErrNotExist
+		}
+		if err != nil {
+			return models.TrashItem{}, err
+		}
+		metadata = imported
+	}
+	return u.Trash.Trash(ctx, metadata, u.Author)
+}
+
+// importLegacy moves the content of a file stored before the blob store into
+// it and returns the updated metadata
+func (u *DefaultUploader) importLegacy(ctx context.Context, metadata models.FileMetadata) (models.FileMetadata, error) {
+	legacyPath, err := u.legacyPath(metadata)
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
+	reader, err := storage.Open(ctx, u.legacy, legacyPath)
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
+	defer reader.Close()
+
+	blob, md5Hash, err := u.Blobs.Put(ctx, reader)
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
+	metadata.MD5Hash = md5Hash
+	metadata.SHA256Hash = blob.SHA256Hash
+	metadata.Size = blob.Size
+	metadata.StoragePath = u.Blobs.Key(blob.SHA256Hash)
+	if err := u.MetaService.UpdateMetadata(ctx, metadata); err != nil {
+		u.Blobs.releaseQuietly(ctx, blob.SHA256Hash)
+		return models.FileMetadata{}, err
+	}
+
+	if err := u.legacy.Delete(ctx, legacyPath); err != nil {
+		log.Printf("failed to remove legacy file %v: %v", metadata.FileName, err)
+	}
+	return metadata, nil
+}
+
+// RestoreFile moves a trash item back to its original path, which must be
+// free again
+func (u *DefaultUploader) RestoreFile(ctx context.Context, trashId string) (models.FileMetadata, error) {
+	item, err := u.Trash.Get(ctx, u.Username, trashId)
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
+	_, err = u.MetaService.GetMetadataByName(ctx, u.Username, item.File.FileName)
+	if err == nil {
+		return models.FileMetadata{}, ErrFileExists
+	}
+	if err != sql.ErrNoRows {
+		return models.FileMetadata{}, err
+	}
+
+	if err := u.Trash.Restore(ctx, item); err != nil {
+		return models.FileMetadata{}, err
+	}
+	return item.File, nil
+}
 
-	go func() {
-		done <- os.Remove(filePath)
-	}()
+// PurgeTrashItem permanently deletes a trash item with its versions; content
+// is deleted once no other file references it
+func (u *DefaultUploader) PurgeTrashItem(ctx context.Context, trashId string) error {
+	item, err := u.Trash.Get(ctx, u.Username, trashId)
+	if err != nil {
+		return err
+	}
+	return u.purge(ctx, item)
+}
 
-	select {
-	case err := <-done:
+func (u *DefaultUploader) purge(ctx context.Context, item models.TrashItem) error {
+	if err := u.Trash.Forget(ctx, item.TrashId); err != nil {
 		return err
-	case <-ctxWithTimeout.Done():
-		return ctxWithTimeout.Err()
 	}
+	u.releaseContent(ctx, item.File)
+
+	versions, err := u.Versions.DeleteVersions(ctx, item.File.FileId)
+	if err != nil {
+		log.Printf("failed to delete versions of %v: %v", item.File.FileName, err)
+	}
+	for _, version := range versions {
+		u.Blobs.releaseQuietly(ctx, version.SHA256Hash)
+	}
+	return nil
 }
 
 func (u *DefaultUploader) GetFileURL(fileName string) string {
@@ -3,35 +3,52 @@ package localstorage
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
 	"database/sql"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/Iwoooooods/fs-upload-go/internal/database"
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/Iwoooooods/fs-upload-go/internal/storage"
+
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func TestCheckFileExists(t *testing.T) {
+func newTestDB(t *testing.T) *sql.DB {
 	db, err := sql.Open("sqlite3", ":memory:")
 	if err != nil {
 		t.Fatalf("failed to create database: %v", err)
 	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
 
-	// Create metadata table
-	_, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS metadata (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            file_id TEXT NOT NULL,
-            file_name TEXT NOT NULL,
-            md5_hash TEXT NOT NULL
-        );
-    `)
-	if err != nil {
-		t.Fatalf("failed to create table: %v", err)
+	if err := database.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
 	}
+	return db
+}
+
+func newTestUploader(t *testing.T, basePath string, username string) *DefaultUploader {
+	return newTestUploaderWithDB(t, newTestDB(t), basePath, username)
+}
 
-	uploader, err := NewUploader(t.TempDir(), "testuser", db)
+func newTestUploaderWithDB(t *testing.T, db *sql.DB, basePath string, username string) *DefaultUploader {
+	uploader, err := NewUploader(basePath, username, db, storage.NewLocalStorage(filepath.Join(basePath, ".blobs")))
 	if err != nil {
 		t.Fatalf("failed to create uploader: %v", err)
 	}
+	return uploader
+}
+
+func TestCheckFileExists(t *testing.T) {
+	uploader := newTestUploader(t, t.TempDir(), "testuser")
 
 	t.Run("file exists", func(t *testing.T) {
 		exists, err := uploader.CheckFileExists(context.Background(), "testmd5")
@@ -44,11 +61,11 @@ func TestCheckFileExists(t *testing.T) {
 	})
 
 	t.Run("upload file", func(t *testing.T) {
-		err := uploader.UploadFile(context.Background(), bytes.NewReader([]byte("hello world!")), "testfile")
+		metadata, _, err := uploader.UploadFile(context.Background(), bytes.NewReader([]byte("hello world!")), "testfile")
 		if err != nil {
 			t.Fatalf("failed to upload file: %v", err)
 		}
-		exists, err := uploader.CheckFileExists(context.Background(), "testmd5")
+		exists, err := uploader.CheckFileExists(context.Background(), metadata.MD5Hash)
 		if err != nil {
 			t.Fatalf("failed to check file exists: %v", err)
 		}
@@ -57,3 +74,223 @@ func TestCheckFileExists(t *testing.T) {
 		}
 	})
 }
+
+func TestUploadFile(t *testing.T) {
+	uploader := newTestUploader(t, t.TempDir(), "testuser")
+
+	t.Run("stream larger than buffer", func(t *testing.T) {
+		content := bytes.Repeat([]byte("0123456789abcdef"), BUFFER_SIZE/8)
+		metadata, _, err := uploader.UploadFile(context.Background(), bytes.NewReader(content), "large")
+		if err != nil {
+			t.Fatalf("failed to upload file: %v", err)
+		}
+		digest := md5.Sum(content)
+		if metadata.MD5Hash != hex.EncodeToString(digest[:]) {
+			t.Fatalf("expected md5 %x, got %s", digest, metadata.MD5Hash)
+		}
+		reader, _, err := uploader.OpenFile(context.Background(), "large")
+		if err != nil {
+			t.Fatalf("failed to open stored file: %v", err)
+		}
+		defer reader.Close()
+		stored, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("failed to read stored file: %v", err)
+		}
+		if !bytes.Equal(stored, content) {
+			t.Fatal("stored content differs from upload")
+		}
+	})
+
+	t.Run("cancelled upload leaves nothing behind", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, _, err := uploader.UploadFile(ctx, bytes.NewReader([]byte("hello world!")), "cancelled")
+		if err != context.Canceled {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		if _, _, err := uploader.OpenFile(context.Background(), "cancelled"); err != storage.ErrNotExist {
+			t.Fatalf("expected no file, got %v", err)
+		}
+		entries, err := os.ReadDir(uploader.Blobs.SpoolDir)
+		if err != nil {
+			t.Fatalf("failed to read spool directory: %v", err)
+		}
+		if len(entries) != 0 {
+			t.Fatalf("unexpected file left behind: %v", entries[0].Name())
+		}
+	})
+}
+
+func TestDeduplication(t *testing.T) {
+	basePath := t.TempDir()
+	db := newTestDB(t)
+	alice := newTestUploaderWithDB(t, db, basePath, "alice")
+	// bob shares alice's database and blob store
+	bob := *alice
+	bob.Username = "bob"
+	bob.BasePath = filepath.Join(basePath, "bob")
+	ctx := context.Background()
+	content := []byte("the same bytes twice")
+
+	first, exists, err := alice.UploadFile(ctx, bytes.NewReader(content), "first")
+	if err != nil {
+		t.Fatalf("failed to upload file: %v", err)
+	}
+	if exists {
+		t.Fatal("first upload should store new content")
+	}
+	second, exists, err := bob.UploadFile(ctx, bytes.NewReader(content), "second")
+	if err != nil {
+		t.Fatalf("failed to upload file: %v", err)
+	}
+	if !exists {
+		t.Fatal("second upload should reuse the stored content")
+	}
+	if first.SHA256Hash != second.SHA256Hash {
+		t.Fatal("both names should point to the same blob")
+	}
+
+	blobKey := alice.Blobs.Key(first.SHA256Hash)
+	t.Run("blob survives while referenced", func(t *testing.T) {
+		if err := alice.DeleteFile(ctx, "first"); err != nil {
+			t.Fatalf("failed to delete file: %v", err)
+		}
+		if _, err := alice.Blobs.Backend.Stat(ctx, blobKey); err != nil {
+			t.Fatalf("blob should still exist: %v", err)
+		}
+	})
+
+	t.Run("blob removed with last reference", func(t *testing.T) {
+		if err := bob.DeleteFile(ctx, "second"); err != nil {
+			t.Fatalf("failed to delete file: %v", err)
+		}
+		if _, err := alice.Blobs.Backend.Stat(ctx, blobKey); err != nil {
+			t.Fatalf("blob should be kept while in the trash: %v", err)
+		}
+		purged, err := PurgeTrash(ctx, db, basePath, alice.Blobs.Backend, 0)
+		if err != nil {
+			t.Fatalf("failed to purge trash: %v", err)
+		}
+		if purged != 2 {
+			t.Fatalf("expected both files to be purged, got %d", purged)
+		}
+		if _, err := alice.Blobs.Backend.Stat(ctx, blobKey); err != storage.ErrNotExist {
+			t.Fatalf("blob should be removed, got %v", err)
+		}
+		exists, err := alice.CheckFileExists(ctx, first.MD5Hash)
+		if err != nil {
+			t.Fatalf("failed to check file exists: %v", err)
+		}
+		if exists {
+			t.Fatal("metadata should be removed")
+		}
+	})
+
+	t.Run("overwrite keeps old content until pruned", func(t *testing.T) {
+		old, _, err := alice.UploadFile(ctx, bytes.NewReader([]byte("old")), "doc")
+		if err != nil {
+			t.Fatalf("failed to upload file: %v", err)
+		}
+		for _, content := range []string{"new", "newer"} {
+			if _, _, err := alice.UploadFile(ctx, bytes.NewReader([]byte(content)), "doc"); err != nil {
+				t.Fatalf("failed to overwrite file: %v", err)
+			}
+		}
+		if _, err := alice.Blobs.Backend.Stat(ctx, alice.Blobs.Key(old.SHA256Hash)); err != nil {
+			t.Fatalf("old blob should be kept as a version: %v", err)
+		}
+
+		reader, metadata, err := alice.OpenVersion(ctx, "doc", old.VersionId)
+		if err != nil {
+			t.Fatalf("failed to open version: %v", err)
+		}
+		content, _ := io.ReadAll(reader)
+		reader.Close()
+		if string(content) != "old" || metadata.SHA256Hash != old.SHA256Hash {
+			t.Fatalf("expected the old content, got %q", content)
+		}
+
+		pruned, err := PruneVersions(ctx, db, basePath, alice.Blobs.Backend, services.RetentionPolicy{KeepLast: 1})
+		if err != nil {
+			t.Fatalf("failed to prune versions: %v", err)
+		}
+		if pruned != 1 {
+			t.Fatalf("expected the oldest version to be pruned, got %d", pruned)
+		}
+		if _, err := alice.Blobs.Backend.Stat(ctx, alice.Blobs.Key(old.SHA256Hash)); err != storage.ErrNotExist {
+			t.Fatalf("old blob should be removed, got %v", err)
+		}
+		if _, _, err := alice.OpenVersion(ctx, "doc", old.VersionId); err != ErrVersionNotFound {
+			t.Fatalf("expected pruned version to be gone, got %v", err)
+		}
+	})
+}
+
+func TestLegacyFilesStayInUserDirectory(t *testing.T) {
+	ctx := context.Background()
+	basePath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(basePath, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		fileName string
+	}{
+		{"parent user", "..", "secret.txt"},
+		{"hidden user", ".blobs", "secret.txt"},
+		{"nested user", "alice/..", "secret.txt"},
+		{"parent file", "alice", "../secret.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploader := newTestUploader(t, basePath, tt.username)
+			if reader, _, err := uploader.OpenFile(ctx, tt.fileName); err != ErrInvalidPath {
+				if reader != nil {
+					reader.Close()
+				}
+				t.Fatalf("expected ErrInvalidPath opening, got %v", err)
+			}
+			if err := uploader.DeleteFile(ctx, tt.fileName); err != ErrInvalidPath {
+				t.Fatalf("expected ErrInvalidPath deleting, got %v", err)
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(basePath, "secret.txt")); err != nil {
+		t.Fatalf("expected the file outside the user directory to be kept: %v", err)
+	}
+}
+
+func TestUploadKeepsVersionsWithinQuota(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	uploader := newTestUploaderWithDB(t, db, t.TempDir(), "alice")
+	uploader.Quotas = services.NewQuotaService(repositories.NewQuotaRepositorySQLite(db), models.Quota{MaxBytes: 15})
+
+	if _, _, err := uploader.UploadFile(ctx, strings.NewReader("0123456789"), "a.txt"); err != nil {
+		t.Fatalf("failed to upload file: %v", err)
+	}
+	// the first content stays charged as a version next to the new one
+	if _, _, err := uploader.UploadFile(ctx, strings.NewReader("abcdefghij"), "a.txt"); err != services.ErrQuotaExceeded {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if _, _, err := uploader.UploadFile(ctx, strings.NewReader("abcde"), "a.txt"); err != nil {
+		t.Fatalf("expected an overwrite fitting next to the version, got %v", err)
+	}
+
+	versions, err := uploader.Versions.ListVersions(ctx, mustMetadata(t, uploader, "a.txt").FileId)
+	if err != nil || len(versions) != 1 || versions[0].Size != 10 {
+		t.Fatalf("expected the first content as the only version, got %+v %v", versions, err)
+	}
+}
+
+func mustMetadata(t *testing.T, uploader *DefaultUploader, fileName string) models.FileMetadata {
+	t.Helper()
+	metadata, err := uploader.MetaService.GetMetadataByName(context.Background(), uploader.Username, fileName)
+	if err != nil {
+		t.Fatalf("failed to get metadata: %v", err)
+	}
+	return metadata
+}
@@ -0,0 +1,32 @@
+package localstorage
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/Iwoooooods/fs-upload-go/internal/services"
+	"github.com/Iwoooooods/fs-upload-go/internal/storage"
+)
+
+// PruneVersions deletes the file versions the retention policy no longer
+// keeps, releasing their content, and returns how many were deleted
+func PruneVersions(ctx context.Context, db *sql.DB, basePath string, backend storage.Storage, policy services.RetentionPolicy) (int, error) {
+	versions := services.NewVersionService(repositories.NewFileVersionRepositorySQLite(db))
+	blobs := NewBlobStore(backend, filepath.Join(basePath, ".tmp"), services.NewBlobService(repositories.NewBlobRepositorySQLite(db)))
+
+	prunable, err := versions.Prunable(ctx, policy)
+	if err != nil {
+		return 0, err
+	}
+	pruned := 0
+	for _, version := range prunable {
+		if err := versions.DeleteVersion(ctx, version.VersionId); err != nil {
+			return pruned, err
+		}
+		blobs.releaseQuietly(ctx, version.SHA256Hash)
+		pruned++
+	}
+	return pruned, nil
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// kinds of grantees and the permissions they may be granted
+const (
+	GRANTEE_USER          = "user"
+	GRANTEE_GROUP         = "group"
+	PERMISSION_READ       = "read"
+	PERMISSION_READ_WRITE = "read-write"
+)
+
+// ACL grants a user or group access to one of Owner's files, or to every file
+// under a folder prefix when Path ends with "/"
+type ACL struct {
+	AclId       string    `json:"acl_id" db:"acl_id"`
+	Owner       string    `json:"owner" db:"owner"`
+	Path        string    `json:"path" db:"path"`
+	GranteeType string    `json:"grantee_type" db:"grantee_type"`
+	Grantee     string    `json:"grantee" db:"grantee"`
+	Permission  string    `json:"permission" db:"permission"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+func (a ACL) IsFolder() bool {
+	return strings.HasSuffix(a.Path, "/")
+}
+
+// Covers reports whether the grant applies to fileName
+func (a ACL) Covers(fileName string) bool {
+	if a.IsFolder() {
+		return strings.HasPrefix(fileName, a.Path)
+	}
+	return a.Path == fileName
+}
+
+// Permits reports whether the grant allows permission
+func (a ACL) Permits(permission string) bool {
+	return a.Permission == PERMISSION_READ_WRITE || a.Permission == permission
+}
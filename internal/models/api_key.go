@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// APIKey is a long-lived credential of a service account, limited to Scopes
+type APIKey struct {
+	KeyId   string   `json:"key_id" db:"key_id"`
+	Owner   string   `json:"owner" db:"owner"`
+	Name    string   `json:"name" db:"name"`
+	KeyHash string   `json:"key_hash" db:"key_hash"`
+	Scopes  []string `json:"scopes" db:"scopes"`
+	// LastUsedAt and RevokedAt are zero until the key is used or revoked
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at" db:"last_used_at"`
+	RevokedAt  time.Time `json:"revoked_at" db:"revoked_at"`
+}
+
+func (k APIKey) Revoked() bool {
+	return !k.RevokedAt.IsZero()
+}
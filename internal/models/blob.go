@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Blob is a piece of content stored once, addressed by its SHA-256 hash, and
+// shared by every file whose content is identical
+type Blob struct {
+	SHA256Hash string    `json:"sha256_hash" db:"sha256_hash"`
+	Size       int64     `json:"size" db:"size"`
+	RefCount   int64     `json:"ref_count" db:"ref_count"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// FileVersion is earlier content of a file, kept when the file is
+// overwritten. The current content is described by the file's metadata.
+type FileVersion struct {
+	VersionId   string `json:"version_id" db:"version_id"`
+	FileId      string `json:"file_id" db:"file_id"`
+	Owner       string `json:"owner" db:"owner"`
+	FileName    string `json:"file_name" db:"file_name"`
+	MD5Hash     string `json:"md5_hash" db:"md5_hash"`
+	SHA256Hash  string `json:"sha256_hash" db:"sha256_hash"`
+	Size        int64  `json:"size" db:"size"`
+	ContentType string `json:"content_type" db:"content_type"`
+	Author      string `json:"author" db:"author"`
+	// CreatedAt is when the content was written, not when it was replaced
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Folder groups a user's files whose paths start with its path and a "/"
+type Folder struct {
+	Owner string `json:"owner" db:"owner"`
+	// Path is relative to the owner's storage, without a trailing "/"
+	Path      string    `json:"path" db:"path"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Name is the last segment of the folder's path
+func (f Folder) Name() string {
+	return f.Path[strings.LastIndex(f.Path, "/")+1:]
+}
+
+// ParentFolders lists the paths of the folders containing path, outermost
+// first, e.g. "a" and "a/b" for "a/b/c.txt"
+func ParentFolders(path string) []string {
+	var parents []string
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' {
+			parents = append(parents, path[:i])
+		}
+	}
+	return parents
+}
@@ -1,7 +1,26 @@
 package models
 
+import "time"
+
 type FileMetadata struct {
-	FileId   string `json:"file_id" db:"file_id"`
-	FileName string `json:"file_name" db:"file_name"`
-	MD5Hash  string `json:"md5_hash" db:"md5_hash"`
+	FileId      string    `json:"file_id" db:"file_id"`
+	Owner       string    `json:"owner" db:"owner"`
+	FileName    string    `json:"file_name" db:"file_name"`
+	MD5Hash     string    `json:"md5_hash" db:"md5_hash"`
+	SHA256Hash  string    `json:"sha256_hash" db:"sha256_hash"`
+	Size        int64     `json:"size" db:"size"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	// LastAccessedAt is zero until the file is first downloaded
+	LastAccessedAt time.Time `json:"last_accessed_at" db:"last_accessed_at"`
+	// StoragePath is the key of the content: a blob key, or for files stored
+	// before the blob store a path relative to BASE_PATH
+	StoragePath string `json:"storage_path" db:"storage_path"`
+	// VersionId identifies the current content; every write gets a new one
+	VersionId string `json:"version_id" db:"version_id"`
+	// Author is the user who wrote the current content
+	Author string `json:"author" db:"author"`
+	// Properties are custom key-value pairs given by the uploader
+	Properties map[string]string `json:"properties" db:"properties"`
 }
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type MultipartUpload struct {
+	UploadId  string    `json:"upload_id" db:"upload_id"`
+	Owner     string    `json:"owner" db:"owner"`
+	FileName  string    `json:"file_name" db:"file_name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type MultipartPart struct {
+	UploadId   string    `json:"upload_id" db:"upload_id"`
+	PartNumber int       `json:"part_number" db:"part_number"`
+	Size       int64     `json:"size" db:"size"`
+	MD5Hash    string    `json:"md5_hash" db:"md5_hash"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
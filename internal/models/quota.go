@@ -0,0 +1,15 @@
+package models
+
+// Usage is what a user's files take up
+type Usage struct {
+	Owner     string `json:"owner" db:"owner"`
+	BytesUsed int64  `json:"bytes_used" db:"bytes_used"`
+	FileCount int64  `json:"file_count" db:"file_count"`
+}
+
+// Quota limits a user's usage; 0 means no limit
+type Quota struct {
+	Owner    string `json:"owner" db:"owner"`
+	MaxBytes int64  `json:"max_bytes" db:"max_bytes"`
+	MaxFiles int64  `json:"max_files" db:"max_files"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// ShareLink lets anyone holding its token download one file, optionally
+// protected by a password and limited in time and number of downloads
+type ShareLink struct {
+	LinkId    string `json:"link_id" db:"link_id"`
+	TokenHash string `json:"token_hash" db:"token_hash"`
+	Owner     string `json:"owner" db:"owner"`
+	FileName  string `json:"file_name" db:"file_name"`
+	// PasswordHash is a bcrypt hash, empty when no password is required
+	PasswordHash string `json:"password_hash" db:"password_hash"`
+	// ExpiresAt is zero for links that do not expire
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	// MaxDownloads of 0 means no limit
+	MaxDownloads  int       `json:"max_downloads" db:"max_downloads"`
+	DownloadCount int       `json:"download_count" db:"download_count"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	RevokedAt     time.Time `json:"revoked_at" db:"revoked_at"`
+}
+
+func (l ShareLink) Revoked() bool {
+	return !l.RevokedAt.IsZero()
+}
+
+// Usable reports whether the link may still serve a download at now
+func (l ShareLink) Usable(now time.Time) bool {
+	if l.Revoked() {
+		return false
+	}
+	if !l.ExpiresAt.IsZero() && !now.Before(l.ExpiresAt) {
+		return false
+	}
+	return l.MaxDownloads == 0 || l.DownloadCount < l.MaxDownloads
+}
+
+// ShareLinkAccess is one request served through a share link
+type ShareLinkAccess struct {
+	LinkId     string    `json:"link_id" db:"link_id"`
+	Method     string    `json:"method" db:"method"`
+	RemoteAddr string    `json:"remote_addr" db:"remote_addr"`
+	UserAgent  string    `json:"user_agent" db:"user_agent"`
+	AccessedAt time.Time `json:"accessed_at" db:"accessed_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// StreamToken lets whoever holds it download one file until it expires or
+// has been used MaxUses times
+type StreamToken struct {
+	TokenHash string `json:"token_hash" db:"token_hash"`
+	Owner     string `json:"owner" db:"owner"`
+	FileName  string `json:"file_name" db:"file_name"`
+	// MaxUses of 0 means the token can be used until it expires
+	MaxUses   int       `json:"max_uses" db:"max_uses"`
+	UseCount  int       `json:"use_count" db:"use_count"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// TrashItem is a deleted file, kept until it is restored or purged
+type TrashItem struct {
+	TrashId string `json:"trash_id" db:"trash_id"`
+	// File is the file's metadata at deletion, FileName its original path
+	File      FileMetadata `json:"file"`
+	DeletedAt time.Time    `json:"deleted_at" db:"deleted_at"`
+	DeletedBy string       `json:"deleted_by" db:"deleted_by"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type TusUpload struct {
+	UploadId     string    `json:"upload_id" db:"upload_id"`
+	Owner        string    `json:"owner" db:"owner"`
+	FileName     string    `json:"file_name" db:"file_name"`
+	UploadLength int64     `json:"upload_length" db:"upload_length"`
+	UploadOffset int64     `json:"upload_offset" db:"upload_offset"`
+	Metadata     string    `json:"metadata" db:"metadata"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// Completed reports whether all bytes announced in Upload-Length were received
+func (u TusUpload) Completed() bool {
+	return u.UploadOffset >= u.UploadLength
+}
@@ -0,0 +1,18 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+type ACLRepository interface {
+	// Put creates the grant, or changes the permission of an existing grant
+	// of the same path to the same grantee, and returns the stored grant
+	Put(ctx context.Context, acl models.ACL) (models.ACL, error)
+	ListByOwner(ctx context.Context, owner string) ([]models.ACL, error)
+	// ListByGrantee returns the grants to user or to any of groups
+	ListByGrantee(ctx context.Context, user string, groups []string) ([]models.ACL, error)
+	// Delete removes owner's grant and reports whether it existed
+	Delete(ctx context.Context, owner string, aclId string) (bool, error)
+}
@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+const aclColumns = "acl_id, owner, path, grantee_type, grantee, permission, created_at"
+
+type ACLRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewACLRepositorySQLite(db *sql.DB) *ACLRepositorySQLite {
+	return &ACLRepositorySQLite{db}
+}
+
+func (r *ACLRepositorySQLite) Put(ctx context.Context, acl models.ACL) (models.ACL, error) {
+	stmt, err := r.db.PrepareContext(ctx, "INSERT INTO acls ("+aclColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (owner, path, grantee_type, grantee) DO UPDATE SET permission = excluded.permission`)
+	if err != nil {
+		return models.ACL{}, err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, acl.AclId, acl.Owner, acl.Path, acl.GranteeType, acl.Grantee, acl.Permission, acl.CreatedAt.UTC())
+	if err != nil {
+		return models.ACL{}, err
+	}
+
+	row := r.db.QueryRowContext(ctx, "SELECT "+aclColumns+" FROM acls WHERE owner = ? AND path = ? AND grantee_type = ? AND grantee = ?",
+		acl.Owner, acl.Path, acl.GranteeType, acl.Grantee)
+	return scanACL(row)
+}
+
+func (r *ACLRepositorySQLite) ListByOwner(ctx context.Context, owner string) ([]models.ACL, error) {
+	return r.query(ctx, "SELECT "+aclColumns+" FROM acls WHERE owner = ? ORDER BY path, grantee_type, grantee", owner)
+}
+
+func (r *ACLRepositorySQLite) ListByGrantee(ctx context.Context, user string, groups []string) ([]models.ACL, error) {
+	query := "SELECT " + aclColumns + " FROM acls WHERE (grantee_type = ? AND grantee = ?)"
+	args := []any{models.GRANTEE_USER, user}
+	if len(groups) > 0 {
+		query += " OR (grantee_type = ? AND grantee IN (?" + strings.Repeat(", ?", len(groups)-1) + "))"
+		args = append(args, models.GRANTEE_GROUP)
+		for _, group := range groups {
+			args = append(args, group)
+		}
+	}
+	return r.query(ctx, query+" ORDER BY owner, path", args...)
+}
+
+func (r *ACLRepositorySQLite) Delete(ctx context.Context, owner string, aclId string) (bool, error) {
+	stmt, err := r.db.PrepareContext(ctx, "DELETE FROM acls WHERE owner = ? AND acl_id = ?")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, owner, aclId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+func (r *ACLRepositorySQLite) query(ctx context.Context, query string, args ...any) ([]models.ACL, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	acls := []models.ACL{}
+	for rows.Next() {
+		acl, err := scanACL(rows)
+		if err != nil {
+			return nil, err
+		}
+		acls = append(acls, acl)
+	}
+	return acls, rows.Err()
+}
+
+func scanACL(row rowScanner) (models.ACL, error) {
+	var acl models.ACL
+	err := row.Scan(&acl.AclId, &acl.Owner, &acl.Path, &acl.GranteeType, &acl.Grantee, &acl.Permission, &acl.CreatedAt)
+	return acl, err
+}
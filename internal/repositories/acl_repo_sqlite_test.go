@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+func TestACLRepositorySQLite(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewACLRepositorySQLite(db)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	put := func(acl models.ACL) models.ACL {
+		t.Helper()
+		acl.CreatedAt = now
+		stored, err := repo.Put(ctx, acl)
+		if err != nil {
+			t.Fatalf("failed to put grant: %v", err)
+		}
+		return stored
+	}
+
+	first := put(models.ACL{AclId: "a1", Owner: "alice", Path: "docs/", GranteeType: models.GRANTEE_USER, Grantee: "bob", Permission: models.PERMISSION_READ})
+	put(models.ACL{AclId: "a2", Owner: "alice", Path: "a.txt", GranteeType: models.GRANTEE_GROUP, Grantee: "team", Permission: models.PERMISSION_READ})
+	put(models.ACL{AclId: "a3", Owner: "carol", Path: "c.txt", GranteeType: models.GRANTEE_GROUP, Grantee: "other", Permission: models.PERMISSION_READ})
+
+	t.Run("put replaces the permission", func(t *testing.T) {
+		updated := put(models.ACL{AclId: "a4", Owner: "alice", Path: "docs/", GranteeType: models.GRANTEE_USER, Grantee: "bob", Permission: models.PERMISSION_READ_WRITE})
+		if updated.AclId != first.AclId || updated.Permission != models.PERMISSION_READ_WRITE {
+			t.Fatalf("expected the existing grant to be updated, got %+v", updated)
+		}
+	})
+
+	t.Run("list by grantee", func(t *testing.T) {
+		acls, err := repo.ListByGrantee(ctx, "bob", []string{"team"})
+		if err != nil {
+			t.Fatalf("failed to list grants: %v", err)
+		}
+		if len(acls) != 2 || acls[0].Path != "a.txt" || acls[1].Path != "docs/" {
+			t.Fatalf("unexpected grants %+v", acls)
+		}
+		if !acls[1].Covers("docs/2024/report.pdf") || acls[1].Covers("docs.txt") || acls[0].Covers("a.txt.bak") {
+			t.Fatal("unexpected path matching")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		ok, err := repo.Delete(ctx, "carol", "a1")
+		if err != nil || ok {
+			t.Fatalf("expected another owner's grant not to be deleted, got %v %v", ok, err)
+		}
+		ok, err = repo.Delete(ctx, "alice", "a1")
+		if err != nil || !ok {
+			t.Fatalf("expected the grant to be deleted, got %v %v", ok, err)
+		}
+		acls, _ := repo.ListByOwner(ctx, "alice")
+		if len(acls) != 1 {
+			t.Fatalf("expected 1 grant left, got %+v", acls)
+		}
+	})
+}
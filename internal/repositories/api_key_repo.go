@@ -0,0 +1,18 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key models.APIKey) error
+	GetByHash(ctx context.Context, keyHash string) (models.APIKey, error)
+	ListByOwner(ctx context.Context, owner string) ([]models.APIKey, error)
+	// Revoke marks owner's key as revoked and reports whether it existed
+	Revoke(ctx context.Context, owner string, keyId string, at time.Time) (bool, error)
+	// UpdateLastUsed records several last-used times in one transaction
+	UpdateLastUsed(ctx context.Context, lastUsed map[string]time.Time) error
+}
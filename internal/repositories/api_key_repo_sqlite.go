@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+const apiKeyColumns = "key_id, owner, name, key_hash, scopes, created_at, last_used_at, revoked_at"
+
+type APIKeyRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepositorySQLite(db *sql.DB) *APIKeyRepositorySQLite {
+	return &APIKeyRepositorySQLite{db}
+}
+
+func (r *APIKeyRepositorySQLite) Create(ctx context.Context, key models.APIKey) error {
+	stmt, err := r.db.PrepareContext(ctx, "INSERT INTO api_keys ("+apiKeyColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, key.KeyId, key.Owner, key.Name, key.KeyHash, strings.Join(key.Scopes, " "),
+		key.CreatedAt.UTC(), nullTime(key.LastUsedAt), nullTime(key.RevokedAt))
+	return err
+}
+
+func (r *APIKeyRepositorySQLite) GetByHash(ctx context.Context, keyHash string) (models.APIKey, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", keyHash)
+	return scanAPIKey(row)
+}
+
+func (r *APIKeyRepositorySQLite) ListByOwner(ctx context.Context, owner string) ([]models.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE owner = ? ORDER BY created_at, key_id", owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *APIKeyRepositorySQLite) Revoke(ctx context.Context, owner string, keyId string, at time.Time) (bool, error) {
+	stmt, err := r.db.PrepareContext(ctx, "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE owner = ? AND key_id = ?")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, at.UTC(), owner, keyId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+func (r *APIKeyRepositorySQLite) UpdateLastUsed(ctx context.Context, lastUsed map[string]time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE key_id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for keyId, at := range lastUsed {
+		if _, err := stmt.ExecContext(ctx, at.UTC(), keyId); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func scanAPIKey(row rowScanner) (models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&key.KeyId, &key.Owner, &key.Name, &key.KeyHash, &scopes, &key.CreatedAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	key.LastUsedAt = lastUsedAt.Time
+	key.RevokedAt = revokedAt.Time
+	return key, nil
+}
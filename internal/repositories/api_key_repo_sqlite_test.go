@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+func TestAPIKeyRepositorySQLite(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewAPIKeyRepositorySQLite(db)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	keys := []models.APIKey{
+		{KeyId: "k1", Owner: "alice", Name: "ci", KeyHash: "h1", Scopes: []string{"read", "write"}, CreatedAt: now},
+		{KeyId: "k2", Owner: "alice", Name: "backup", KeyHash: "h2", Scopes: []string{"read"}, CreatedAt: now.Add(time.Second)},
+		{KeyId: "k3", Owner: "bob", Name: "ci", KeyHash: "h3", Scopes: []string{"admin"}, CreatedAt: now},
+	}
+	for _, key := range keys {
+		if err := repo.Create(ctx, key); err != nil {
+			t.Fatalf("failed to create key: %v", err)
+		}
+	}
+
+	key, err := repo.GetByHash(ctx, "h1")
+	if err != nil {
+		t.Fatalf("failed to get key: %v", err)
+	}
+	if key.KeyId != "k1" || !reflect.DeepEqual(key.Scopes, []string{"read", "write"}) || !key.LastUsedAt.IsZero() || key.Revoked() {
+		t.Fatalf("unexpected key %+v", key)
+	}
+
+	err = repo.UpdateLastUsed(ctx, map[string]time.Time{"k1": now.Add(time.Minute), "k2": now.Add(2 * time.Minute)})
+	if err != nil {
+		t.Fatalf("failed to update last use: %v", err)
+	}
+
+	ok, err := repo.Revoke(ctx, "bob", "k1", now)
+	if err != nil || ok {
+		t.Fatalf("expected another owner's key not to be revoked, got %v %v", ok, err)
+	}
+	ok, err = repo.Revoke(ctx, "alice", "k2", now)
+	if err != nil || !ok {
+		t.Fatalf("expected the key to be revoked, got %v %v", ok, err)
+	}
+
+	listed, err := repo.ListByOwner(ctx, "alice")
+	if err != nil {
+		t.Fatalf("failed to list keys: %v", err)
+	}
+	if len(listed) != 2 || listed[0].KeyId != "k1" || listed[1].KeyId != "k2" {
+		t.Fatalf("unexpected keys %+v", listed)
+	}
+	if !listed[0].LastUsedAt.Equal(now.Add(time.Minute)) || listed[0].Revoked() {
+		t.Fatalf("unexpected key %+v", listed[0])
+	}
+	if !listed[1].LastUsedAt.Equal(now.Add(2*time.Minute)) || !listed[1].RevokedAt.Equal(now) {
+		t.Fatalf("unexpected key %+v", listed[1])
+	}
+}
@@ -0,0 +1,12 @@
+package repositories
+
+import (
+	"context"
+	"time"
+)
+
+type BackfillRepository interface {
+	// Completed reports whether the backfill called name has run to the end
+	Completed(ctx context.Context, name string) (bool, error)
+	Complete(ctx context.Context, name string, at time.Time) error
+}
@@ -0,0 +1,26 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type BackfillRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewBackfillRepositorySQLite(db *sql.DB) *BackfillRepositorySQLite {
+	return &BackfillRepositorySQLite{db}
+}
+
+func (r *BackfillRepositorySQLite) Completed(ctx context.Context, name string) (bool, error) {
+	var completed bool
+	err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM backfills WHERE name = ?)", name).Scan(&completed)
+	return completed, err
+}
+
+func (r *BackfillRepositorySQLite) Complete(ctx context.Context, name string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, "INSERT OR IGNORE INTO backfills (name, completed_at) VALUES (?, ?)", name, at.UTC())
+	return err
+}
@@ -0,0 +1,27 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBackfillRepositorySQLite(t *testing.T) {
+	repo := NewBackfillRepositorySQLite(newTestDB(t))
+	ctx := context.Background()
+
+	if completed, err := repo.Completed(ctx, "metadata"); err != nil || completed {
+		t.Fatalf("expected a new backfill, got %v %v", completed, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := repo.Complete(ctx, "metadata", time.Now()); err != nil {
+			t.Fatalf("failed to complete backfill: %v", err)
+		}
+	}
+	if completed, err := repo.Completed(ctx, "metadata"); err != nil || !completed {
+		t.Fatalf("expected the backfill to be completed, got %v %v", completed, err)
+	}
+	if completed, _ := repo.Completed(ctx, "other"); completed {
+		t.Fatal("expected other backfills to be unaffected")
+	}
+}
@@ -0,0 +1,22 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+type BlobRepository interface {
+	Get(ctx context.Context, sha256Hash string) (models.Blob, error)
+	// Acquire adds a reference to the blob, creating it if needed, and
+	// returns the new reference count
+	Acquire(ctx context.Context, blob models.Blob) (int64, error)
+	// Release drops a reference to the blob, forgetting it once no
+	// reference is left, and returns the remaining reference count
+	Release(ctx context.Context, sha256Hash string) (int64, error)
+	// ListUnusedLegacy returns the MD5 hashes of blobs stored before the
+	// blob store that no file stored that way references anymore
+	ListUnusedLegacy(ctx context.Context) ([]string, error)
+	CreateLegacy(ctx context.Context, md5Hash string) error
+	DeleteLegacy(ctx context.Context, md5Hash string) error
+}
@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+type BlobRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewBlobRepositorySQLite(db *sql.DB) *BlobRepositorySQLite {
+	return &BlobRepositorySQLite{db}
+}
+
+func (r *BlobRepositorySQLite) Get(ctx context.Context, sha256Hash string) (models.Blob, error) {
+	var blob models.Blob
+	err := r.db.QueryRowContext(ctx, "SELECT sha256_hash, size, ref_count, created_at FROM blobs WHERE sha256_hash = ?", sha256Hash).
+		Scan(&blob.SHA256Hash, &blob.Size, &blob.RefCount, &blob.CreatedAt)
+	if err != nil {
+		return models.Blob{}, err
+	}
+	return blob, nil
+}
+
+func (r *BlobRepositorySQLite) Acquire(ctx context.Context, blob models.Blob) (int64, error) {
+	var refCount int64
+	err := r.db.QueryRowContext(ctx, `INSERT INTO blobs (sha256_hash, size, ref_count, created_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT (sha256_hash) DO UPDATE SET ref_count = ref_count + 1
+		RETURNING ref_count`, blob.SHA256Hash, blob.Size, blob.CreatedAt.UTC()).Scan(&refCount)
+	if err != nil {
+		return 0, err
+	}
+	return refCount, nil
+}
+
+func (r *BlobRepositorySQLite) Release(ctx context.Context, sha256Hash string) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var refCount int64
+	err = tx.QueryRowContext(ctx, "UPDATE blobs SET ref_count = ref_count - 1 WHERE sha256_hash = ? RETURNING ref_count", sha256Hash).Scan(&refCount)
+	if err != nil {
+		return 0, err
+	}
+	if refCount <= 0 {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM blobs WHERE sha256_hash = ?", sha256Hash); err != nil {
+			return 0, err
+		}
+		refCount = 0
+	}
+	return refCount, tx.Commit()
+}
+
+func (r *BlobRepositorySQLite) ListUnusedLegacy(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT md5_hash FROM legacy_blobs
+		WHERE NOT EXISTS (SELECT 1 FROM metadata WHERE metadata.md5_hash = legacy_blobs.md5_hash AND metadata.sha256_hash = '')`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := []string{}
+	for rows.Next() {
+		var md5Hash string
+		if err := rows.Scan(&md5Hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, md5Hash)
+	}
+	return hashes, rows.Err()
+}
+
+func (r *BlobRepositorySQLite) CreateLegacy(ctx context.Context, md5Hash string) error {
+	_, err := r.db.ExecContext(ctx, "INSERT OR IGNORE INTO legacy_blobs (md5_hash) VALUES (?)", md5Hash)
+	return err
+}
+
+func (r *BlobRepositorySQLite) DeleteLegacy(ctx context.Context, md5Hash string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM legacy_blobs WHERE md5_hash = ?", md5Hash)
+	return err
+}
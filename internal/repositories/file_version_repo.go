@@ -0,0 +1,23 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+type FileVersionRepository interface {
+	Create(ctx context.Context, version models.FileVersion) error
+	// Get returns sql.ErrNoRows when the file has no such version
+	Get(ctx context.Context, fileId string, versionId string) (models.FileVersion, error)
+	// ListByFile returns the versions of a file, newest first
+	ListByFile(ctx context.Context, fileId string) ([]models.FileVersion, error)
+	Delete(ctx context.Context, versionId string) error
+	// DeleteByFile removes every version of a file and returns them
+	DeleteByFile(ctx context.Context, fileId string) ([]models.FileVersion, error)
+	// ListPrunable returns the versions that are neither among the keepLast
+	// newest of their file nor created after keptAfter. A keepLast of 0 or a
+	// zero keptAfter leaves that rule out.
+	ListPrunable(ctx context.Context, keepLast int, keptAfter time.Time) ([]models.FileVersion, error)
+}
@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+const versionColumns = "version_id, file_id, owner, file_name, md5_hash, sha256_hash, size, content_type, author, created_at"
+
+type FileVersionRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewFileVersionRepositorySQLite(db *sql.DB) *FileVersionRepositorySQLite {
+	return &FileVersionRepositorySQLite{db}
+}
+
+func (r *FileVersionRepositorySQLite) Create(ctx context.Context, version models.FileVersion) error {
+	stmt, err := r.db.PrepareContext(ctx, "INSERT INTO file_versions ("+versionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, version.VersionId, version.FileId, version.Owner, version.FileName, version.MD5Hash,
+		version.SHA256Hash, version.Size, version.ContentType, version.Author, version.CreatedAt.UTC())
+	return err
+}
+
+func (r *FileVersionRepositorySQLite) Get(ctx context.Context, fileId string, versionId string) (models.FileVersion, error) {
+	stmt, err := r.db.PrepareContext(ctx, "SELECT "+versionColumns+" FROM file_versions WHERE file_id = ? AND version_id = ?")
+	if err != nil {
+		return models.FileVersion{}, err
+	}
+	defer stmt.Close()
+
+	return scanFileVersion(stmt.QueryRowContext(ctx, fileId, versionId))
+}
+
+func (r *FileVersionRepositorySQLite) ListByFile(ctx context.Context, fileId string) ([]models.FileVersion, error) {
+	return r.query(ctx, "SELECT "+versionColumns+" FROM file_versions WHERE file_id = ? ORDER BY created_at DESC, version_id DESC", fileId)
+}
+
+func (r *FileVersionRepositorySQLite) Delete(ctx context.Context, versionId string) error {
+	stmt, err := r.db.PrepareContext(ctx, "DELETE FROM file_versions WHERE version_id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, versionId)
+	return err
+}
+
+func (r *FileVersionRepositorySQLite) DeleteByFile(ctx context.Context, fileId string) ([]models.FileVersion, error) {
+	return r.query(ctx, "DELETE FROM file_versions WHERE file_id = ? RETURNING "+versionColumns, fileId)
+}
+
+func (r *FileVersionRepositorySQLite) ListPrunable(ctx context.Context, keepLast int, keptAfter time.Time) ([]models.FileVersion, error) {
+	return r.query(ctx, `SELECT `+versionColumns+` FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY file_id ORDER BY created_at DESC, version_id DESC) AS position
+			FROM file_versions
+		) WHERE (? = 0 OR position > ?) AND (? = 0 OR created_at < ?)
+		ORDER BY created_at`,
+		keepLast, keepLast, !keptAfter.IsZero(), keptAfter.UTC())
+}
+
+func (r *FileVersionRepositorySQLite) query(ctx context.Context, query string, args ...any) ([]models.FileVersion, error) {
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []models.FileVersion{}
+	for rows.Next() {
+		version, err := scanFileVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+func scanFileVersion(row rowScanner) (models.FileVersion, error) {
+	var version models.FileVersion
+	err := row.Scan(&version.VersionId, &version.FileId, &version.Owner, &version.FileName, &version.MD5Hash,
+		&version.SHA256Hash, &version.Size, &version.ContentType, &version.Author, &version.CreatedAt)
+	return version, err
+}
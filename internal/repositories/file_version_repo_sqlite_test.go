@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+func TestFileVersionRepositorySQLite(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewFileVersionRepositorySQLite(db)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	versions := []models.FileVersion{
+		{VersionId: "a1", FileId: "a", Owner: "alice", FileName: "a.txt", Size: 1, Author: "alice", CreatedAt: now.Add(-72 * time.Hour)},
+		{VersionId: "a2", FileId: "a", Owner: "alice", FileName: "a.txt", Size: 2, Author: "bob", CreatedAt: now.Add(-48 * time.Hour)},
+		{VersionId: "a3", FileId: "a", Owner: "alice", FileName: "a.txt", Size: 3, Author: "alice", CreatedAt: now.Add(-time.Hour)},
+		{VersionId: "b1", FileId: "b", Owner: "alice", FileName: "b.txt", Size: 4, Author: "alice", CreatedAt: now.Add(-96 * time.Hour)},
+	}
+	for _, version := range versions {
+		if err := repo.Create(ctx, version); err != nil {
+			t.Fatalf("failed to create version: %v", err)
+		}
+	}
+
+	ids := func(versions []models.FileVersion) []string {
+		ids := []string{}
+		for _, version := range versions {
+			ids = append(ids, version.VersionId)
+		}
+		return ids
+	}
+	expectIds := func(got []models.FileVersion, err error, want ...string) {
+		if want == nil {
+			want = []string{}
+		}
+		t.Helper()
+		if err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+		if gotIds := ids(got); !slices.Equal(gotIds, want) {
+			t.Fatalf("expected %v, got %v", want, gotIds)
+		}
+	}
+
+	t.Run("list and get", func(t *testing.T) {
+		listed, err := repo.ListByFile(ctx, "a")
+		expectIds(listed, err, "a3", "a2", "a1")
+
+		version, err := repo.Get(ctx, "a", "a2")
+		if err != nil {
+			t.Fatalf("failed to get version: %v", err)
+		}
+		if version.Author != "bob" || version.Size != 2 {
+			t.Fatalf("unexpected version %+v", version)
+		}
+		if _, err := repo.Get(ctx, "b", "a2"); err != sql.ErrNoRows {
+			t.Fatalf("versions of another file should not be found, got %v", err)
+		}
+	})
+
+	t.Run("prunable", func(t *testing.T) {
+		prunable, err := repo.ListPrunable(ctx, 1, time.Time{})
+		expectIds(prunable, err, "a1", "a2")
+
+		prunable, err = repo.ListPrunable(ctx, 0, now.Add(-60*time.Hour))
+		expectIds(prunable, err, "b1", "a1")
+
+		// either rule keeps a version
+		prunable, err = repo.ListPrunable(ctx, 2, now.Add(-60*time.Hour))
+		expectIds(prunable, err, "a1")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := repo.Delete(ctx, "b1"); err != nil {
+			t.Fatalf("failed to delete version: %v", err)
+		}
+		deleted, err := repo.DeleteByFile(ctx, "a")
+		if err != nil || len(deleted) != 3 {
+			t.Fatalf("expected 3 deleted versions, got %v %v", ids(deleted), err)
+		}
+		prunable, err := repo.ListPrunable(ctx, 1, time.Time{})
+		expectIds(prunable, err)
+	})
+}
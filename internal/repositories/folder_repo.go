@@ -0,0 +1,30 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+var ErrPathTaken = errors.New("path is taken")
+
+type FolderRepository interface {
+	// Ensure creates the folders at paths that do not exist yet
+	Ensure(ctx context.Context, owner string, paths []string, at time.Time) error
+	// Get returns sql.ErrNoRows when the folder does not exist
+	Get(ctx context.Context, owner string, path string) (models.Folder, error)
+	// ListChildren returns the folders directly inside parent, or at the top
+	// level for an empty parent, ordered by path
+	ListChildren(ctx context.Context, owner string, parent string) ([]models.Folder, error)
+	// ListTree returns the folder at path and every folder below it
+	ListTree(ctx context.Context, owner string, path string) ([]models.Folder, error)
+	// Move gives the folder at from the path to, together with every file
+	// and folder below it and the grants and share links that refer to them.
+	// The parents of to are created as needed. It fails with ErrPathTaken
+	// when a file or folder exists at to.
+	Move(ctx context.Context, owner string, from string, to string, at time.Time) error
+	// DeleteTree removes the folder at path and every folder below it
+	DeleteTree(ctx context.Context, owner string, path string) error
+}
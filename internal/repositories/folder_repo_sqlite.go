@@ -0,0 +1,135 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+type FolderRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewFolderRepositorySQLite(db *sql.DB) *FolderRepositorySQLite {
+	return &FolderRepositorySQLite{db}
+}
+
+// execer is what *sql.DB and *sql.Tx have in common
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (r *FolderRepositorySQLite) Ensure(ctx context.Context, owner string, paths []string, at time.Time) error {
+	return ensureFolders(ctx, r.db, owner, paths, at)
+}
+
+func ensureFolders(ctx context.Context, db execer, owner string, paths []string, at time.Time) error {
+	for _, path := range paths {
+		_, err := db.ExecContext(ctx, "INSERT OR IGNORE INTO folders (owner, path, created_at) VALUES (?, ?, ?)", owner, path, at.UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *FolderRepositorySQLite) Get(ctx context.Context, owner string, path string) (models.Folder, error) {
+	folder := models.Folder{Owner: owner}
+	err := r.db.QueryRowContext(ctx, "SELECT path, created_at FROM folders WHERE owner = ? AND path = ?", owner, path).
+		Scan(&folder.Path, &folder.CreatedAt)
+	return folder, err
+}
+
+func (r *FolderRepositorySQLite) ListChildren(ctx context.Context, owner string, parent string) ([]models.Folder, error) {
+	prefix := ""
+	if parent != "" {
+		prefix = parent + "/"
+	}
+	// substr rather than LIKE, see MetaRepositorySQLite.List
+	return r.query(ctx, owner, `SELECT path, created_at FROM folders
+		WHERE owner = ? AND substr(path, 1, ?) = ? AND instr(substr(path, ?), '/') = 0 ORDER BY path`,
+		owner, runeLen(prefix), prefix, runeLen(prefix)+1)
+}
+
+func (r *FolderRepositorySQLite) ListTree(ctx context.Context, owner string, path string) ([]models.Folder, error) {
+	return r.query(ctx, owner, "SELECT path, created_at FROM folders WHERE owner = ? AND (path = ? OR substr(path, 1, ?) = ?) ORDER BY path",
+		owner, path, runeLen(path)+1, path+"/")
+}
+
+func (r *FolderRepositorySQLite) Move(ctx context.Context, owner string, from string, to string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM folders WHERE owner = ? AND (path = ? OR substr(path, 1, ?) = ?))
+		OR EXISTS (SELECT 1 FROM metadata WHERE owner = ? AND (file_name = ? OR substr(file_name, 1, ?) = ?))`,
+		owner, to, runeLen(to)+1, to+"/", owner, to, runeLen(to)+1, to+"/").Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrPathTaken
+	}
+
+	// every path below from keeps its remainder after from
+	fromPrefix := from + "/"
+	rest := runeLen(from) + 1
+	moves := []struct {
+		table  string
+		column string
+	}{
+		{"folders", "path"},
+		{"metadata", "file_name"},
+		{"file_versions", "file_name"},
+		{"acls", "path"},
+		{"share_links", "file_name"},
+	}
+	for _, move := range moves {
+		query := strings.NewReplacer("{table}", move.table, "{column}", move.column).Replace(
+			`UPDATE {table} SET {column} = ? || substr({column}, ?)
+			WHERE owner = ? AND ({column} = ? OR substr({column}, 1, ?) = ?)`)
+		if _, err := tx.ExecContext(ctx, query, to, rest, owner, from, runeLen(fromPrefix), fromPrefix); err != nil {
+			return err
+		}
+	}
+
+	if err := ensureFolders(ctx, tx, owner, models.ParentFolders(to), at); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *FolderRepositorySQLite) DeleteTree(ctx context.Context, owner string, path string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM folders WHERE owner = ? AND (path = ? OR substr(path, 1, ?) = ?)",
+		owner, path, runeLen(path)+1, path+"/")
+	return err
+}
+
+func (r *FolderRepositorySQLite) query(ctx context.Context, owner string, query string, args ...any) ([]models.Folder, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := []models.Folder{}
+	for rows.Next() {
+		folder := models.Folder{Owner: owner}
+		if err := rows.Scan(&folder.Path, &folder.CreatedAt); err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+	return folders, rows.Err()
+}
+
+// runeLen is the length of s as SQLite's substr counts it
+func runeLen(s string) int {
+	return len([]rune(s))
+}
@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+func TestFolderRepositorySQLite(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewFolderRepositorySQLite(db)
+	metaRepo := NewMetaRepositorySQLite(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	paths := func(folders []models.Folder) []string {
+		result := make([]string, 0, len(folders))
+		for _, folder := range folders {
+			result = append(result, folder.Path)
+		}
+		return result
+	}
+
+	if err := repo.Ensure(ctx, "alice", []string{"docs", "docs/2024", "docs/2025", "music"}, now); err != nil {
+		t.Fatalf("failed to create folders: %v", err)
+	}
+	// existing folders are kept as they are
+	if err := repo.Ensure(ctx, "alice", []string{"docs"}, now.Add(time.Hour)); err != nil {
+		t.Fatalf("failed to create folders: %v", err)
+	}
+	if err := metaRepo.Create(ctx, models.FileMetadata{FileId: "1", Owner: "alice", FileName: "docs/2024/a.txt"}); err != nil {
+		t.Fatalf("failed to create metadata: %v", err)
+	}
+
+	t.Run("listing", func(t *testing.T) {
+		top, err := repo.ListChildren(ctx, "alice", "")
+		if err != nil || !slices.Equal(paths(top), []string{"docs", "music"}) {
+			t.Fatalf("unexpected top level folders %v %v", paths(top), err)
+		}
+		children, err := repo.ListChildren(ctx, "alice", "docs")
+		if err != nil || !slices.Equal(paths(children), []string{"docs/2024", "docs/2025"}) {
+			t.Fatalf("unexpected children %v %v", paths(children), err)
+		}
+		tree, err := repo.ListTree(ctx, "alice", "docs")
+		if err != nil || !slices.Equal(paths(tree), []string{"docs", "docs/2024", "docs/2025"}) {
+			t.Fatalf("unexpected tree %v %v", paths(tree), err)
+		}
+		if _, err := repo.Get(ctx, "bob", "docs"); err != sql.ErrNoRows {
+			t.Fatalf("expected folders to belong to their owner, got %v", err)
+		}
+	})
+
+	t.Run("move", func(t *testing.T) {
+		if err := repo.Move(ctx, "alice", "docs", "music", now); !errors.Is(err, ErrPathTaken) {
+			t.Fatalf("expected the path to be taken, got %v", err)
+		}
+		if err := repo.Move(ctx, "alice", "docs/2024", "archive/old", now); err != nil {
+			t.Fatalf("failed to move folder: %v", err)
+		}
+		if _, err := repo.Get(ctx, "alice", "archive"); err != nil {
+			t.Fatalf("expected the parent to be created, got %v", err)
+		}
+		if _, err := metaRepo.GetByName(ctx, "alice", "archive/old/a.txt"); err != nil {
+			t.Fatalf("expected the file to move, got %v", err)
+		}
+		if _, err := repo.Get(ctx, "alice", "docs/2024"); err != sql.ErrNoRows {
+			t.Fatalf("expected the old folder to be gone, got %v", err)
+		}
+	})
+
+	t.Run("delete tree", func(t *testing.T) {
+		if err := repo.DeleteTree(ctx, "alice", "archive"); err != nil {
+			t.Fatalf("failed to delete folders: %v", err)
+		}
+		top, err := repo.ListChildren(ctx, "alice", "")
+		if err != nil || !slices.Equal(paths(top), []string{"docs", "music"}) {
+			t.Fatalf("unexpected top level folders %v %v", paths(top), err)
+		}
+	})
+}
@@ -2,13 +2,90 @@ package repositories
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
 
 	"github.com/Iwoooooods/fs-upload-go/internal/models"
 )
 
+const (
+	SORT_BY_NAME = "name"
+	SORT_BY_SIZE = "size"
+	SORT_BY_DATE = "date"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 type MetaRepository interface {
 	Create(ctx context.Context, metadata models.FileMetadata) error
 	Get(ctx context.Context, field string, value string) (models.FileMetadata, error)
+	GetByName(ctx context.Context, owner string, fileName string) (models.FileMetadata, error)
 	Update(ctx context.Context, metadata models.FileMetadata) error
+	// MarkAccessed records that the file was read at the given time
+	MarkAccessed(ctx context.Context, fileId string, at time.Time) error
 	Delete(ctx context.Context, fileId string) error
+	// Move gives a file a new owner and name, keeping its id, content and
+	// versions. Grants and share links follow a file moved within its
+	// owner's files; those of a file given to another user are dropped, as
+	// they were the previous owner's. It returns sql.ErrNoRows for an
+	// unknown file.
+	Move(ctx context.Context, fileId string, toOwner string, toName string, at time.Time) error
+	// List returns one page of the owner's files and the cursor of the next
+	// page, which is empty on the last page
+	List(ctx context.Context, opts ListOptions) ([]models.FileMetadata, string, error)
+}
+
+// ListOptions selects and orders the files returned by List
+type ListOptions struct {
+	Owner string
+	// Prefix keeps only file names starting with it
+	Prefix string
+	// Shallow keeps only the files directly inside the folder Prefix ends
+	// with, leaving out those in its subfolders
+	Shallow bool
+	// Glob keeps only file names matching it, using SQLite GLOB syntax
+	Glob string
+	// SortBy is one of the SORT_BY_* constants, SORT_BY_NAME by default
+	SortBy     string
+	Descending bool
+	Limit      int
+	// Cursor continues a previous listing with the same options
+	Cursor string
+}
+
+// listCursor is the sort key of the last file on a page. Paging by key rather
+// than offset keeps pages stable while files are added or removed.
+type listCursor struct {
+	Name   string    `json:"n,omitempty"`
+	Size   int64     `json:"s,omitempty"`
+	Date   time.Time `json:"d,omitempty"`
+	FileId string    `json:"i"`
+}
+
+func newListCursor(metadata models.FileMetadata) listCursor {
+	return listCursor{
+		Name:   metadata.FileName,
+		Size:   metadata.Size,
+		Date:   metadata.UpdatedAt,
+		FileId: metadata.FileId,
+	}
+}
+
+func (c listCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeListCursor(s string) (listCursor, error) {
+	var c listCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &c); err != nil || c.FileId == "" {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
 }
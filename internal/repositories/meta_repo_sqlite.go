@@ -3,12 +3,16 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/Iwoooooods/fs-upload-go/internal/models"
 )
 
+const metaColumns = "file_id, owner, file_name, md5_hash, sha256_hash, size, content_type, created_at, updated_at, last_accessed_at, storage_path, version_id, author, properties"
+
 type MetaRepositorySQLite struct {
 	db *sql.DB
 }
@@ -18,13 +22,15 @@ func NewMetaRepositorySQLite(db *sql.DB) *MetaRepositorySQLite {
 }
 
 func (r *MetaRepositorySQLite) Create(ctx context.Context, metadata models.FileMetadata) error {
-	stmt, err := r.db.PrepareContext(ctx, "INSERT INTO metadata (file_id, file_name, md5_hash) VALUES (?, ?, ?)")
+	stmt, err := r.db.PrepareContext(ctx, "INSERT INTO metadata ("+metaColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	result, err := stmt.ExecContext(ctx, metadata.FileId, metadata.FileName, metadata.MD5Hash)
+	result, err := stmt.ExecContext(ctx, metadata.FileId, metadata.Owner, metadata.FileName, metadata.MD5Hash, metadata.SHA256Hash,
+		metadata.Size, metadata.ContentType, metadata.CreatedAt.UTC(), metadata.UpdatedAt.UTC(), nullTime(metadata.LastAccessedAt), metadata.StoragePath,
+		metadata.VersionId, metadata.Author, encodeProperties(metadata.Properties))
 	if err != nil {
 		return err
 	}
@@ -39,32 +45,38 @@ func (r *MetaRepositorySQLite) Create(ctx context.Context, metadata models.FileM
 }
 
 func (r *MetaRepositorySQLite) Get(ctx context.Context, field string, value string) (models.FileMetadata, error) {
-	stmt, err := r.db.PrepareContext(ctx, fmt.Sprintf("SELECT * FROM metadata WHERE %s = ?", field))
+	stmt, err := r.db.PrepareContext(ctx, fmt.Sprintf("SELECT "+metaColumns+" FROM metadata WHERE %s = ?", field))
 	if err != nil {
 		log.Printf("failed to prepare statement: %v", err)
 		return models.FileMetadata{}, err
 	}
 	defer stmt.Close()
 
-	var metadata models.FileMetadata
-	var id int64
+	return scanMetadata(stmt.QueryRowContext(ctx, value))
+}
 
-	err = stmt.QueryRowContext(ctx, value).Scan(&id, &metadata.FileId, &metadata.FileName, &metadata.MD5Hash)
+func (r *MetaRepositorySQLite) GetByName(ctx context.Context, owner string, fileName string) (models.FileMetadata, error) {
+	stmt, err := r.db.PrepareContext(ctx, "SELECT "+metaColumns+" FROM metadata WHERE owner = ? AND file_name = ?")
 	if err != nil {
+		log.Printf("failed to prepare statement: %v", err)
 		return models.FileMetadata{}, err
 	}
+	defer stmt.Close()
 
-	return metadata, nil
+	return scanMetadata(stmt.QueryRowContext(ctx, owner, fileName))
 }
 
 func (r *MetaRepositorySQLite) Update(ctx context.Context, metadata models.FileMetadata) error {
-	stmt, err := r.db.PrepareContext(ctx, "UPDATE metadata SET file_name = ?, md5_hash = ? WHERE file_id = ?")
+	stmt, err := r.db.PrepareContext(ctx, `UPDATE metadata SET owner = ?, file_name = ?, md5_hash = ?, sha256_hash = ?, size = ?, content_type = ?,
+		created_at = ?, updated_at = ?, storage_path = ?, version_id = ?, author = ?, properties = ? WHERE file_id = ?`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, metadata.FileName, metadata.MD5Hash, metadata.FileId)
+	_, err = stmt.ExecContext(ctx, metadata.Owner, metadata.FileName, metadata.MD5Hash, metadata.SHA256Hash,
+		metadata.Size, metadata.ContentType, metadata.CreatedAt.UTC(), metadata.UpdatedAt.UTC(), metadata.StoragePath,
+		metadata.VersionId, metadata.Author, encodeProperties(metadata.Properties), metadata.FileId)
 	if err != nil {
 		return err
 	}
@@ -73,6 +85,17 @@ func (r *MetaRepositorySQLite) Update(ctx context.Context, metadata models.FileM
 	return nil
 }
 
+func (r *MetaRepositorySQLite) MarkAccessed(ctx context.Context, fileId string, at time.Time) error {
+	stmt, err := r.db.PrepareContext(ctx, "UPDATE metadata SET last_accessed_at = ? WHERE file_id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, at.UTC(), fileId)
+	return err
+}
+
 func (r *MetaRepositorySQLite) Delete(ctx context.Context, fileId string) error {
 	stmt, err := r.db.PrepareContext(ctx, "DELETE FROM metadata WHERE file_id = ?")
 	if err != nil {
@@ -88,3 +111,171 @@ func (r *MetaRepositorySQLite) Delete(ctx context.Context, fileId string) error
 
 	return nil
 }
+
+func (r *MetaRepositorySQLite) Move(ctx context.Context, fileId string, toOwner string, toName string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var owner, name string
+	if err := tx.QueryRowContext(ctx, "SELECT owner, file_name FROM metadata WHERE file_id = ?", fileId).Scan(&owner, &name); err != nil {
+		return err
+	}
+
+	type statement struct {
+		query string
+		args  []any
+	}
+	statements := []statement{
+		{"UPDATE metadata SET owner = ?, file_name = ? WHERE file_id = ?", []any{toOwner, toName, fileId}},
+		{"UPDATE file_versions SET owner = ?, file_name = ? WHERE file_id = ?", []any{toOwner, toName, fileId}},
+	}
+	if owner == toOwner {
+		statements = append(statements,
+			statement{"UPDATE OR REPLACE acls SET path = ? WHERE owner = ? AND path = ?", []any{toName, owner, name}},
+			statement{"UPDATE share_links SET file_name = ? WHERE owner = ? AND file_name = ?", []any{toName, owner, name}})
+	} else {
+		statements = append(statements,
+			statement{"DELETE FROM acls WHERE owner = ? AND path = ?", []any{owner, name}},
+			statement{"UPDATE share_links SET revoked_at = ? WHERE owner = ? AND file_name = ? AND revoked_at IS NULL", []any{at.UTC(), owner, name}})
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *MetaRepositorySQLite) List(ctx context.Context, opts ListOptions) ([]models.FileMetadata, string, error) {
+	var column string
+	switch opts.SortBy {
+	case SORT_BY_NAME, "":
+		column = "file_name"
+	case SORT_BY_SIZE:
+		column = "size"
+	case SORT_BY_DATE:
+		column = "updated_at"
+	default:
+		return nil, "", fmt.Errorf("unknown sort field %q", opts.SortBy)
+	}
+	order, compare := "ASC", ">"
+	if opts.Descending {
+		order, compare = "DESC", "<"
+	}
+
+	query := "SELECT " + metaColumns + " FROM metadata WHERE owner = ?"
+	args := []any{opts.Owner}
+	if opts.Prefix != "" {
+		// substr rather than LIKE, which is case-insensitive and treats % and _
+		// in the prefix as wildcards
+		query += " AND substr(file_name, 1, ?) = ?"
+		args = append(args, len([]rune(opts.Prefix)), opts.Prefix)
+	}
+	if opts.Shallow {
+		query += " AND instr(substr(file_name, ?), '/') = 0"
+		args = append(args, len([]rune(opts.Prefix))+1)
+	}
+	if opts.Glob != "" {
+		query += " AND file_name GLOB ?"
+		args = append(args, opts.Glob)
+	}
+	if opts.Cursor != "" {
+		cursor, err := decodeListCursor(opts.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		var after any
+		switch column {
+		case "file_name":
+			after = cursor.Name
+		case "size":
+			after = cursor.Size
+		case "updated_at":
+			after = cursor.Date.UTC()
+		}
+		query += fmt.Sprintf(" AND (%[1]s %[2]s ? OR (%[1]s = ? AND file_id %[2]s ?))", column, compare)
+		args = append(args, after, after, cursor.FileId)
+	}
+	// file_id breaks ties so that no file is skipped or repeated between pages
+	query += fmt.Sprintf(" ORDER BY %[1]s %[2]s, file_id %[2]s LIMIT ?", column, order)
+	// one extra row tells whether there is a next page
+	args = append(args, opts.Limit+1)
+
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		log.Printf("failed to prepare statement: %v", err)
+		return nil, "", err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	files := []models.FileMetadata{}
+	for rows.Next() {
+		metadata, err := scanMetadata(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		files = append(files, metadata)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(files) <= opts.Limit {
+		return files, "", nil
+	}
+	files = files[:opts.Limit]
+	return files, newListCursor(files[len(files)-1]).encode(), nil
+}
+
+func scanMetadata(row rowScanner) (models.FileMetadata, error) {
+	var metadata models.FileMetadata
+	var lastAccessedAt sql.NullTime
+	var properties string
+	err := row.Scan(&metadata.FileId, &metadata.Owner, &metadata.FileName, &metadata.MD5Hash, &metadata.SHA256Hash,
+		&metadata.Size, &metadata.ContentType, &metadata.CreatedAt, &metadata.UpdatedAt, &lastAccessedAt, &metadata.StoragePath,
+		&metadata.VersionId, &metadata.Author, &properties)
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
+	metadata.LastAccessedAt = lastAccessedAt.Time
+	metadata.Properties, err = decodeProperties(properties)
+	return metadata, err
+}
+
+// encodeProperties stores custom properties as a JSON object
+func encodeProperties(properties map[string]string) string {
+	if len(properties) == 0 {
+		return "{}"
+	}
+	encoded, _ := json.Marshal(properties)
+	return string(encoded)
+}
+
+// decodeProperties reads what encodeProperties stored, giving nil for none
+func decodeProperties(encoded string) (map[string]string, error) {
+	var properties map[string]string
+	if err := json.Unmarshal([]byte(encoded), &properties); err != nil {
+		return nil, err
+	}
+	if len(properties) == 0 {
+		return nil, nil
+	}
+	return properties, nil
+}
+
+// nullTime stores the zero time as NULL
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
@@ -3,33 +3,34 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/Iwoooooods/fs-upload-go/internal/database"
 	"github.com/Iwoooooods/fs-upload-go/internal/models"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func TestMetaRepositorySQLite_Create(t *testing.T) {
+// newTestDB opens an in-memory database with the full schema
+func newTestDB(t *testing.T) *sql.DB {
 	db, err := sql.Open("sqlite3", ":memory:")
 	if err != nil {
 		t.Fatalf("failed to open database: %v", err)
 	}
-	defer db.Close()
-
-	//create table
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS metadata (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			file_id TEXT NOT NULL,
-			file_name TEXT NOT NULL,
-			md5_hash TEXT NOT NULL
-		);
-	`)
-	if err != nil {
-		t.Fatalf("failed to create table: %v", err)
+	t.Cleanup(func() { db.Close() })
+	// every connection of an in-memory database is a new database
+	db.SetMaxOpenConns(1)
+
+	if err := database.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
 	}
+	return db
+}
 
+func TestMetaRepositorySQLite_Create(t *testing.T) {
+	db := newTestDB(t)
 	repo := NewMetaRepositorySQLite(db)
 	t.Run("create", func(t *testing.T) {
 		err := repo.Create(context.Background(), models.FileMetadata{
@@ -69,6 +70,21 @@ func TestMetaRepositorySQLite_Create(t *testing.T) {
 
 	})
 
+	t.Run("properties", func(t *testing.T) {
+		err := repo.Update(context.Background(), models.FileMetadata{
+			FileId:     "1",
+			FileName:   "test2.txt",
+			Properties: map[string]string{"camera": "X100"},
+		})
+		if err != nil {
+			t.Fatalf("failed to update metadata: %v", err)
+		}
+		meta, err := repo.Get(context.Background(), "file_id", "1")
+		if err != nil || meta.Properties["camera"] != "X100" || len(meta.Properties) != 1 {
+			t.Fatalf("expected the properties to be stored, got %v %v", meta.Properties, err)
+		}
+	})
+
 	t.Run("delete", func(t *testing.T) {
 		err := repo.Delete(context.Background(), "1")
 		if err != nil {
@@ -80,3 +96,137 @@ func TestMetaRepositorySQLite_Create(t *testing.T) {
 		}
 	})
 }
+
+func TestMetaRepositorySQLite_List(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewMetaRepositorySQLite(db)
+	ctx := context.Background()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	names := []string{"b.txt", "a.txt", "c.log", "a_b.txt", "d.txt"}
+	for i, name := range names {
+		err := repo.Create(ctx, models.FileMetadata{
+			FileId:    fmt.Sprint(i),
+			Owner:     "alice",
+			FileName:  name,
+			Size:      int64(len(names) - i),
+			CreatedAt: base,
+			UpdatedAt: base.Add(time.Duration(i) * time.Millisecond),
+		})
+		if err != nil {
+			t.Fatalf("failed to create metadata: %v", err)
+		}
+	}
+	err := repo.Create(ctx, models.FileMetadata{FileId: "bob", Owner: "bob", FileName: "a.txt"})
+	if err != nil {
+		t.Fatalf("failed to create metadata: %v", err)
+	}
+
+	// listAll follows the cursor through every page
+	listAll := func(opts ListOptions) []string {
+		t.Helper()
+		var all []string
+		for {
+			files, next, err := repo.List(ctx, opts)
+			if err != nil {
+				t.Fatalf("failed to list metadata: %v", err)
+			}
+			if len(files) > opts.Limit {
+				t.Fatalf("expected at most %d files, got %d", opts.Limit, len(files))
+			}
+			for _, file := range files {
+				all = append(all, file.FileName)
+			}
+			if next == "" {
+				return all
+			}
+			opts.Cursor = next
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		{"by name", ListOptions{}, []string{"a.txt", "a_b.txt", "b.txt", "c.log", "d.txt"}},
+		{"by name descending", ListOptions{Descending: true}, []string{"d.txt", "c.log", "b.txt", "a_b.txt", "a.txt"}},
+		{"by size", ListOptions{SortBy: SORT_BY_SIZE}, []string{"d.txt", "a_b.txt", "c.log", "a.txt", "b.txt"}},
+		{"by date descending", ListOptions{SortBy: SORT_BY_DATE, Descending: true}, []string{"d.txt", "a_b.txt", "c.log", "a.txt", "b.txt"}},
+		{"prefix", ListOptions{Prefix: "a_"}, []string{"a_b.txt"}},
+		{"glob", ListOptions{Glob: "*.txt", SortBy: SORT_BY_SIZE}, []string{"d.txt", "a_b.txt", "a.txt", "b.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, limit := range []int{1, 2, 10} {
+				opts := tt.opts
+				opts.Owner = "alice"
+				opts.Limit = limit
+				got := listAll(opts)
+				if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+					t.Fatalf("limit %d: expected %v, got %v", limit, tt.want, got)
+				}
+			}
+		})
+	}
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		_, _, err := repo.List(ctx, ListOptions{Owner: "alice", Limit: 1, Cursor: "not a cursor"})
+		if err != ErrInvalidCursor {
+			t.Fatalf("expected ErrInvalidCursor, got %v", err)
+		}
+	})
+}
+
+func TestMetaRepositorySQLite_Move(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewMetaRepositorySQLite(db)
+	links := NewShareLinkRepositorySQLite(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	if err := repo.Create(ctx, models.FileMetadata{FileId: "1", Owner: "alice", FileName: "a.txt"}); err != nil {
+		t.Fatalf("failed to create metadata: %v", err)
+	}
+	if err := links.Create(ctx, models.ShareLink{LinkId: "l1", TokenHash: "h1", Owner: "alice", FileName: "a.txt", CreatedAt: now}); err != nil {
+		t.Fatalf("failed to create share link: %v", err)
+	}
+
+	linkOf := func(owner string) models.ShareLink {
+		t.Helper()
+		list, err := links.ListByOwner(ctx, owner)
+		if err != nil || len(list) != 1 {
+			t.Fatalf("expected one link, got %v %v", list, err)
+		}
+		return list[0]
+	}
+
+	t.Run("within the owner's files", func(t *testing.T) {
+		if err := repo.Move(ctx, "1", "alice", "docs/a.txt", now); err != nil {
+			t.Fatalf("failed to move metadata: %v", err)
+		}
+		if _, err := repo.GetByName(ctx, "alice", "docs/a.txt"); err != nil {
+			t.Fatalf("expected the file at its new name, got %v", err)
+		}
+		if link := linkOf("alice"); link.FileName != "docs/a.txt" || !link.RevokedAt.IsZero() {
+			t.Fatalf("expected the link to follow the file, got %+v", link)
+		}
+	})
+
+	t.Run("to another user", func(t *testing.T) {
+		if err := repo.Move(ctx, "1", "bob", "a.txt", now); err != nil {
+			t.Fatalf("failed to move metadata: %v", err)
+		}
+		meta, err := repo.Get(ctx, "file_id", "1")
+		if err != nil || meta.Owner != "bob" || meta.FileName != "a.txt" {
+			t.Fatalf("unexpected metadata %+v %v", meta, err)
+		}
+		if link := linkOf("alice"); link.RevokedAt.IsZero() {
+			t.Fatalf("expected alice's link to be revoked, got %+v", link)
+		}
+	})
+
+	if err := repo.Move(ctx, "missing", "bob", "b.txt", now); err != sql.ErrNoRows {
+		t.Fatalf("expected no rows, got %v", err)
+	}
+}
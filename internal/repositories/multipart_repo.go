@@ -0,0 +1,18 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+type MultipartRepository interface {
+	CreateUpload(ctx context.Context, upload models.MultipartUpload) error
+	GetUpload(ctx context.Context, uploadId string) (models.MultipartUpload, error)
+	DeleteUpload(ctx context.Context, uploadId string) error
+	ListStaleUploads(ctx context.Context, before time.Time) ([]models.MultipartUpload, error)
+	PutPart(ctx context.Context, part models.MultipartPart) error
+	ListParts(ctx context.Context, uploadId string) ([]models.MultipartPart, error)
+	DeletePart(ctx context.Context, uploadId string, partNumber int) error
+}
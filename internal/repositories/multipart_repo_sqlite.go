@@ -0,0 +1,119 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+type MultipartRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewMultipartRepositorySQLite(db *sql.DB) *MultipartRepositorySQLite {
+	return &MultipartRepositorySQLite{db}
+}
+
+func (r *MultipartRepositorySQLite) CreateUpload(ctx context.Context, upload models.MultipartUpload) error {
+	stmt, err := r.db.PrepareContext(ctx, "INSERT INTO multipart_uploads (upload_id, owner, file_name, created_at, updated_at) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, upload.UploadId, upload.Owner, upload.FileName, upload.CreatedAt.UTC(), upload.UpdatedAt.UTC())
+	return err
+}
+
+func (r *MultipartRepositorySQLite) GetUpload(ctx context.Context, uploadId string) (models.MultipartUpload, error) {
+	var upload models.MultipartUpload
+	err := r.db.QueryRowContext(ctx, "SELECT upload_id, owner, file_name, created_at, updated_at FROM multipart_uploads WHERE upload_id = ?", uploadId).
+		Scan(&upload.UploadId, &upload.Owner, &upload.FileName, &upload.CreatedAt, &upload.UpdatedAt)
+	if err != nil {
+		return models.MultipartUpload{}, err
+	}
+	return upload, nil
+}
+
+// DeleteUpload removes the session together with all of its parts
+func (r *MultipartRepositorySQLite) DeleteUpload(ctx context.Context, uploadId string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM multipart_parts WHERE upload_id = ?", uploadId); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM multipart_uploads WHERE upload_id = ?", uploadId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListStaleUploads returns the sessions that saw no activity since before
+func (r *MultipartRepositorySQLite) ListStaleUploads(ctx context.Context, before time.Time) ([]models.MultipartUpload, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT upload_id, owner, file_name, created_at, updated_at FROM multipart_uploads WHERE updated_at < ?", before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uploads []models.MultipartUpload
+	for rows.Next() {
+		var upload models.MultipartUpload
+		if err := rows.Scan(&upload.UploadId, &upload.Owner, &upload.FileName, &upload.CreatedAt, &upload.UpdatedAt); err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, rows.Err()
+}
+
+// PutPart records a part, replacing an earlier upload of the same part
+// number, and marks the session as active
+func (r *MultipartRepositorySQLite) PutPart(ctx context.Context, part models.MultipartPart) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO multipart_parts (upload_id, part_number, size, md5_hash, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (upload_id, part_number) DO UPDATE SET size = excluded.size, md5_hash = excluded.md5_hash, created_at = excluded.created_at`,
+		part.UploadId, part.PartNumber, part.Size, part.MD5Hash, part.CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE multipart_uploads SET updated_at = ? WHERE upload_id = ?", part.CreatedAt.UTC(), part.UploadId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *MultipartRepositorySQLite) ListParts(ctx context.Context, uploadId string) ([]models.MultipartPart, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT upload_id, part_number, size, md5_hash, created_at FROM multipart_parts WHERE upload_id = ? ORDER BY part_number", uploadId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var parts []models.MultipartPart
+	for rows.Next() {
+		var part models.MultipartPart
+		if err := rows.Scan(&part.UploadId, &part.PartNumber, &part.Size, &part.MD5Hash, &part.CreatedAt); err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	return parts, rows.Err()
+}
+
+func (r *MultipartRepositorySQLite) DeletePart(ctx context.Context, uploadId string, partNumber int) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM multipart_parts WHERE upload_id = ? AND part_number = ?", uploadId, partNumber)
+	return err
+}
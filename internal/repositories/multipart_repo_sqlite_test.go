@@ -0,0 +1,94 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestMultipartRepositorySQLite(t *testing.T) {
+	db := newTestDB(t)
+
+	repo := NewMultipartRepositorySQLite(db)
+	ctx := context.Background()
+	created := time.Now().UTC().Add(-2 * time.Hour)
+
+	err := repo.CreateUpload(ctx, models.MultipartUpload{
+		UploadId:  "1",
+		Owner:     "testuser",
+		FileName:  "test.bin",
+		CreatedAt: created,
+		UpdatedAt: created,
+	})
+	if err != nil {
+		t.Fatalf("failed to create upload: %v", err)
+	}
+
+	t.Run("stale without activity", func(t *testing.T) {
+		stale, err := repo.ListStaleUploads(ctx, time.Now().Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("failed to list stale uploads: %v", err)
+		}
+		if len(stale) != 1 {
+			t.Fatalf("expected 1 stale upload, got %d", len(stale))
+		}
+	})
+
+	t.Run("put part replaces and refreshes", func(t *testing.T) {
+		now := time.Now().UTC()
+		for _, hash := range []string{"aaa", "bbb"} {
+			err := repo.PutPart(ctx, models.MultipartPart{UploadId: "1", PartNumber: 1, Size: 3, MD5Hash: hash, CreatedAt: now})
+			if err != nil {
+				t.Fatalf("failed to put part: %v", err)
+			}
+		}
+		parts, err := repo.ListParts(ctx, "1")
+		if err != nil {
+			t.Fatalf("failed to list parts: %v", err)
+		}
+		if len(parts) != 1 || parts[0].MD5Hash != "bbb" {
+			t.Fatalf("expected the part to be replaced, got %v", parts)
+		}
+		stale, err := repo.ListStaleUploads(ctx, time.Now().Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("failed to list stale uploads: %v", err)
+		}
+		if len(stale) != 0 {
+			t.Fatalf("expected no stale uploads, got %d", len(stale))
+		}
+	})
+
+	t.Run("delete part", func(t *testing.T) {
+		err := repo.PutPart(ctx, models.MultipartPart{UploadId: "1", PartNumber: 2, Size: 3, MD5Hash: "ccc", CreatedAt: time.Now().UTC()})
+		if err != nil {
+			t.Fatalf("failed to put part: %v", err)
+		}
+		if err := repo.DeletePart(ctx, "1", 2); err != nil {
+			t.Fatalf("failed to delete part: %v", err)
+		}
+		parts, err := repo.ListParts(ctx, "1")
+		if err != nil {
+			t.Fatalf("failed to list parts: %v", err)
+		}
+		if len(parts) != 1 || parts[0].PartNumber != 1 {
+			t.Fatalf("expected only part 1 left, got %v", parts)
+		}
+	})
+
+	t.Run("delete removes parts", func(t *testing.T) {
+		if err := repo.DeleteUpload(ctx, "1"); err != nil {
+			t.Fatalf("failed to delete upload: %v", err)
+		}
+		parts, err := repo.ListParts(ctx, "1")
+		if err != nil {
+			t.Fatalf("failed to list parts: %v", err)
+		}
+		if len(parts) != 0 {
+			t.Fatalf("expected no parts, got %d", len(parts))
+		}
+	})
+}
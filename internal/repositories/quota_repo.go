@@ -0,0 +1,16 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+type QuotaRepository interface {
+	// GetUsage returns zero usage for users without files
+	GetUsage(ctx context.Context, owner string) (models.Usage, error)
+	// GetQuota returns sql.ErrNoRows when the user has no quota of their own
+	GetQuota(ctx context.Context, owner string) (models.Quota, error)
+	PutQuota(ctx context.Context, quota models.Quota) error
+	DeleteQuota(ctx context.Context, owner string) error
+}
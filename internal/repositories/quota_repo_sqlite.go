@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+type QuotaRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewQuotaRepositorySQLite(db *sql.DB) *QuotaRepositorySQLite {
+	return &QuotaRepositorySQLite{db}
+}
+
+func (r *QuotaRepositorySQLite) GetUsage(ctx context.Context, owner string) (models.Usage, error) {
+	usage := models.Usage{Owner: owner}
+	err := r.db.QueryRowContext(ctx, "SELECT bytes_used, file_count FROM user_usage WHERE owner = ?", owner).
+		Scan(&usage.BytesUsed, &usage.FileCount)
+	if err == sql.ErrNoRows {
+		return usage, nil
+	}
+	return usage, err
+}
+
+func (r *QuotaRepositorySQLite) GetQuota(ctx context.Context, owner string) (models.Quota, error) {
+	quota := models.Quota{Owner: owner}
+	err := r.db.QueryRowContext(ctx, "SELECT max_bytes, max_files FROM user_quotas WHERE owner = ?", owner).
+		Scan(&quota.MaxBytes, &quota.MaxFiles)
+	return quota, err
+}
+
+func (r *QuotaRepositorySQLite) PutQuota(ctx context.Context, quota models.Quota) error {
+	stmt, err := r.db.PrepareContext(ctx, `INSERT INTO user_quotas (owner, max_bytes, max_files) VALUES (?, ?, ?)
+		ON CONFLICT (owner) DO UPDATE SET max_bytes = excluded.max_bytes, max_files = excluded.max_files`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, quota.Owner, quota.MaxBytes, quota.MaxFiles)
+	return err
+}
+
+func (r *QuotaRepositorySQLite) DeleteQuota(ctx context.Context, owner string) error {
+	stmt, err := r.db.PrepareContext(ctx, "DELETE FROM user_quotas WHERE owner = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, owner)
+	return err
+}
@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+func TestQuotaRepositorySQLite(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewQuotaRepositorySQLite(db)
+	metaRepo := NewMetaRepositorySQLite(db)
+	ctx := context.Background()
+
+	expectUsage := func(owner string, bytes int64, files int64) {
+		t.Helper()
+		usage, err := repo.GetUsage(ctx, owner)
+		if err != nil {
+			t.Fatalf("failed to get usage: %v", err)
+		}
+		if usage.BytesUsed != bytes || usage.FileCount != files {
+			t.Fatalf("expected %d bytes in %d files for %s, got %+v", bytes, files, owner, usage)
+		}
+	}
+
+	expectUsage("alice", 0, 0)
+
+	files := []models.FileMetadata{
+		{FileId: "1", Owner: "alice", FileName: "a.txt", Size: 10},
+		{FileId: "2", Owner: "alice", FileName: "b.txt", Size: 5},
+		{FileId: "3", Owner: "bob", FileName: "a.txt", Size: 7},
+	}
+	for _, file := range files {
+		if err := metaRepo.Create(ctx, file); err != nil {
+			t.Fatalf("failed to create metadata: %v", err)
+		}
+	}
+	expectUsage("alice", 15, 2)
+	expectUsage("bob", 7, 1)
+
+	t.Run("usage follows updates and deletes", func(t *testing.T) {
+		files[0].Size = 100
+		if err := metaRepo.Update(ctx, files[0]); err != nil {
+			t.Fatalf("failed to update metadata: %v", err)
+		}
+		expectUsage("alice", 105, 2)
+
+		files[1].Owner = "bob"
+		if err := metaRepo.Update(ctx, files[1]); err != nil {
+			t.Fatalf("failed to update metadata: %v", err)
+		}
+		expectUsage("alice", 100, 1)
+		expectUsage("bob", 12, 2)
+
+		if err := metaRepo.Delete(ctx, "1"); err != nil {
+			t.Fatalf("failed to delete metadata: %v", err)
+		}
+		expectUsage("alice", 0, 0)
+	})
+
+	t.Run("versions count toward bytes", func(t *testing.T) {
+		versionRepo := NewFileVersionRepositorySQLite(db)
+		version := models.FileVersion{VersionId: "v1", FileId: "3", Owner: "bob", FileName: "a.txt", Size: 20}
+		if err := versionRepo.Create(ctx, version); err != nil {
+			t.Fatalf("failed to create version: %v", err)
+		}
+		expectUsage("bob", 32, 2)
+
+		if err := versionRepo.Delete(ctx, "v1"); err != nil {
+			t.Fatalf("failed to delete version: %v", err)
+		}
+		expectUsage("bob", 12, 2)
+	})
+
+	t.Run("trash counts toward bytes", func(t *testing.T) {
+		trashRepo := NewTrashRepositorySQLite(db)
+		if err := trashRepo.Trash(ctx, "3", "t1", time.Now(), "bob"); err != nil {
+			t.Fatalf("failed to trash file: %v", err)
+		}
+		expectUsage("bob", 12, 1)
+
+		if err := trashRepo.Delete(ctx, "t1"); err != nil {
+			t.Fatalf("failed to purge file: %v", err)
+		}
+		expectUsage("bob", 5, 1)
+	})
+
+	t.Run("quotas", func(t *testing.T) {
+		if _, err := repo.GetQuota(ctx, "alice"); err != sql.ErrNoRows {
+			t.Fatalf("expected no quota, got %v", err)
+		}
+		for _, maxBytes := range []int64{1000, 2000} {
+			if err := repo.PutQuota(ctx, models.Quota{Owner: "alice", MaxBytes: maxBytes, MaxFiles: 3}); err != nil {
+				t.Fatalf("failed to put quota: %v", err)
+			}
+		}
+		quota, err := repo.GetQuota(ctx, "alice")
+		if err != nil || quota.MaxBytes != 2000 || quota.MaxFiles != 3 {
+			t.Fatalf("unexpected quota %+v %v", quota, err)
+		}
+		if err := repo.DeleteQuota(ctx, "alice"); err != nil {
+			t.Fatalf("failed to delete quota: %v", err)
+		}
+		if _, err := repo.GetQuota(ctx, "alice"); err != sql.ErrNoRows {
+			t.Fatalf("expected no quota, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,22 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+type ShareLinkRepository interface {
+	Create(ctx context.Context, link models.ShareLink) error
+	GetByHash(ctx context.Context, tokenHash string) (models.ShareLink, error)
+	ListByOwner(ctx context.Context, owner string) ([]models.ShareLink, error)
+	// Revoke marks owner's link as revoked and reports whether it existed
+	Revoke(ctx context.Context, owner string, linkId string, at time.Time) (bool, error)
+	// CountDownload counts one download if the link is still usable at now
+	// and reports whether it was
+	CountDownload(ctx context.Context, linkId string, now time.Time) (bool, error)
+	RecordAccess(ctx context.Context, access models.ShareLinkAccess) error
+	// ListAccesses returns the accesses through owner's link, newest first
+	ListAccesses(ctx context.Context, owner string, linkId string) ([]models.ShareLinkAccess, error)
+}
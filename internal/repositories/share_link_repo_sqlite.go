@@ -0,0 +1,133 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+const shareLinkColumns = "link_id, token_hash, owner, file_name, password_hash, expires_at, max_downloads, download_count, created_at, revoked_at"
+
+type ShareLinkRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewShareLinkRepositorySQLite(db *sql.DB) *ShareLinkRepositorySQLite {
+	return &ShareLinkRepositorySQLite{db}
+}
+
+func (r *ShareLinkRepositorySQLite) Create(ctx context.Context, link models.ShareLink) error {
+	stmt, err := r.db.PrepareContext(ctx, "INSERT INTO share_links ("+shareLinkColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, link.LinkId, link.TokenHash, link.Owner, link.FileName, link.PasswordHash,
+		nullTime(link.ExpiresAt), link.MaxDownloads, link.DownloadCount, link.CreatedAt.UTC(), nullTime(link.RevokedAt))
+	return err
+}
+
+func (r *ShareLinkRepositorySQLite) GetByHash(ctx context.Context, tokenHash string) (models.ShareLink, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+shareLinkColumns+" FROM share_links WHERE token_hash = ?", tokenHash)
+	return scanShareLink(row)
+}
+
+func (r *ShareLinkRepositorySQLite) ListByOwner(ctx context.Context, owner string) ([]models.ShareLink, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+shareLinkColumns+" FROM share_links WHERE owner = ? ORDER BY created_at, link_id", owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []models.ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (r *ShareLinkRepositorySQLite) Revoke(ctx context.Context, owner string, linkId string, at time.Time) (bool, error) {
+	stmt, err := r.db.PrepareContext(ctx, "UPDATE share_links SET revoked_at = COALESCE(revoked_at, ?) WHERE owner = ? AND link_id = ?")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, at.UTC(), owner, linkId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+func (r *ShareLinkRepositorySQLite) CountDownload(ctx context.Context, linkId string, now time.Time) (bool, error) {
+	// checking and counting in one statement keeps concurrent downloads from
+	// exceeding the limit
+	stmt, err := r.db.PrepareContext(ctx, `UPDATE share_links SET download_count = download_count + 1
+		WHERE link_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)
+		AND (max_downloads = 0 OR download_count < max_downloads)`)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, linkId, now.UTC())
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+func (r *ShareLinkRepositorySQLite) RecordAccess(ctx context.Context, access models.ShareLinkAccess) error {
+	stmt, err := r.db.PrepareContext(ctx, `INSERT INTO share_link_accesses
+		(link_id, method, remote_addr, user_agent, accessed_at) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, access.LinkId, access.Method, access.RemoteAddr, access.UserAgent, access.AccessedAt.UTC())
+	return err
+}
+
+func (r *ShareLinkRepositorySQLite) ListAccesses(ctx context.Context, owner string, linkId string) ([]models.ShareLinkAccess, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT a.link_id, a.method, a.remote_addr, a.user_agent, a.accessed_at
+		FROM share_link_accesses a JOIN share_links l ON l.link_id = a.link_id
+		WHERE l.owner = ? AND a.link_id = ? ORDER BY a.accessed_at DESC, a.access_id DESC`, owner, linkId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accesses := []models.ShareLinkAccess{}
+	for rows.Next() {
+		var access models.ShareLinkAccess
+		if err := rows.Scan(&access.LinkId, &access.Method, &access.RemoteAddr, &access.UserAgent, &access.AccessedAt); err != nil {
+			return nil, err
+		}
+		accesses = append(accesses, access)
+	}
+	return accesses, rows.Err()
+}
+
+func scanShareLink(row rowScanner) (models.ShareLink, error) {
+	var link models.ShareLink
+	var expiresAt, revokedAt sql.NullTime
+	err := row.Scan(&link.LinkId, &link.TokenHash, &link.Owner, &link.FileName, &link.PasswordHash,
+		&expiresAt, &link.MaxDownloads, &link.DownloadCount, &link.CreatedAt, &revokedAt)
+	if err != nil {
+		return models.ShareLink{}, err
+	}
+	link.ExpiresAt = expiresAt.Time
+	link.RevokedAt = revokedAt.Time
+	return link, nil
+}
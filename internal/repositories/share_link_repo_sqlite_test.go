@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+func TestShareLinkRepositorySQLite(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewShareLinkRepositorySQLite(db)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	links := []models.ShareLink{
+		{LinkId: "limited", TokenHash: "h1", Owner: "alice", FileName: "a.pdf", MaxDownloads: 1, CreatedAt: now},
+		{LinkId: "expiring", TokenHash: "h2", Owner: "alice", FileName: "a.pdf", ExpiresAt: now.Add(time.Minute), CreatedAt: now},
+	}
+	for _, link := range links {
+		if err := repo.Create(ctx, link); err != nil {
+			t.Fatalf("failed to create link: %v", err)
+		}
+	}
+
+	count := func(linkId string, at time.Time) bool {
+		t.Helper()
+		ok, err := repo.CountDownload(ctx, linkId, at)
+		if err != nil {
+			t.Fatalf("failed to count download: %v", err)
+		}
+		return ok
+	}
+
+	if !count("limited", now) || count("limited", now) {
+		t.Fatal("expected exactly one download")
+	}
+	if !count("expiring", now) || count("expiring", now.Add(time.Minute)) {
+		t.Fatal("expected downloads until the link expires")
+	}
+
+	link, err := repo.GetByHash(ctx, "h1")
+	if err != nil {
+		t.Fatalf("failed to get link: %v", err)
+	}
+	if link.DownloadCount != 1 || link.Usable(now) || !link.ExpiresAt.IsZero() {
+		t.Fatalf("unexpected link %+v", link)
+	}
+
+	if ok, err := repo.Revoke(ctx, "bob", "expiring", now); err != nil || ok {
+		t.Fatalf("expected another owner's link not to be revoked, got %v %v", ok, err)
+	}
+	if ok, err := repo.Revoke(ctx, "alice", "expiring", now); err != nil || !ok {
+		t.Fatalf("expected the link to be revoked, got %v %v", ok, err)
+	}
+	if count("expiring", now) {
+		t.Fatal("expected a revoked link to be refused")
+	}
+
+	access := models.ShareLinkAccess{LinkId: "limited", Method: "GET", RemoteAddr: "192.0.2.1", UserAgent: "curl", AccessedAt: now}
+	if err := repo.RecordAccess(ctx, access); err != nil {
+		t.Fatalf("failed to record access: %v", err)
+	}
+	if accesses, err := repo.ListAccesses(ctx, "bob", "limited"); err != nil || len(accesses) != 0 {
+		t.Fatalf("expected no accesses for another owner, got %v %v", accesses, err)
+	}
+	accesses, err := repo.ListAccesses(ctx, "alice", "limited")
+	if err != nil || len(accesses) != 1 || accesses[0].RemoteAddr != "192.0.2.1" {
+		t.Fatalf("unexpected accesses %v %v", accesses, err)
+	}
+}
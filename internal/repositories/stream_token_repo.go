@@ -0,0 +1,16 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+type StreamTokenRepository interface {
+	Create(ctx context.Context, token models.StreamToken) error
+	// Consume counts one use of the token for owner's fileName and reports
+	// whether it was still valid at now
+	Consume(ctx context.Context, tokenHash string, owner string, fileName string, now time.Time) (bool, error)
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+type StreamTokenRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewStreamTokenRepositorySQLite(db *sql.DB) *StreamTokenRepositorySQLite {
+	return &StreamTokenRepositorySQLite{db}
+}
+
+func (r *StreamTokenRepositorySQLite) Create(ctx context.Context, token models.StreamToken) error {
+	stmt, err := r.db.PrepareContext(ctx, `INSERT INTO stream_tokens
+		(token_hash, owner, file_name, max_uses, use_count, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, token.TokenHash, token.Owner, token.FileName, token.MaxUses, token.UseCount,
+		token.CreatedAt.UTC(), token.ExpiresAt.UTC())
+	return err
+}
+
+func (r *StreamTokenRepositorySQLite) Consume(ctx context.Context, tokenHash string, owner string, fileName string, now time.Time) (bool, error) {
+	// checking and counting in one statement keeps concurrent requests from
+	// using a token more often than allowed
+	stmt, err := r.db.PrepareContext(ctx, `UPDATE stream_tokens SET use_count = use_count + 1
+		WHERE token_hash = ? AND owner = ? AND file_name = ? AND expires_at > ?
+		AND (max_uses = 0 OR use_count < max_uses)`)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, tokenHash, owner, fileName, now.UTC())
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *StreamTokenRepositorySQLite) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	stmt, err := r.db.PrepareContext(ctx, "DELETE FROM stream_tokens WHERE expires_at <= ?")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
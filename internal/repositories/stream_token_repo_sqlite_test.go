@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+func TestStreamTokenRepositorySQLite(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewStreamTokenRepositorySQLite(db)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	tokens := []models.StreamToken{
+		{TokenHash: "limited", Owner: "alice", FileName: "a.mp4", MaxUses: 1, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{TokenHash: "expiring", Owner: "alice", FileName: "a.mp4", CreatedAt: now, ExpiresAt: now.Add(time.Minute)},
+	}
+	for _, token := range tokens {
+		if err := repo.Create(ctx, token); err != nil {
+			t.Fatalf("failed to create token: %v", err)
+		}
+	}
+
+	consume := func(hash string, fileName string, at time.Time) bool {
+		t.Helper()
+		ok, err := repo.Consume(ctx, hash, "alice", fileName, at)
+		if err != nil {
+			t.Fatalf("failed to consume token: %v", err)
+		}
+		return ok
+	}
+
+	if consume("limited", "b.mp4", now) {
+		t.Fatal("expected the token to be bound to its file")
+	}
+	if !consume("limited", "a.mp4", now) {
+		t.Fatal("expected the first use to succeed")
+	}
+	if consume("limited", "a.mp4", now) {
+		t.Fatal("expected the second use to be refused")
+	}
+	if !consume("expiring", "a.mp4", now) || !consume("expiring", "a.mp4", now) {
+		t.Fatal("expected an unlimited token to be usable repeatedly")
+	}
+	if consume("expiring", "a.mp4", now.Add(time.Minute)) {
+		t.Fatal("expected an expired token to be refused")
+	}
+
+	deleted, err := repo.DeleteExpired(ctx, now.Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("failed to delete expired tokens: %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("expected 1 expired token, got %d", deleted)
+	}
+}
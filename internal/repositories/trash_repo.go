@@ -0,0 +1,22 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+type TrashRepository interface {
+	// Trash moves a file's metadata into the trash as trashId
+	Trash(ctx context.Context, fileId string, trashId string, deletedAt time.Time, deletedBy string) error
+	// Restore moves an item's metadata back out of the trash
+	Restore(ctx context.Context, trashId string) error
+	// Get returns sql.ErrNoRows when owner has no such item
+	Get(ctx context.Context, owner string, trashId string) (models.TrashItem, error)
+	// ListByOwner returns the owner's trash, most recently deleted first
+	ListByOwner(ctx context.Context, owner string) ([]models.TrashItem, error)
+	// ListDeletedBefore returns every item deleted before the given time
+	ListDeletedBefore(ctx context.Context, before time.Time) ([]models.TrashItem, error)
+	Delete(ctx context.Context, trashId string) error
+}
@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+const trashColumns = "trash_id, " + metaColumns + ", deleted_at, deleted_by"
+
+type TrashRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewTrashRepositorySQLite(db *sql.DB) *TrashRepositorySQLite {
+	return &TrashRepositorySQLite{db}
+}
+
+func (r *TrashRepositorySQLite) Trash(ctx context.Context, fileId string, trashId string, deletedAt time.Time, deletedBy string) error {
+	return r.move(ctx,
+		"INSERT INTO trash ("+trashColumns+") SELECT ?, "+metaColumns+", ?, ? FROM metadata WHERE file_id = ?",
+		[]any{trashId, deletedAt.UTC(), deletedBy, fileId},
+		"DELETE FROM metadata WHERE file_id = ?", fileId)
+}
+
+func (r *TrashRepositorySQLite) Restore(ctx context.Context, trashId string) error {
+	return r.move(ctx,
+		"INSERT INTO metadata ("+metaColumns+") SELECT "+metaColumns+" FROM trash WHERE trash_id = ?",
+		[]any{trashId},
+		"DELETE FROM trash WHERE trash_id = ?", trashId)
+}
+
+// move copies a row with insert and removes the original with remove in one
+// transaction, failing with sql.ErrNoRows when there was nothing to copy
+func (r *TrashRepositorySQLite) move(ctx context.Context, insert string, insertArgs []any, remove string, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, insert, insertArgs...)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.ExecContext(ctx, remove, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *TrashRepositorySQLite) Get(ctx context.Context, owner string, trashId string) (models.TrashItem, error) {
+	stmt, err := r.db.PrepareContext(ctx, "SELECT "+trashColumns+" FROM trash WHERE owner = ? AND trash_id = ?")
+	if err != nil {
+		return models.TrashItem{}, err
+	}
+	defer stmt.Close()
+
+	return scanTrashItem(stmt.QueryRowContext(ctx, owner, trashId))
+}
+
+func (r *TrashRepositorySQLite) ListByOwner(ctx context.Context, owner string) ([]models.TrashItem, error) {
+	return r.query(ctx, "SELECT "+trashColumns+" FROM trash WHERE owner = ? ORDER BY deleted_at DESC, trash_id", owner)
+}
+
+func (r *TrashRepositorySQLite) ListDeletedBefore(ctx context.Context, before time.Time) ([]models.TrashItem, error) {
+	return r.query(ctx, "SELECT "+trashColumns+" FROM trash WHERE deleted_at < ? ORDER BY deleted_at", before.UTC())
+}
+
+func (r *TrashRepositorySQLite) Delete(ctx context.Context, trashId string) error {
+	stmt, err := r.db.PrepareContext(ctx, "DELETE FROM trash WHERE trash_id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, trashId)
+	return err
+}
+
+func (r *TrashRepositorySQLite) query(ctx context.Context, query string, args ...any) ([]models.TrashItem, error) {
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.TrashItem{}
+	for rows.Next() {
+		item, err := scanTrashItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func scanTrashItem(row rowScanner) (models.TrashItem, error) {
+	var item models.TrashItem
+	var lastAccessedAt sql.NullTime
+	var properties string
+	file := &item.File
+	err := row.Scan(&item.TrashId, &file.FileId, &file.Owner, &file.FileName, &file.MD5Hash, &file.SHA256Hash,
+		&file.Size, &file.ContentType, &file.CreatedAt, &file.UpdatedAt, &lastAccessedAt, &file.StoragePath,
+		&file.VersionId, &file.Author, &properties, &item.DeletedAt, &item.DeletedBy)
+	if err != nil {
+		return models.TrashItem{}, err
+	}
+	file.LastAccessedAt = lastAccessedAt.Time
+	file.Properties, err = decodeProperties(properties)
+	return item, err
+}
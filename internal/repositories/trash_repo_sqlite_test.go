@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+func TestTrashRepositorySQLite(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewTrashRepositorySQLite(db)
+	metaRepo := NewMetaRepositorySQLite(db)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	file := models.FileMetadata{FileId: "1", Owner: "alice", FileName: "a.txt", Size: 10, SHA256Hash: "abc",
+		CreatedAt: now, UpdatedAt: now, LastAccessedAt: now, VersionId: "v1", Author: "bob"}
+	if err := metaRepo.Create(ctx, file); err != nil {
+		t.Fatalf("failed to create metadata: %v", err)
+	}
+
+	if err := repo.Trash(ctx, "1", "t1", now, "bob"); err != nil {
+		t.Fatalf("failed to trash file: %v", err)
+	}
+	if _, err := metaRepo.GetByName(ctx, "alice", "a.txt"); err != sql.ErrNoRows {
+		t.Fatalf("expected the metadata to leave, got %v", err)
+	}
+	if err := repo.Trash(ctx, "1", "t2", now, "bob"); err != sql.ErrNoRows {
+		t.Fatalf("expected a missing file not to be trashed, got %v", err)
+	}
+
+	item, err := repo.Get(ctx, "alice", "t1")
+	if err != nil {
+		t.Fatalf("failed to get trash item: %v", err)
+	}
+	if item.File.FileName != "a.txt" || item.File.VersionId != "v1" || item.DeletedBy != "bob" || item.File.LastAccessedAt.IsZero() {
+		t.Fatalf("unexpected trash item %+v", item)
+	}
+	if _, err := repo.Get(ctx, "bob", "t1"); err != sql.ErrNoRows {
+		t.Fatalf("expected items of other owners not to be found, got %v", err)
+	}
+
+	if expired, err := repo.ListDeletedBefore(ctx, now.Add(-time.Minute)); err != nil || len(expired) != 0 {
+		t.Fatalf("expected no expired items, got %v %v", expired, err)
+	}
+	if expired, err := repo.ListDeletedBefore(ctx, now.Add(time.Minute)); err != nil || len(expired) != 1 {
+		t.Fatalf("expected the item to expire, got %v %v", expired, err)
+	}
+
+	if err := repo.Restore(ctx, "t1"); err != nil {
+		t.Fatalf("failed to restore file: %v", err)
+	}
+	restored, err := metaRepo.GetByName(ctx, "alice", "a.txt")
+	if err != nil || restored.FileId != "1" || restored.Author != "bob" {
+		t.Fatalf("expected the file back, got %+v %v", restored, err)
+	}
+	if items, err := repo.ListByOwner(ctx, "alice"); err != nil || len(items) != 0 {
+		t.Fatalf("expected an empty trash, got %v %v", items, err)
+	}
+}
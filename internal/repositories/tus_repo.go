@@ -0,0 +1,16 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+type TusRepository interface {
+	Create(ctx context.Context, upload models.TusUpload) error
+	Get(ctx context.Context, uploadId string) (models.TusUpload, error)
+	UpdateOffset(ctx context.Context, uploadId string, offset int64) error
+	Delete(ctx context.Context, uploadId string) error
+	ListExpired(ctx context.Context, before time.Time) ([]models.TusUpload, error)
+}
@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+)
+
+const tusColumns = "upload_id, owner, file_name, upload_length, upload_offset, metadata, created_at, expires_at"
+
+type TusRepositorySQLite struct {
+	db *sql.DB
+}
+
+func NewTusRepositorySQLite(db *sql.DB) *TusRepositorySQLite {
+	return &TusRepositorySQLite{db}
+}
+
+func (r *TusRepositorySQLite) Create(ctx context.Context, upload models.TusUpload) error {
+	stmt, err := r.db.PrepareContext(ctx, "INSERT INTO tus_uploads ("+tusColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, upload.UploadId, upload.Owner, upload.FileName, upload.UploadLength,
+		upload.UploadOffset, upload.Metadata, upload.CreatedAt.UTC(), upload.ExpiresAt.UTC())
+	return err
+}
+
+func (r *TusRepositorySQLite) Get(ctx context.Context, uploadId string) (models.TusUpload, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+tusColumns+" FROM tus_uploads WHERE upload_id = ?", uploadId)
+	return scanTusUpload(row)
+}
+
+func (r *TusRepositorySQLite) UpdateOffset(ctx context.Context, uploadId string, offset int64) error {
+	stmt, err := r.db.PrepareContext(ctx, "UPDATE tus_uploads SET upload_offset = ? WHERE upload_id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, offset, uploadId)
+	return err
+}
+
+func (r *TusRepositorySQLite) Delete(ctx context.Context, uploadId string) error {
+	stmt, err := r.db.PrepareContext(ctx, "DELETE FROM tus_uploads WHERE upload_id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, uploadId)
+	return err
+}
+
+func (r *TusRepositorySQLite) ListExpired(ctx context.Context, before time.Time) ([]models.TusUpload, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+tusColumns+" FROM tus_uploads WHERE expires_at < ?", before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uploads []models.TusUpload
+	for rows.Next() {
+		upload, err := scanTusUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTusUpload(row rowScanner) (models.TusUpload, error) {
+	var upload models.TusUpload
+	err := row.Scan(&upload.UploadId, &upload.Owner, &upload.FileName, &upload.UploadLength,
+		&upload.UploadOffset, &upload.Metadata, &upload.CreatedAt, &upload.ExpiresAt)
+	if err != nil {
+		return models.TusUpload{}, err
+	}
+	return upload, nil
+}
@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestTusRepositorySQLite(t *testing.T) {
+	db := newTestDB(t)
+
+	repo := NewTusRepositorySQLite(db)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	t.Run("create and update offset", func(t *testing.T) {
+		err := repo.Create(ctx, models.TusUpload{
+			UploadId:     "1",
+			Owner:        "testuser",
+			FileName:     "test.txt",
+			UploadLength: 100,
+			CreatedAt:    now,
+			ExpiresAt:    now.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("failed to create upload: %v", err)
+		}
+		if err := repo.UpdateOffset(ctx, "1", 42); err != nil {
+			t.Fatalf("failed to update offset: %v", err)
+		}
+		upload, err := repo.Get(ctx, "1")
+		if err != nil {
+			t.Fatalf("failed to get upload: %v", err)
+		}
+		if upload.UploadOffset != 42 {
+			t.Fatalf("expected offset to be 42, got %d", upload.UploadOffset)
+		}
+		if !upload.ExpiresAt.Equal(now.Add(time.Hour)) {
+			t.Fatalf("expected expiry %v, got %v", now.Add(time.Hour), upload.ExpiresAt)
+		}
+	})
+
+	t.Run("list expired", func(t *testing.T) {
+		err := repo.Create(ctx, models.TusUpload{
+			UploadId:     "2",
+			Owner:        "testuser",
+			FileName:     "old.txt",
+			UploadLength: 100,
+			CreatedAt:    now.Add(-2 * time.Hour),
+			ExpiresAt:    now.Add(-time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("failed to create upload: %v", err)
+		}
+		expired, err := repo.ListExpired(ctx, now)
+		if err != nil {
+			t.Fatalf("failed to list expired uploads: %v", err)
+		}
+		if len(expired) != 1 || expired[0].UploadId != "2" {
+			t.Fatalf("expected only upload 2 to be expired, got %v", expired)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := repo.Delete(ctx, "1"); err != nil {
+			t.Fatalf("failed to delete upload: %v", err)
+		}
+		_, err := repo.Get(ctx, "1")
+		if err != sql.ErrNoRows {
+			t.Fatalf("expected no rows, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/google/uuid"
+)
+
+var ErrACLNotFound = errors.New("grant not found")
+
+type ACLService interface {
+	// Grant shares acl.Path with the grantee, replacing the permission of an
+	// earlier grant of the same path to the same grantee
+	Grant(ctx context.Context, acl models.ACL) (models.ACL, error)
+	List(ctx context.Context, owner string) ([]models.ACL, error)
+	Revoke(ctx context.Context, owner string, aclId string) error
+	// SharedWith returns what other users shared with user or its groups
+	SharedWith(ctx context.Context, user string, groups []string) ([]models.ACL, error)
+	// Allowed reports whether user, directly or through one of groups, was
+	// granted permission on owner's fileName
+	Allowed(ctx context.Context, owner string, fileName string, user string, groups []string, permission string) (bool, error)
+}
+
+type ACLServiceImpl struct {
+	repo repositories.ACLRepository
+}
+
+func NewACLService(repo repositories.ACLRepository) *ACLServiceImpl {
+	return &ACLServiceImpl{repo}
+}
+
+func (s *ACLServiceImpl) Grant(ctx context.Context, acl models.ACL) (models.ACL, error) {
+	acl.AclId = uuid.NewString()
+	acl.CreatedAt = time.Now().UTC()
+	return s.repo.Put(ctx, acl)
+}
+
+func (s *ACLServiceImpl) List(ctx context.Context, owner string) ([]models.ACL, error) {
+	return s.repo.ListByOwner(ctx, owner)
+}
+
+func (s *ACLServiceImpl) Revoke(ctx context.Context, owner string, aclId string) error {
+	ok, err := s.repo.Delete(ctx, owner, aclId)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrACLNotFound
+	}
+	return nil
+}
+
+func (s *ACLServiceImpl) SharedWith(ctx context.Context, user string, groups []string) ([]models.ACL, error) {
+	acls, err := s.repo.ListByGrantee(ctx, user, groups)
+	if err != nil {
+		return nil, err
+	}
+	// a user's own files shared with one of their groups are not shared with them
+	shared := []models.ACL{}
+	for _, acl := range acls {
+		if acl.Owner != user {
+			shared = append(shared, acl)
+		}
+	}
+	return shared, nil
+}
+
+func (s *ACLServiceImpl) Allowed(ctx context.Context, owner string, fileName string, user string, groups []string, permission string) (bool, error) {
+	acls, err := s.repo.ListByGrantee(ctx, user, groups)
+	if err != nil {
+		return false, err
+	}
+	for _, acl := range acls {
+		if acl.Owner == owner && acl.Covers(fileName) && acl.Permits(permission) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/google/uuid"
+)
+
+// API_KEY_PREFIX starts every API key, which tells them apart from JWTs
+const API_KEY_PREFIX = "fsk_"
+
+// API_KEY_BYTES is the amount of randomness in an API key
+const API_KEY_BYTES = 32
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid API key")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+type APIKeyService interface {
+	// Create issues a key for owner and returns it; only its hash is stored,
+	// so it cannot be recovered later
+	Create(ctx context.Context, owner string, name string, scopes []string) (string, models.APIKey, error)
+	// Authenticate looks up an unrevoked key and records that it was used
+	Authenticate(ctx context.Context, key string) (models.APIKey, error)
+	List(ctx context.Context, owner string) ([]models.APIKey, error)
+	Revoke(ctx context.Context, owner string, keyId string) error
+	// FlushLastUsed writes the recorded last-used times to the database and
+	// returns how many keys were updated
+	FlushLastUsed(ctx context.Context) (int, error)
+}
+
+// APIKeyServiceImpl keeps last-used times in memory until they are flushed,
+// so that authenticating does not write to the database on every request
+type APIKeyServiceImpl struct {
+	repo repositories.APIKeyRepository
+
+	mu       sync.Mutex
+	lastUsed map[string]time.Time
+}
+
+func NewAPIKeyService(repo repositories.APIKeyRepository) *APIKeyServiceImpl {
+	return &APIKeyServiceImpl{repo: repo, lastUsed: map[string]time.Time{}}
+}
+
+func (s *APIKeyServiceImpl) Create(ctx context.Context, owner string, name string, scopes []string) (string, models.APIKey, error) {
+	raw := make([]byte, API_KEY_BYTES)
+	if _, err := rand.Read(raw); err != nil {
+		return "", models.APIKey{}, err
+	}
+	key := API_KEY_PREFIX + base64.RawURLEncoding.EncodeToString(raw)
+
+	apiKey := models.APIKey{
+		KeyId:     uuid.NewString(),
+		Owner:     owner,
+		Name:      name,
+		KeyHash:   hashAPIKey(key),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.repo.Create(ctx, apiKey); err != nil {
+		return "", models.APIKey{}, err
+	}
+	return key, apiKey, nil
+}
+
+func (s *APIKeyServiceImpl) Authenticate(ctx context.Context, key string) (models.APIKey, error) {
+	if !strings.HasPrefix(key, API_KEY_PREFIX) {
+		return models.APIKey{}, ErrInvalidAPIKey
+	}
+	apiKey, err := s.repo.GetByHash(ctx, hashAPIKey(key))
+	if err == sql.ErrNoRows {
+		return models.APIKey{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if apiKey.Revoked() {
+		return models.APIKey{}, ErrInvalidAPIKey
+	}
+
+	now := time.Now().UTC()
+	s.mu.Lock()
+	s.lastUsed[apiKey.KeyId] = now
+	s.mu.Unlock()
+	apiKey.LastUsedAt = now
+	return apiKey, nil
+}
+
+// List includes the last-used times that were not flushed yet
+func (s *APIKeyServiceImpl) List(ctx context.Context, owner string) ([]models.APIKey, error) {
+	keys, err := s.repo.ListByOwner(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range keys {
+		if at, ok := s.lastUsed[keys[i].KeyId]; ok && at.After(keys[i].LastUsedAt) {
+			keys[i].LastUsedAt = at
+		}
+	}
+	return keys, nil
+}
+
+func (s *APIKeyServiceImpl) Revoke(ctx context.Context, owner string, keyId string) error {
+	ok, err := s.repo.Revoke(ctx, owner, keyId, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (s *APIKeyServiceImpl) FlushLastUsed(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	pending := s.lastUsed
+	s.lastUsed = map[string]time.Time{}
+	s.mu.Unlock()
+
+	if len(pending) == 0 {
+		return 0, nil
+	}
+	if err := s.repo.UpdateLastUsed(ctx, pending); err != nil {
+		// keep the times for the next flush, unless the key was used since
+		s.mu.Lock()
+		for keyId, at := range pending {
+			if at.After(s.lastUsed[keyId]) {
+				s.lastUsed[keyId] = at
+			}
+		}
+		s.mu.Unlock()
+		return 0, err
+	}
+	return len(pending), nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
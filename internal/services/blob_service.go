@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+)
+
+type BlobService interface {
+	GetBlob(ctx context.Context, sha256Hash string) (models.Blob, error)
+	AcquireBlob(ctx context.Context, blob models.Blob) (int64, error)
+	ReleaseBlob(ctx context.Context, sha256Hash string) (int64, error)
+	UnusedLegacyBlobs(ctx context.Context) ([]string, error)
+	RecordLegacyBlob(ctx context.Context, md5Hash string) error
+	ForgetLegacyBlob(ctx context.Context, md5Hash string) error
+}
+
+type BlobServiceImpl struct {
+	repo repositories.BlobRepository
+}
+
+func NewBlobService(repo repositories.BlobRepository) *BlobServiceImpl {
+	return &BlobServiceImpl{repo}
+}
+
+func (s *BlobServiceImpl) GetBlob(ctx context.Context, sha256Hash string) (models.Blob, error) {
+	return s.repo.Get(ctx, sha256Hash)
+}
+
+// AcquireBlob references the stored content and returns how many files now
+// point to it
+func (s *BlobServiceImpl) AcquireBlob(ctx context.Context, blob models.Blob) (int64, error) {
+	return s.repo.Acquire(ctx, blob)
+}
+
+// ReleaseBlob drops one reference and returns how many are left; the content
+// can be removed once this reaches zero
+func (s *BlobServiceImpl) ReleaseBlob(ctx context.Context, sha256Hash string) (int64, error) {
+	return s.repo.Release(ctx, sha256Hash)
+}
+
+// UnusedLegacyBlobs returns the MD5 hashes of the content stored before the
+// blob store that no file references anymore
+func (s *BlobServiceImpl) UnusedLegacyBlobs(ctx context.Context) ([]string, error) {
+	return s.repo.ListUnusedLegacy(ctx)
+}
+
+// RecordLegacyBlob remembers content stored before the blob store, so that
+// it is purged once unused
+func (s *BlobServiceImpl) RecordLegacyBlob(ctx context.Context, md5Hash string) error {
+	return s.repo.CreateLegacy(ctx, md5Hash)
+}
+
+// ForgetLegacyBlob drops the record of legacy content once it was removed
+func (s *BlobServiceImpl) ForgetLegacyBlob(ctx context.Context, md5Hash string) error {
+	return s.repo.DeleteLegacy(ctx, md5Hash)
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+)
+
+var ErrFolderNotFound = errors.New("folder not found")
+
+type FolderService interface {
+	// Create makes the folder at path along with its parents and reports
+	// whether it did not exist before
+	Create(ctx context.Context, owner string, path string) (models.Folder, bool, error)
+	// EnsureParents creates the folders containing the file at path
+	EnsureParents(ctx context.Context, owner string, path string) error
+	Get(ctx context.Context, owner string, path string) (models.Folder, error)
+	// List returns the folders directly inside parent, "" for the top level
+	List(ctx context.Context, owner string, parent string) ([]models.Folder, error)
+	// Tree returns the folder at path and every folder below it
+	Tree(ctx context.Context, owner string, path string) ([]models.Folder, error)
+	// Move renames or moves a folder with everything in it, failing with
+	// repositories.ErrPathTaken when the destination exists
+	Move(ctx context.Context, owner string, from string, to string) error
+	DeleteTree(ctx context.Context, owner string, path string) error
+}
+
+type FolderServiceImpl struct {
+	repo repositories.FolderRepository
+}
+
+func NewFolderService(repo repositories.FolderRepository) *FolderServiceImpl {
+	return &FolderServiceImpl{repo}
+}
+
+func (s *FolderServiceImpl) Create(ctx context.Context, owner string, path string) (models.Folder, bool, error) {
+	if folder, err := s.repo.Get(ctx, owner, path); err == nil {
+		return folder, false, nil
+	} else if err != sql.ErrNoRows {
+		return models.Folder{}, false, err
+	}
+
+	if err := s.repo.Ensure(ctx, owner, append(models.ParentFolders(path), path), time.Now()); err != nil {
+		return models.Folder{}, false, err
+	}
+	folder, err := s.repo.Get(ctx, owner, path)
+	return folder, true, err
+}
+
+func (s *FolderServiceImpl) EnsureParents(ctx context.Context, owner string, path string) error {
+	return s.repo.Ensure(ctx, owner, models.ParentFolders(path), time.Now())
+}
+
+func (s *FolderServiceImpl) Get(ctx context.Context, owner string, path string) (models.Folder, error) {
+	folder, err := s.repo.Get(ctx, owner, path)
+	if err == sql.ErrNoRows {
+		return models.Folder{}, ErrFolderNotFound
+	}
+	return folder, err
+}
+
+func (s *FolderServiceImpl) List(ctx context.Context, owner string, parent string) ([]models.Folder, error) {
+	return s.repo.ListChildren(ctx, owner, parent)
+}
+
+func (s *FolderServiceImpl) Tree(ctx context.Context, owner string, path string) ([]models.Folder, error) {
+	return s.repo.ListTree(ctx, owner, path)
+}
+
+func (s *FolderServiceImpl) Move(ctx context.Context, owner string, from string, to string) error {
+	return s.repo.Move(ctx, owner, from, to, time.Now())
+}
+
+func (s *FolderServiceImpl) DeleteTree(ctx context.Context, owner string, path string) error {
+	return s.repo.DeleteTree(ctx, owner, path)
+}
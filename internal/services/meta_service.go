@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"time"
 
 	"github.com/Iwoooooods/fs-upload-go/internal/models"
 	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
@@ -11,10 +12,20 @@ type MetaService interface {
 	SaveMetadata(ctx context.Context, metadata models.FileMetadata) error
 	GetMetadataById(ctx context.Context, fileId string) (models.FileMetadata, error)
 	GetMetadataByMD5(ctx context.Context, md5 string) (models.FileMetadata, error)
+	GetMetadataBySHA256(ctx context.Context, sha256 string) (models.FileMetadata, error)
+	GetMetadataByName(ctx context.Context, owner string, fileName string) (models.FileMetadata, error)
 	UpdateMetadata(ctx context.Context, metadata models.FileMetadata) error
+	MarkAccessed(ctx context.Context, fileId string) error
 	DeleteMetadata(ctx context.Context, fileId string) error
+	MoveMetadata(ctx context.Context, fileId string, toOwner string, toName string) error
+	ListMetadata(ctx context.Context, opts repositories.ListOptions) ([]models.FileMetadata, string, error)
 }
 
+const (
+	DEFAULT_LIST_LIMIT = 100
+	MAX_LIST_LIMIT     = 1000
+)
+
 type MetaServiceImpl struct {
 	repo repositories.MetaRepository
 }
@@ -37,12 +48,40 @@ func (s *MetaServiceImpl) GetMetadataByMD5(ctx context.Context, md5 string) (mod
 	return s.repo.Get(ctx, "md5_hash", md5)
 }
 
+func (s *MetaServiceImpl) GetMetadataBySHA256(ctx context.Context, sha256 string) (models.FileMetadata, error) {
+	return s.repo.Get(ctx, "sha256_hash", sha256)
+}
+
+// GetMetadataByName retrieves the metadata of a user's file by its name
+func (s *MetaServiceImpl) GetMetadataByName(ctx context.Context, owner string, fileName string) (models.FileMetadata, error) {
+	return s.repo.GetByName(ctx, owner, fileName)
+}
+
 // UpdateMetadata updates existing file metadata in the database
 func (s *MetaServiceImpl) UpdateMetadata(ctx context.Context, metadata models.FileMetadata) error {
 	return s.repo.Update(ctx, metadata)
 }
 
+// MarkAccessed records that the file was just read
+func (s *MetaServiceImpl) MarkAccessed(ctx context.Context, fileId string) error {
+	return s.repo.MarkAccessed(ctx, fileId, time.Now())
+}
+
 // DeleteMetadata removes file metadata from the database
 func (s *MetaServiceImpl) DeleteMetadata(ctx context.Context, fileId string) error {
 	return s.repo.Delete(ctx, fileId)
 }
+
+// MoveMetadata gives a file a new owner and name, see MetaRepository.Move
+func (s *MetaServiceImpl) MoveMetadata(ctx context.Context, fileId string, toOwner string, toName string) error {
+	return s.repo.Move(ctx, fileId, toOwner, toName, time.Now())
+}
+
+// ListMetadata returns one page of a user's files, see MetaRepository.List
+func (s *MetaServiceImpl) ListMetadata(ctx context.Context, opts repositories.ListOptions) ([]models.FileMetadata, string, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = DEFAULT_LIST_LIMIT
+	}
+	opts.Limit = min(opts.Limit, MAX_LIST_LIMIT)
+	return s.repo.List(ctx, opts)
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/google/uuid"
+)
+
+const MAX_PART_NUMBER = 10000
+
+var (
+	ErrInvalidPartNumber = errors.New("part number must be between 1 and 10000")
+	ErrBadDigest         = errors.New("part content does not match the provided MD5")
+	ErrInvalidPart       = errors.New("part was not uploaded or its etag does not match")
+	ErrInvalidPartOrder  = errors.New("parts must be listed in ascending order")
+)
+
+type MultipartService interface {
+	Initiate(ctx context.Context, owner string, fileName string) (models.MultipartUpload, error)
+	GetUpload(ctx context.Context, uploadId string) (models.MultipartUpload, error)
+	UploadPart(ctx context.Context, upload models.MultipartUpload, partNumber int, src io.Reader, expectedMD5 string) (models.MultipartPart, error)
+	ListParts(ctx context.Context, uploadId string) ([]models.MultipartPart, error)
+	// DeletePart drops a staged part, e.g. one that did not fit the upload
+	DeletePart(ctx context.Context, uploadId string, partNumber int) error
+	Complete(ctx context.Context, upload models.MultipartUpload, parts []models.MultipartPart) (io.ReadCloser, error)
+	Abort(ctx context.Context, uploadId string) error
+	PurgeStale(ctx context.Context) (int, error)
+}
+
+type MultipartServiceImpl struct {
+	repo       repositories.MultipartRepository
+	stagingDir string
+	expiration time.Duration
+}
+
+// NewMultipartService stages parts under stagingDir/<uploadId>/<partNumber>;
+// sessions idle for longer than expiration are garbage-collected
+func NewMultipartService(repo repositories.MultipartRepository, stagingDir string, expiration time.Duration) *MultipartServiceImpl {
+	return &MultipartServiceImpl{
+		repo:       repo,
+		stagingDir: stagingDir,
+		expiration: expiration,
+	}
+}
+
+func (s *MultipartServiceImpl) uploadDir(uploadId string) string {
+	return filepath.Join(s.stagingDir, uploadId)
+}
+
+func (s *MultipartServiceImpl) partPath(uploadId string, partNumber int) string {
+	return filepath.Join(s.uploadDir(uploadId), strconv.Itoa(partNumber))
+}
+
+func (s *MultipartServiceImpl) Initiate(ctx context.Context, owner string, fileName string) (models.MultipartUpload, error) {
+	now := time.Now().UTC()
+	upload := models.MultipartUpload{
+		UploadId:  uuid.NewString(),
+		Owner:     owner,
+		FileName:  fileName,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := os.MkdirAll(s.uploadDir(upload.UploadId), 0755); err != nil {
+		return models.MultipartUpload{}, err
+	}
+	if err := s.repo.CreateUpload(ctx, upload); err != nil {
+		os.RemoveAll(s.uploadDir(upload.UploadId))
+		return models.MultipartUpload{}, err
+	}
+	return upload, nil
+}
+
+func (s *MultipartServiceImpl) GetUpload(ctx context.Context, uploadId string) (models.MultipartUpload, error) {
+	return s.repo.GetUpload(ctx, uploadId)
+}
+
+// UploadPart stages one part. When expectedMD5 (hex) is set the part is
+// rejected with ErrBadDigest unless its content hashes to the same value.
+// Re-uploading a part number replaces the previous content.
+func (s *MultipartServiceImpl) UploadPart(ctx context.Context, upload models.MultipartUpload, partNumber int, src io.Reader, expectedMD5 string) (models.MultipartPart, error) {
+	if partNumber < 1 || partNumber > MAX_PART_NUMBER {
+		return models.MultipartPart{}, ErrInvalidPartNumber
+	}
+
+	// parts arrive concurrently, so each one is written to its own temp file
+	// and only renamed into place once complete and verified
+	tmp, err := os.CreateTemp(s.uploadDir(upload.UploadId), "part-*")
+	if err != nil {
+		return models.MultipartPart{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := md5.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), src)
+	if err != nil {
+		return models.MultipartPart{}, err
+	}
+	md5Hash := hex.EncodeToString(hasher.Sum(nil))
+	if expectedMD5 != "" && expectedMD5 != md5Hash {
+		return models.MultipartPart{}, ErrBadDigest
+	}
+	if err := tmp.Close(); err != nil {
+		return models.MultipartPart{}, err
+	}
+	if err := os.Rename(tmp.Name(), s.partPath(upload.UploadId, partNumber)); err != nil {
+		return models.MultipartPart{}, err
+	}
+
+	part := models.MultipartPart{
+		UploadId:   upload.UploadId,
+		PartNumber: partNumber,
+		Size:       size,
+		MD5Hash:    md5Hash,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := s.repo.PutPart(ctx, part); err != nil {
+		return models.MultipartPart{}, err
+	}
+	return part, nil
+}
+
+func (s *MultipartServiceImpl) ListParts(ctx context.Context, uploadId string) ([]models.MultipartPart, error) {
+	return s.repo.ListParts(ctx, uploadId)
+}
+
+func (s *MultipartServiceImpl) DeletePart(ctx context.Context, uploadId string, partNumber int) error {
+	if err := os.Remove(s.partPath(uploadId, partNumber)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return s.repo.DeletePart(ctx, uploadId, partNumber)
+}
+
+// Complete checks the requested parts against the staged ones and returns a
+// reader over their concatenated content. The caller stores the result and
+// then calls Abort to drop the staged parts.
+func (s *MultipartServiceImpl) Complete(ctx context.Context, upload models.MultipartUpload, parts []models.MultipartPart) (io.ReadCloser, error) {
+	staged, err := s.repo.ListParts(ctx, upload.UploadId)
+	if err != nil {
+		return nil, err
+	}
+	stagedByNumber := make(map[int]models.MultipartPart, len(staged))
+	for _, part := range staged {
+		stagedByNumber[part.PartNumber] = part
+	}
+
+	if len(parts) == 0 {
+		return nil, ErrInvalidPart
+	}
+	paths := make([]string, 0, len(parts))
+	for i, part := range parts {
+		if i > 0 && part.PartNumber <= parts[i-1].PartNumber {
+			return nil, ErrInvalidPartOrder
+		}
+		stagedPart, ok := stagedByNumber[part.PartNumber]
+		if !ok || stagedPart.MD5Hash != part.MD5Hash {
+			return nil, ErrInvalidPart
+		}
+		paths = append(paths, s.partPath(upload.UploadId, part.PartNumber))
+	}
+	return &partReader{paths: paths}, nil
+}
+
+func (s *MultipartServiceImpl) Abort(ctx context.Context, uploadId string) error {
+	if err := os.RemoveAll(s.uploadDir(uploadId)); err != nil {
+		return err
+	}
+	return s.repo.DeleteUpload(ctx, uploadId)
+}
+
+// PurgeStale aborts every session that has been idle for longer than the
+// configured expiration
+func (s *MultipartServiceImpl) PurgeStale(ctx context.Context) (int, error) {
+	uploads, err := s.repo.ListStaleUploads(ctx, time.Now().Add(-s.expiration))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, upload := range uploads {
+		if err := s.Abort(ctx, upload.UploadId); err != nil {
+			log.Printf("failed to purge multipart upload %v: %v", upload.UploadId, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// partReader reads the staged part files one after another, keeping at most
+// one of them open at a time
+type partReader struct {
+	paths   []string
+	current *os.File
+}
+
+func (r *partReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.paths) == 0 {
+				return 0, io.EOF
+			}
+			file, err := os.Open(r.paths[0])
+			if err != nil {
+				return 0, err
+			}
+			r.current = file
+			r.paths = r.paths[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *partReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
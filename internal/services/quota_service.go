@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+)
+
+// UNLIMITED is the allowance of a user without a byte quota
+const UNLIMITED = -1
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+type QuotaService interface {
+	Usage(ctx context.Context, owner string) (models.Usage, error)
+	// Quota returns the user's own quota, or the default one, and whether it
+	// is the user's own
+	Quota(ctx context.Context, owner string) (models.Quota, bool, error)
+	SetQuota(ctx context.Context, quota models.Quota) error
+	// ResetQuota makes the default quota apply to the user again
+	ResetQuota(ctx context.Context, owner string) error
+	// Allowance returns how many bytes a file of owner may hold, given that it
+	// replaces a file of previousSize or is new, or UNLIMITED. It fails with
+	// ErrQuotaExceeded when a new file would exceed the file count.
+	Allowance(ctx context.Context, owner string, previousSize int64, isNew bool) (int64, error)
+}
+
+type QuotaServiceImpl struct {
+	repo     repositories.QuotaRepository
+	defaults models.Quota
+}
+
+func NewQuotaService(repo repositories.QuotaRepository, defaults models.Quota) *QuotaServiceImpl {
+	return &QuotaServiceImpl{repo, defaults}
+}
+
+func (s *QuotaServiceImpl) Usage(ctx context.Context, owner string) (models.Usage, error) {
+	return s.repo.GetUsage(ctx, owner)
+}
+
+func (s *QuotaServiceImpl) Quota(ctx context.Context, owner string) (models.Quota, bool, error) {
+	quota, err := s.repo.GetQuota(ctx, owner)
+	if err == sql.ErrNoRows {
+		quota = s.defaults
+		quota.Owner = owner
+		return quota, false, nil
+	}
+	return quota, err == nil, err
+}
+
+func (s *QuotaServiceImpl) SetQuota(ctx context.Context, quota models.Quota) error {
+	return s.repo.PutQuota(ctx, quota)
+}
+
+func (s *QuotaServiceImpl) ResetQuota(ctx context.Context, owner string) error {
+	return s.repo.DeleteQuota(ctx, owner)
+}
+
+func (s *QuotaServiceImpl) Allowance(ctx context.Context, owner string, previousSize int64, isNew bool) (int64, error) {
+	quota, _, err := s.Quota(ctx, owner)
+	if err != nil {
+		return 0, err
+	}
+	usage, err := s.repo.GetUsage(ctx, owner)
+	if err != nil {
+		return 0, err
+	}
+
+	if isNew && quota.MaxFiles > 0 && usage.FileCount >= quota.MaxFiles {
+		return 0, ErrQuotaExceeded
+	}
+	if quota.MaxBytes == 0 {
+		return UNLIMITED, nil
+	}
+	return max(quota.MaxBytes-usage.BytesUsed+previousSize, 0), nil
+}
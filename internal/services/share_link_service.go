@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SHARE_LINK_BYTES is the amount of randomness in a share link token
+const SHARE_LINK_BYTES = 32
+
+var (
+	ErrShareLinkNotFound = errors.New("share link not found")
+	ErrShareLinkExpired  = errors.New("share link expired")
+	ErrPasswordRequired  = errors.New("share link requires a password")
+	ErrWrongLinkPassword = errors.New("wrong share link password")
+)
+
+// ShareLinkOptions restrict a new link; zero values mean no restriction
+type ShareLinkOptions struct {
+	ExpiresAt    time.Time
+	Password     string
+	MaxDownloads int
+}
+
+type ShareLinkService interface {
+	// Create makes a link to owner's fileName and returns its token; only the
+	// token's hash is stored, so it cannot be recovered later
+	Create(ctx context.Context, owner string, fileName string, opts ShareLinkOptions) (string, models.ShareLink, error)
+	// Open checks the token and password and returns the link they open
+	Open(ctx context.Context, token string, password string) (models.ShareLink, error)
+	// Redeem records an access through the link. A download counts against
+	// the link's limit, and fails with ErrShareLinkExpired once none is left.
+	Redeem(ctx context.Context, link models.ShareLink, access models.ShareLinkAccess, download bool) error
+	List(ctx context.Context, owner string) ([]models.ShareLink, error)
+	Revoke(ctx context.Context, owner string, linkId string) error
+	Accesses(ctx context.Context, owner string, linkId string) ([]models.ShareLinkAccess, error)
+}
+
+type ShareLinkServiceImpl struct {
+	repo repositories.ShareLinkRepository
+}
+
+func NewShareLinkService(repo repositories.ShareLinkRepository) *ShareLinkServiceImpl {
+	return &ShareLinkServiceImpl{repo}
+}
+
+func (s *ShareLinkServiceImpl) Create(ctx context.Context, owner string, fileName string, opts ShareLinkOptions) (string, models.ShareLink, error) {
+	raw := make([]byte, SHARE_LINK_BYTES)
+	if _, err := rand.Read(raw); err != nil {
+		return "", models.ShareLink{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	link := models.ShareLink{
+		LinkId:       uuid.NewString(),
+		TokenHash:    hashShareLinkToken(token),
+		Owner:        owner,
+		FileName:     fileName,
+		ExpiresAt:    opts.ExpiresAt,
+		MaxDownloads: opts.MaxDownloads,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if opts.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", models.ShareLink{}, err
+		}
+		link.PasswordHash = string(hash)
+	}
+	if err := s.repo.Create(ctx, link); err != nil {
+		return "", models.ShareLink{}, err
+	}
+	return token, link, nil
+}
+
+func (s *ShareLinkServiceImpl) Open(ctx context.Context, token string, password string) (models.ShareLink, error) {
+	link, err := s.repo.GetByHash(ctx, hashShareLinkToken(token))
+	if err == sql.ErrNoRows {
+		return models.ShareLink{}, ErrShareLinkNotFound
+	}
+	if err != nil {
+		return models.ShareLink{}, err
+	}
+	if link.Revoked() {
+		return models.ShareLink{}, ErrShareLinkNotFound
+	}
+	if !link.Usable(time.Now()) {
+		return models.ShareLink{}, ErrShareLinkExpired
+	}
+
+	if link.PasswordHash != "" {
+		if password == "" {
+			return models.ShareLink{}, ErrPasswordRequired
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+			return models.ShareLink{}, ErrWrongLinkPassword
+		}
+	}
+	return link, nil
+}
+
+func (s *ShareLinkServiceImpl) Redeem(ctx context.Context, link models.ShareLink, access models.ShareLinkAccess, download bool) error {
+	if download {
+		ok, err := s.repo.CountDownload(ctx, link.LinkId, time.Now())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrShareLinkExpired
+		}
+	}
+	access.LinkId = link.LinkId
+	access.AccessedAt = time.Now().UTC()
+	return s.repo.RecordAccess(ctx, access)
+}
+
+func (s *ShareLinkServiceImpl) List(ctx context.Context, owner string) ([]models.ShareLink, error) {
+	return s.repo.ListByOwner(ctx, owner)
+}
+
+func (s *ShareLinkServiceImpl) Revoke(ctx context.Context, owner string, linkId string) error {
+	ok, err := s.repo.Revoke(ctx, owner, linkId, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrShareLinkNotFound
+	}
+	return nil
+}
+
+func (s *ShareLinkServiceImpl) Accesses(ctx context.Context, owner string, linkId string) ([]models.ShareLinkAccess, error) {
+	return s.repo.ListAccesses(ctx, owner, linkId)
+}
+
+func hashShareLinkToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+)
+
+// STREAM_TOKEN_BYTES is the amount of randomness in a stream token
+const STREAM_TOKEN_BYTES = 32
+
+var ErrInvalidStreamToken = errors.New("invalid stream token")
+
+type StreamTokenService interface {
+	// Mint creates a token for owner's fileName and returns it; only its hash
+	// is stored, so it cannot be recovered later
+	Mint(ctx context.Context, owner string, fileName string, ttl time.Duration, maxUses int) (string, models.StreamToken, error)
+	// Redeem uses the token once to access owner's fileName
+	Redeem(ctx context.Context, token string, owner string, fileName string) error
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+type StreamTokenServiceImpl struct {
+	repo repositories.StreamTokenRepository
+}
+
+func NewStreamTokenService(repo repositories.StreamTokenRepository) *StreamTokenServiceImpl {
+	return &StreamTokenServiceImpl{repo}
+}
+
+func (s *StreamTokenServiceImpl) Mint(ctx context.Context, owner string, fileName string, ttl time.Duration, maxUses int) (string, models.StreamToken, error) {
+	raw := make([]byte, STREAM_TOKEN_BYTES)
+	if _, err := rand.Read(raw); err != nil {
+		return "", models.StreamToken{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now().UTC()
+	streamToken := models.StreamToken{
+		TokenHash: hashStreamToken(token),
+		Owner:     owner,
+		FileName:  fileName,
+		MaxUses:   maxUses,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := s.repo.Create(ctx, streamToken); err != nil {
+		return "", models.StreamToken{}, err
+	}
+	return token, streamToken, nil
+}
+
+func (s *StreamTokenServiceImpl) Redeem(ctx context.Context, token string, owner string, fileName string) error {
+	ok, err := s.repo.Consume(ctx, hashStreamToken(token), owner, fileName, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidStreamToken
+	}
+	return nil
+}
+
+// PurgeExpired removes tokens that can no longer be used
+func (s *StreamTokenServiceImpl) PurgeExpired(ctx context.Context) (int64, error) {
+	return s.repo.DeleteExpired(ctx, time.Now())
+}
+
+func hashStreamToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
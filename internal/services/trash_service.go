@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/google/uuid"
+)
+
+var ErrTrashItemNotFound = errors.New("trash item not found")
+
+type TrashService interface {
+	// Trash moves a file into its owner's trash
+	Trash(ctx context.Context, metadata models.FileMetadata, deletedBy string) (models.TrashItem, error)
+	// Restore moves an item back to its original path
+	Restore(ctx context.Context, item models.TrashItem) error
+	Get(ctx context.Context, owner string, trashId string) (models.TrashItem, error)
+	List(ctx context.Context, owner string) ([]models.TrashItem, error)
+	// Forget removes an item from the trash; the caller releases its content
+	Forget(ctx context.Context, trashId string) error
+	// Expired returns the items deleted longer than retention ago
+	Expired(ctx context.Context, retention time.Duration) ([]models.TrashItem, error)
+}
+
+type TrashServiceImpl struct {
+	repo repositories.TrashRepository
+}
+
+func NewTrashService(repo repositories.TrashRepository) *TrashServiceImpl {
+	return &TrashServiceImpl{repo}
+}
+
+func (s *TrashServiceImpl) Trash(ctx context.Context, metadata models.FileMetadata, deletedBy string) (models.TrashItem, error) {
+	item := models.TrashItem{
+		TrashId:   uuid.NewString(),
+		File:      metadata,
+		DeletedAt: time.Now().UTC(),
+		DeletedBy: deletedBy,
+	}
+	return item, s.repo.Trash(ctx, metadata.FileId, item.TrashId, item.DeletedAt, deletedBy)
+}
+
+func (s *TrashServiceImpl) Restore(ctx context.Context, item models.TrashItem) error {
+	err := s.repo.Restore(ctx, item.TrashId)
+	if err == sql.ErrNoRows {
+		return ErrTrashItemNotFound
+	}
+	return err
+}
+
+func (s *TrashServiceImpl) Get(ctx context.Context, owner string, trashId string) (models.TrashItem, error) {
+	item, err := s.repo.Get(ctx, owner, trashId)
+	if err == sql.ErrNoRows {
+		return models.TrashItem{}, ErrTrashItemNotFound
+	}
+	return item, err
+}
+
+func (s *TrashServiceImpl) List(ctx context.Context, owner string) ([]models.TrashItem, error) {
+	return s.repo.ListByOwner(ctx, owner)
+}
+
+func (s *TrashServiceImpl) Forget(ctx context.Context, trashId string) error {
+	return s.repo.Delete(ctx, trashId)
+}
+
+func (s *TrashServiceImpl) Expired(ctx context.Context, retention time.Duration) ([]models.TrashItem, error) {
+	return s.repo.ListDeletedBefore(ctx, time.Now().Add(-retention))
+}
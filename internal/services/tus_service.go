@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/google/uuid"
+)
+
+type TusService interface {
+	CreateUpload(ctx context.Context, owner string, fileName string, length int64, metadata string) (models.TusUpload, error)
+	GetUpload(ctx context.Context, uploadId string) (models.TusUpload, error)
+	WriteChunk(ctx context.Context, upload models.TusUpload, src io.Reader) (models.TusUpload, error)
+	OpenUpload(upload models.TusUpload) (*os.File, error)
+	TerminateUpload(ctx context.Context, uploadId string) error
+	PurgeExpired(ctx context.Context) (int, error)
+}
+
+type TusServiceImpl struct {
+	repo       repositories.TusRepository
+	stagingDir string
+	expiration time.Duration
+}
+
+// NewTusService keeps partially received uploads under stagingDir, while the
+// offsets live in the database so sessions survive a server restart
+func NewTusService(repo repositories.TusRepository, stagingDir string, expiration time.Duration) *TusServiceImpl {
+	return &TusServiceImpl{
+		repo:       repo,
+		stagingDir: stagingDir,
+		expiration: expiration,
+	}
+}
+
+func (s *TusServiceImpl) stagingPath(uploadId string) string {
+	return filepath.Join(s.stagingDir, uploadId)
+}
+
+// CreateUpload registers a new upload session and creates its empty staging file
+func (s *TusServiceImpl) CreateUpload(ctx context.Context, owner string, fileName string, length int64, metadata string) (models.TusUpload, error) {
+	now := time.Now().UTC()
+	upload := models.TusUpload{
+		UploadId:     uuid.NewString(),
+		Owner:        owner,
+		FileName:     fileName,
+		UploadLength: length,
+		Metadata:     metadata,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(s.expiration),
+	}
+
+	if err := os.MkdirAll(s.stagingDir, 0755); err != nil {
+		return models.TusUpload{}, err
+	}
+	file, err := os.Create(s.stagingPath(upload.UploadId))
+	if err != nil {
+		return models.TusUpload{}, err
+	}
+	file.Close()
+
+	if err := s.repo.Create(ctx, upload); err != nil {
+		os.Remove(s.stagingPath(upload.UploadId))
+		return models.TusUpload{}, err
+	}
+	return upload, nil
+}
+
+func (s *TusServiceImpl) GetUpload(ctx context.Context, uploadId string) (models.TusUpload, error) {
+	return s.repo.Get(ctx, uploadId)
+}
+
+// WriteChunk appends src at the upload's current offset. The offset is
+// persisted even when the client disconnects mid-chunk, so the bytes that did
+// arrive are not requested again. Writes to the same upload must not overlap.
+func (s *TusServiceImpl) WriteChunk(ctx context.Context, upload models.TusUpload, src io.Reader) (models.TusUpload, error) {
+	file, err := os.OpenFile(s.stagingPath(upload.UploadId), os.O_WRONLY, 0644)
+	if err != nil {
+		return upload, err
+	}
+	defer file.Close()
+
+	// drop any bytes written after the last persisted offset, e.g. by a crash
+	if err := file.Truncate(upload.UploadOffset); err != nil {
+		return upload, err
+	}
+	if _, err := file.Seek(upload.UploadOffset, io.SeekStart); err != nil {
+		return upload, err
+	}
+
+	written, copyErr := io.Copy(file, io.LimitReader(src, upload.UploadLength-upload.UploadOffset))
+	if written > 0 {
+		if err := file.Sync(); err != nil {
+			return upload, err
+		}
+		// a disconnect cancels ctx, yet the bytes that arrived must be kept
+		if err := s.repo.UpdateOffset(context.WithoutCancel(ctx), upload.UploadId, upload.UploadOffset+written); err != nil {
+			return upload, err
+		}
+		upload.UploadOffset += written
+	}
+	return upload, copyErr
+}
+
+func (s *TusServiceImpl) OpenUpload(upload models.TusUpload) (*os.File, error) {
+	return os.Open(s.stagingPath(upload.UploadId))
+}
+
+func (s *TusServiceImpl) TerminateUpload(ctx context.Context, uploadId string) error {
+	if err := os.Remove(s.stagingPath(uploadId)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return s.repo.Delete(ctx, uploadId)
+}
+
+// PurgeExpired removes every upload session whose expiration has passed
+func (s *TusServiceImpl) PurgeExpired(ctx context.Context) (int, error) {
+	uploads, err := s.repo.ListExpired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, upload := range uploads {
+		if err := s.TerminateUpload(ctx, upload.UploadId); err != nil {
+			log.Printf("failed to purge tus upload %v: %v", upload.UploadId, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
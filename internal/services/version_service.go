@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/models"
+	"github.com/Iwoooooods/fs-upload-go/internal/repositories"
+	"github.com/google/uuid"
+)
+
+type VersionService interface {
+	// Archive keeps the content metadata currently describes as a version
+	// of the file, together with its reference to the blob
+	Archive(ctx context.Context, metadata models.FileMetadata) (models.FileVersion, error)
+	GetVersion(ctx context.Context, fileId string, versionId string) (models.FileVersion, error)
+	ListVersions(ctx context.Context, fileId string) ([]models.FileVersion, error)
+	DeleteVersion(ctx context.Context, versionId string) error
+	// DeleteVersions forgets every version of a file; the caller releases
+	// the blobs of the returned versions
+	DeleteVersions(ctx context.Context, fileId string) ([]models.FileVersion, error)
+	// Prunable returns the versions the retention policy no longer keeps
+	Prunable(ctx context.Context, policy RetentionPolicy) ([]models.FileVersion, error)
+}
+
+// RetentionPolicy keeps a version while it is among the KeepLast newest
+// versions of its file or younger than KeepFor. A zero field leaves that rule
+// out, and a zero policy keeps every version.
+type RetentionPolicy struct {
+	KeepLast int
+	KeepFor  time.Duration
+}
+
+type VersionServiceImpl struct {
+	repo repositories.FileVersionRepository
+}
+
+func NewVersionService(repo repositories.FileVersionRepository) *VersionServiceImpl {
+	return &VersionServiceImpl{repo}
+}
+
+func (s *VersionServiceImpl) Archive(ctx context.Context, metadata models.FileMetadata) (models.FileVersion, error) {
+	version := models.FileVersion{
+		VersionId:   metadata.VersionId,
+		FileId:      metadata.FileId,
+		Owner:       metadata.Owner,
+		FileName:    metadata.FileName,
+		MD5Hash:     metadata.MD5Hash,
+		SHA256Hash:  metadata.SHA256Hash,
+		Size:        metadata.Size,
+		ContentType: metadata.ContentType,
+		Author:      metadata.Author,
+		CreatedAt:   metadata.UpdatedAt,
+	}
+	// files recorded before versioning may lack an id
+	if version.VersionId == "" {
+		version.VersionId = uuid.NewString()
+	}
+	return version, s.repo.Create(ctx, version)
+}
+
+func (s *VersionServiceImpl) GetVersion(ctx context.Context, fileId string, versionId string) (models.FileVersion, error) {
+	return s.repo.Get(ctx, fileId, versionId)
+}
+
+func (s *VersionServiceImpl) ListVersions(ctx context.Context, fileId string) ([]models.FileVersion, error) {
+	return s.repo.ListByFile(ctx, fileId)
+}
+
+func (s *VersionServiceImpl) DeleteVersion(ctx context.Context, versionId string) error {
+	return s.repo.Delete(ctx, versionId)
+}
+
+func (s *VersionServiceImpl) DeleteVersions(ctx context.Context, fileId string) ([]models.FileVersion, error) {
+	return s.repo.DeleteByFile(ctx, fileId)
+}
+
+func (s *VersionServiceImpl) Prunable(ctx context.Context, policy RetentionPolicy) ([]models.FileVersion, error) {
+	if policy.KeepLast <= 0 && policy.KeepFor <= 0 {
+		return nil, nil
+	}
+	var keptAfter time.Time
+	if policy.KeepFor > 0 {
+		keptAfter = time.Now().Add(-policy.KeepFor)
+	}
+	return s.repo.ListPrunable(ctx, max(policy.KeepLast, 0), keptAfter)
+}
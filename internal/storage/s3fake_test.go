@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an in-process stand-in for an S3-compatible service with a
+// single path-style bucket. It checks request signatures and serves the
+// object operations S3Storage relies on.
+type fakeS3 struct {
+	accessKey string
+	secretKey string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(t *testing.T, accessKey string, secretKey string) *httptest.Server {
+	fake := &fakeS3{
+		accessKey: accessKey,
+		secretKey: secretKey,
+		objects:   map[string][]byte{},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.validSignature(r) {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+		return
+	}
+
+	_, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, r.URL.Query().Get("prefix"), r.URL.Query().Get("continuation-token"))
+	case r.Method == http.MethodPut:
+		content, _ := io.ReadAll(r.Body)
+		f.objects[key] = content
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		content, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+			var start, end int
+			spec := strings.TrimPrefix(rangeHeader, "bytes=")
+			from, to, _ := strings.Cut(spec, "-")
+			start, _ = strconv.Atoi(from)
+			end = len(content) - 1
+			if to != "" {
+				end, _ = strconv.Atoi(to)
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+			w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[start : end+1])
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list returns one object per page to exercise continuation tokens
+func (f *fakeS3) list(w http.ResponseWriter, prefix string, token string) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	type content struct {
+		Key  string `xml:"Key"`
+		Size int    `xml:"Size"`
+	}
+	result := struct {
+		XMLName               xml.Name  `xml:"ListBucketResult"`
+		Contents              []content `xml:"Contents"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+	}{}
+	// the continuation token is simply the last key already returned
+	for i, key := range keys {
+		if key > token {
+			result.Contents = append(result.Contents, content{Key: key, Size: len(f.objects[key])})
+			result.IsTruncated = i < len(keys)-1
+			if result.IsTruncated {
+				result.NextContinuationToken = key
+			}
+			break
+		}
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeS3) validSignature(r *http.Request) bool {
+	now, err := time.Parse(s3AmzDateLayout, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+
+	clone := r.Clone(r.Context())
+	clone.URL.Host = r.Host
+	clone.Header.Del("Authorization")
+	signS3Request(clone, f.accessKey, f.secretKey, s3DefaultRegion, r.Header.Get("X-Amz-Content-Sha256"), now)
+	return clone.Header.Get("Authorization") == r.Header.Get("Authorization")
+}
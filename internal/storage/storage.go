@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Iwoooooods/fs-upload-go/internal/config"
+)
+
+var ErrNotExist = errors.New("object does not exist")
+
+type ObjectInfo struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Storage is a backend holding objects addressed by slash separated keys
+type Storage interface {
+	// Put stores src under key, replacing any existing object. size is the
+	// number of bytes src yields, or -1 when unknown.
+	Put(ctx context.Context, key string, src io.Reader, size int64) error
+	// Get streams length bytes of the object starting at offset; a negative
+	// length reads until the end
+	Get(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Delete removes the object; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// FileMover is implemented by backends that can take over a local file
+// without copying it
+type FileMover interface {
+	PutFile(ctx context.Context, key string, path string) error
+}
+
+// PutFile stores the local file at path under key, moving it when the backend
+// allows and uploading a copy otherwise. The file at path is consumed either way.
+func PutFile(ctx context.Context, s Storage, key string, path string) error {
+	if mover, ok := s.(FileMover); ok {
+		return mover.PutFile(ctx, key, path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, key, file, info.Size()); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// NewFromConfig creates the backend selected by STORAGE_BACKEND
+func NewFromConfig(cfg *config.Config) (Storage, error) {
+	switch cfg.StorageBackend {
+	case "", "local":
+		return NewLocalStorage(filepath.Join(cfg.BasePath, ".blobs")), nil
+	case "s3":
+		return NewS3Storage(S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+	}
+}
+
+// Reader reads an object through ranged Gets so that it can seek, which
+// lets http.ServeContent answer Range requests whatever the backend
+type Reader struct {
+	Info ObjectInfo
+
+	ctx     context.Context
+	storage Storage
+	offset  int64
+	body    io.ReadCloser
+}
+
+// Open returns a seekable reader over the object stored under key
+func Open(ctx context.Context, s Storage, key string) (*Reader, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		Info:    info,
+		ctx:     ctx,
+		storage: s,
+	}, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.Info.Size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.storage.Get(r.ctx, r.Info.Key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.Info.Size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek to a negative offset")
+	}
+
+	// the open body only serves the current position
+	if offset != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *Reader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS tus_uploads (
+    upload_id TEXT PRIMARY KEY,
+    owner TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    upload_length INTEGER NOT NULL,
+    upload_offset INTEGER NOT NULL DEFAULT 0,
+    metadata TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS multipart_parts;
+DROP TABLE IF EXISTS multipart_uploads;
\ No newline at end of file
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS blobs;
+DROP INDEX IF EXISTS idx_metadata_md5_hash;
+DROP INDEX IF EXISTS idx_metadata_owner_file_name;
+ALTER TABLE metadata DROP COLUMN owner;
\ No newline at end of file
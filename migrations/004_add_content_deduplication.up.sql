@@ -0,0 +1,9 @@
+ALTER TABLE metadata ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_metadata_owner_file_name ON metadata (owner, file_name);
+CREATE INDEX IF NOT EXISTS idx_metadata_md5_hash ON metadata (md5_hash);
+
+CREATE TABLE IF NOT EXISTS blobs (
+    md5_hash TEXT PRIMARY KEY,
+    ref_count INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS blobs;
+
+CREATE TABLE IF NOT EXISTS blobs (
+    md5_hash TEXT PRIMARY KEY,
+    ref_count INTEGER NOT NULL DEFAULT 0
+);
+
+DROP INDEX IF EXISTS idx_metadata_sha256_hash;
+ALTER TABLE metadata DROP COLUMN sha256_hash;
\ No newline at end of file
@@ -0,0 +1,14 @@
+ALTER TABLE metadata ADD COLUMN sha256_hash TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_metadata_sha256_hash ON metadata (sha256_hash);
+
+-- blobs were keyed by MD5 before; files stored that way keep being served
+-- from their user directory
+DROP TABLE IF EXISTS blobs;
+
+CREATE TABLE IF NOT EXISTS blobs (
+    sha256_hash TEXT PRIMARY KEY,
+    size INTEGER NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL
+);
\ No newline at end of file
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_metadata_owner_updated_at;
+DROP INDEX IF EXISTS idx_metadata_owner_size;
+ALTER TABLE metadata DROP COLUMN updated_at;
+ALTER TABLE metadata DROP COLUMN created_at;
+ALTER TABLE metadata DROP COLUMN content_type;
+ALTER TABLE metadata DROP COLUMN size;
\ No newline at end of file
@@ -0,0 +1,14 @@
+ALTER TABLE metadata ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE metadata ADD COLUMN content_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE metadata ADD COLUMN created_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+ALTER TABLE metadata ADD COLUMN updated_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+
+-- files in the blob store already know their size and when they were stored
+UPDATE metadata SET
+    size = (SELECT size FROM blobs WHERE blobs.sha256_hash = metadata.sha256_hash),
+    created_at = (SELECT created_at FROM blobs WHERE blobs.sha256_hash = metadata.sha256_hash),
+    updated_at = (SELECT created_at FROM blobs WHERE blobs.sha256_hash = metadata.sha256_hash)
+WHERE sha256_hash IN (SELECT sha256_hash FROM blobs);
+
+CREATE INDEX IF NOT EXISTS idx_metadata_owner_size ON metadata (owner, size);
+CREATE INDEX IF NOT EXISTS idx_metadata_owner_updated_at ON metadata (owner, updated_at);
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE metadata DROP COLUMN storage_path;
+ALTER TABLE metadata DROP COLUMN last_accessed_at;
\ No newline at end of file
@@ -0,0 +1,13 @@
+ALTER TABLE metadata ADD COLUMN last_accessed_at DATETIME;
+ALTER TABLE metadata ADD COLUMN storage_path TEXT NOT NULL DEFAULT '';
+
+-- blob keys fan out by the first bytes of the hash
+UPDATE metadata
+SET storage_path = substr(sha256_hash, 1, 2) || '/' || substr(sha256_hash, 3, 2) || '/' || sha256_hash
+WHERE sha256_hash != '';
+
+-- files from before the blob store live in their owner's directory; files
+-- without an owner are claimed by the BASE_PATH scan that follows
+UPDATE metadata
+SET storage_path = owner || '/' || file_name
+WHERE sha256_hash = '' AND owner != '';
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS stream_tokens;
\ No newline at end of file
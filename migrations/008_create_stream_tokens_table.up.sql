@@ -0,0 +1,12 @@
+-- only a hash of each token is stored, the token itself is a bearer secret
+CREATE TABLE IF NOT EXISTS stream_tokens (
+    token_hash TEXT PRIMARY KEY,
+    owner TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    max_uses INTEGER NOT NULL DEFAULT 0,
+    use_count INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_stream_tokens_expires_at ON stream_tokens (expires_at);
\ No newline at end of file
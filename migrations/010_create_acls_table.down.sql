@@ -0,0 +1 @@
+DROP TABLE IF EXISTS acls;
\ No newline at end of file
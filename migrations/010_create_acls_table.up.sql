@@ -0,0 +1,13 @@
+-- a grant on a path ending in '/' covers every file under that folder prefix
+CREATE TABLE IF NOT EXISTS acls (
+    acl_id TEXT PRIMARY KEY,
+    owner TEXT NOT NULL,
+    path TEXT NOT NULL,
+    grantee_type TEXT NOT NULL,
+    grantee TEXT NOT NULL,
+    permission TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    UNIQUE (owner, path, grantee_type, grantee)
+);
+
+CREATE INDEX IF NOT EXISTS idx_acls_grantee ON acls (grantee_type, grantee);
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS share_link_accesses;
+DROP TABLE IF EXISTS share_links;
\ No newline at end of file
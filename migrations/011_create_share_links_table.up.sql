@@ -0,0 +1,26 @@
+-- public links to one file; only the hash of the link token is stored
+CREATE TABLE IF NOT EXISTS share_links (
+    link_id TEXT PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    owner TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    password_hash TEXT NOT NULL DEFAULT '',
+    expires_at DATETIME,
+    max_downloads INTEGER NOT NULL DEFAULT 0,
+    download_count INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    revoked_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_links_owner ON share_links (owner);
+
+CREATE TABLE IF NOT EXISTS share_link_accesses (
+    access_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    link_id TEXT NOT NULL,
+    method TEXT NOT NULL,
+    remote_addr TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    accessed_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_link_accesses_link ON share_link_accesses (link_id, accessed_at);
\ No newline at end of file
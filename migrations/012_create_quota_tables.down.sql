@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS metadata_usage_delete;
+DROP TRIGGER IF EXISTS metadata_usage_update;
+DROP TRIGGER IF EXISTS metadata_usage_insert;
+DROP TABLE IF EXISTS user_quotas;
+DROP TABLE IF EXISTS user_usage;
\ No newline at end of file
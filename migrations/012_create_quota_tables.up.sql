@@ -0,0 +1,41 @@
+-- usage is the size and number of the files each user owns, kept up to date
+-- by triggers so that every way of creating or removing a file is counted
+CREATE TABLE IF NOT EXISTS user_usage (
+    owner TEXT PRIMARY KEY,
+    bytes_used INTEGER NOT NULL DEFAULT 0,
+    file_count INTEGER NOT NULL DEFAULT 0
+);
+
+-- per-user limits replacing the configured defaults, 0 meaning no limit
+CREATE TABLE IF NOT EXISTS user_quotas (
+    owner TEXT PRIMARY KEY,
+    max_bytes INTEGER NOT NULL DEFAULT 0,
+    max_files INTEGER NOT NULL DEFAULT 0
+);
+
+INSERT INTO user_usage (owner, bytes_used, file_count)
+SELECT owner, SUM(size), COUNT(*) FROM metadata GROUP BY owner;
+
+CREATE TRIGGER IF NOT EXISTS metadata_usage_insert AFTER INSERT ON metadata
+BEGIN
+    INSERT INTO user_usage (owner, bytes_used, file_count) VALUES (NEW.owner, NEW.size, 1)
+    ON CONFLICT (owner) DO UPDATE SET
+        bytes_used = bytes_used + excluded.bytes_used,
+        file_count = file_count + 1;
+END;
+
+CREATE TRIGGER IF NOT EXISTS metadata_usage_update AFTER UPDATE OF owner, size ON metadata
+BEGIN
+    UPDATE user_usage SET bytes_used = bytes_used - OLD.size, file_count = file_count - 1
+    WHERE owner = OLD.owner;
+    INSERT INTO user_usage (owner, bytes_used, file_count) VALUES (NEW.owner, NEW.size, 1)
+    ON CONFLICT (owner) DO UPDATE SET
+        bytes_used = bytes_used + excluded.bytes_used,
+        file_count = file_count + 1;
+END;
+
+CREATE TRIGGER IF NOT EXISTS metadata_usage_delete AFTER DELETE ON metadata
+BEGIN
+    UPDATE user_usage SET bytes_used = bytes_used - OLD.size, file_count = file_count - 1
+    WHERE owner = OLD.owner;
+END;
\ No newline at end of file
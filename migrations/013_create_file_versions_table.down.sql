@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS file_versions;
+ALTER TABLE metadata DROP COLUMN author;
+ALTER TABLE metadata DROP COLUMN version_id;
\ No newline at end of file
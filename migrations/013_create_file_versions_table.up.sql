@@ -0,0 +1,21 @@
+ALTER TABLE metadata ADD COLUMN version_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE metadata ADD COLUMN author TEXT NOT NULL DEFAULT '';
+
+-- every file's current content becomes its first version
+UPDATE metadata SET version_id = lower(hex(randomblob(16))), author = owner WHERE version_id = '';
+
+-- previous versions of files; each keeps a reference to its blob until pruned
+CREATE TABLE IF NOT EXISTS file_versions (
+    version_id TEXT PRIMARY KEY,
+    file_id TEXT NOT NULL,
+    owner TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    md5_hash TEXT NOT NULL,
+    sha256_hash TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    content_type TEXT NOT NULL,
+    author TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_versions_file ON file_versions (file_id, created_at);
\ No newline at end of file
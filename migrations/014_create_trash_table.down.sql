@@ -0,0 +1 @@
+DROP TABLE IF EXISTS trash;
\ No newline at end of file
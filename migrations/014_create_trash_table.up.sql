@@ -0,0 +1,23 @@
+-- deleted files, kept with their metadata and their reference to the blob
+-- until restored or purged
+CREATE TABLE IF NOT EXISTS trash (
+    trash_id TEXT PRIMARY KEY,
+    file_id TEXT NOT NULL,
+    owner TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    md5_hash TEXT NOT NULL,
+    sha256_hash TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    content_type TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    last_accessed_at DATETIME,
+    storage_path TEXT NOT NULL,
+    version_id TEXT NOT NULL,
+    author TEXT NOT NULL,
+    deleted_at DATETIME NOT NULL,
+    deleted_by TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_trash_owner ON trash (owner, deleted_at);
+CREATE INDEX IF NOT EXISTS idx_trash_deleted_at ON trash (deleted_at);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS folders;
\ No newline at end of file
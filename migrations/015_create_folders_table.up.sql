@@ -0,0 +1,8 @@
+-- folders of each user; a file's folders are created along with it, so that
+-- listings never need to look at the storage
+CREATE TABLE IF NOT EXISTS folders (
+    owner TEXT NOT NULL,
+    path TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (owner, path)
+);
\ No newline at end of file
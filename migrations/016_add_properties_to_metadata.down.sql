@@ -0,0 +1,2 @@
+ALTER TABLE trash DROP COLUMN properties;
+ALTER TABLE metadata DROP COLUMN properties;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- custom key-value pairs given at upload, as a JSON object
+ALTER TABLE metadata ADD COLUMN properties TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE trash ADD COLUMN properties TEXT NOT NULL DEFAULT '{}';
\ No newline at end of file
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS file_versions_usage_delete;
+DROP TRIGGER IF EXISTS file_versions_usage_update;
+DROP TRIGGER IF EXISTS file_versions_usage_insert;
+
+UPDATE user_usage SET bytes_used = bytes_used - (
+    SELECT COALESCE(SUM(size), 0) FROM file_versions WHERE file_versions.owner = user_usage.owner
+);
\ No newline at end of file
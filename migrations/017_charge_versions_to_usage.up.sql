@@ -0,0 +1,23 @@
+-- previous versions keep their content, so their bytes count toward their
+-- owner's usage like files do, without counting as files
+INSERT INTO user_usage (owner, bytes_used, file_count)
+SELECT owner, SUM(size), 0 FROM file_versions WHERE true GROUP BY owner
+ON CONFLICT (owner) DO UPDATE SET bytes_used = bytes_used + excluded.bytes_used;
+
+CREATE TRIGGER IF NOT EXISTS file_versions_usage_insert AFTER INSERT ON file_versions
+BEGIN
+    INSERT INTO user_usage (owner, bytes_used, file_count) VALUES (NEW.owner, NEW.size, 0)
+    ON CONFLICT (owner) DO UPDATE SET bytes_used = bytes_used + excluded.bytes_used;
+END;
+
+CREATE TRIGGER IF NOT EXISTS file_versions_usage_update AFTER UPDATE OF owner, size ON file_versions
+BEGIN
+    UPDATE user_usage SET bytes_used = bytes_used - OLD.size WHERE owner = OLD.owner;
+    INSERT INTO user_usage (owner, bytes_used, file_count) VALUES (NEW.owner, NEW.size, 0)
+    ON CONFLICT (owner) DO UPDATE SET bytes_used = bytes_used + excluded.bytes_used;
+END;
+
+CREATE TRIGGER IF NOT EXISTS file_versions_usage_delete AFTER DELETE ON file_versions
+BEGIN
+    UPDATE user_usage SET bytes_used = bytes_used - OLD.size WHERE owner = OLD.owner;
+END;
\ No newline at end of file
@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS trash_usage_delete;
+DROP TRIGGER IF EXISTS trash_usage_insert;
+
+UPDATE user_usage SET bytes_used = bytes_used - (
+    SELECT COALESCE(SUM(size), 0) FROM trash WHERE trash.owner = user_usage.owner
+);
\ No newline at end of file
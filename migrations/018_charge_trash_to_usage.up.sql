@@ -0,0 +1,16 @@
+-- trashed files keep their content until purged, so their bytes still count
+-- toward their owner's usage, without counting as files
+INSERT INTO user_usage (owner, bytes_used, file_count)
+SELECT owner, SUM(size), 0 FROM trash WHERE true GROUP BY owner
+ON CONFLICT (owner) DO UPDATE SET bytes_used = bytes_used + excluded.bytes_used;
+
+CREATE TRIGGER IF NOT EXISTS trash_usage_insert AFTER INSERT ON trash
+BEGIN
+    INSERT INTO user_usage (owner, bytes_used, file_count) VALUES (NEW.owner, NEW.size, 0)
+    ON CONFLICT (owner) DO UPDATE SET bytes_used = bytes_used + excluded.bytes_used;
+END;
+
+CREATE TRIGGER IF NOT EXISTS trash_usage_delete AFTER DELETE ON trash
+BEGIN
+    UPDATE user_usage SET bytes_used = bytes_used - OLD.size WHERE owner = OLD.owner;
+END;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS backfills;
\ No newline at end of file
@@ -0,0 +1,6 @@
+-- data migrations that run outside SQL, such as recording the files stored
+-- before metadata, each marked here once it completed so it runs only once
+CREATE TABLE IF NOT EXISTS backfills (
+    name TEXT PRIMARY KEY,
+    completed_at DATETIME NOT NULL
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS legacy_blobs;
\ No newline at end of file
@@ -0,0 +1,6 @@
+-- content stored by MD5 before the blob store may still sit in
+-- BASE_PATH/.blobs/<md5>. The files are recorded here once, so that cleanup
+-- removes each when no file stored the old way uses it anymore.
+CREATE TABLE IF NOT EXISTS legacy_blobs (
+    md5_hash TEXT PRIMARY KEY
+);
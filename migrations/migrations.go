@@ -0,0 +1,10 @@
+// Package migrations embeds the numbered schema migrations so the server
+// binary can apply them without the source tree.
+package migrations
+
+import "embed"
+
+// FS holds NNN_name.up.sql and NNN_name.down.sql for every migration
+//
+//go:embed *.sql
+var FS embed.FS